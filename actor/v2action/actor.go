@@ -1,14 +1,257 @@
 // Package v2action contains the business logic for the commands/v2 package
 package v2action
 
+import (
+	"crypto/sha1"
+	"hash"
+	"net/http"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
 // Warnings is a list of warnings returned back from the cloud controller
 type Warnings []string
 
-// Actor handles all business logic for Cloud Controller v2 operations.
+// Actor handles all business logic for Cloud Controller v2 operations. An
+// actor is safe for concurrent use by multiple goroutines as long as its
+// exported fields are not changed while it is in use.
 type Actor struct {
 	CloudControllerClient CloudControllerClient
 	UAAClient             UAAClient
-	domainCache           map[string]Domain
+
+	// NewResourceHash returns the hash used to compute resource checksums.
+	// Defaults to SHA1.
+	NewResourceHash func() hash.Hash
+
+	// GatherSHA256 also computes the SHA256 of every gathered file, in the
+	// same pass as its SHA1, for Cloud Controller APIs that match resources
+	// by SHA256. Disabled by default.
+	GatherSHA256 bool
+
+	// DetectContentType sniffs the MIME type of every gathered file, using
+	// http.DetectContentType on the first 512 bytes read while hashing it,
+	// and records it in the Resource's ContentType. Disabled by default.
+	DetectContentType bool
+
+	// FingerprintSampleSize is the number of bytes read from each end of a
+	// file to compute its Fingerprint. Defaults to
+	// DefaultFingerprintSampleSize.
+	FingerprintSampleSize int64
+
+	// HashWorkers is the number of files hashed concurrently when gathering
+	// directory resources. Defaults to runtime.NumCPU().
+	HashWorkers int
+
+	// CopyBufferSize is the size of the buffer files are read with when
+	// hashing and zipping them. Larger buffers mean fewer reads, which helps
+	// on high latency file systems such as NFS. Defaults to 32KB.
+	CopyBufferSize int
+
+	// GatherStrict re-stats each file after hashing it when gathering
+	// directory resources and returns a FileChangedError if its size
+	// changed. Disabled by default as it costs an extra stat per file.
+	GatherStrict bool
+
+	// ChecksumCacheDir, when set, is an existing directory used to cache the
+	// checksums of gathered files between runs. A file is only hashed again
+	// once its modification time or size changes. The cache is not keyed by
+	// NewResourceHash, so actors with different hashes need separate
+	// directories.
+	ChecksumCacheDir string
+
+	// SkipVanishedFiles leaves files and directories that are deleted while
+	// a directory is being gathered out of its resources instead of failing
+	// the gather, which helps when gathering a tree that is still being
+	// built. Other errors, such as permission errors, still fail the gather.
+	// Disabled by default.
+	SkipVanishedFiles bool
+
+	// SkipHiddenFiles leaves files and directories whose name starts with
+	// "." out of gathered directory resources, unless their name is listed
+	// in HiddenFilesAllowed. It is applied alongside .cfignore, so a file
+	// is left out if either excludes it. Disabled by default.
+	SkipHiddenFiles bool
+
+	// HiddenFilesAllowed lists the hidden names that SkipHiddenFiles keeps.
+	// Defaults to .profile and .profile.d, which buildpacks run on startup.
+	HiddenFilesAllowed []string
+
+	// IncludeExtensions, when set, limits the files gathered from a
+	// directory to those whose name ends with one of the extensions, such
+	// as ".class" or "jar", ignoring case. Directories are always gathered
+	// and traversed. It is applied alongside .cfignore, so a file is only
+	// gathered if it has an included extension and is not ignored.
+	IncludeExtensions []string
+
+	// MaxFileSize is the largest file, in bytes, that can be gathered from a
+	// directory. Zero means unlimited.
+	MaxFileSize int64
+
+	// MaxDirectoryDepth is the deepest a file can be nested below the
+	// directory being gathered, counting the file itself, before the gather
+	// fails with a PathTooDeepError. Ignored directories are not traversed
+	// and do not count. Defaults to DefaultMaxDirectoryDepth.
+	MaxDirectoryDepth int
+
+	// ModTimeTolerance is how much earlier than the given time a file can
+	// have been modified and still be hashed by GatherChangedResources.
+	// Defaults to DefaultModTimeTolerance.
+	ModTimeTolerance time.Duration
+
+	// MaxTotalSize is the largest combined Size, in bytes, of the files that
+	// can be zipped from a directory. It is checked before anything is
+	// zipped. Zero means unlimited.
+	MaxTotalSize int64
+
+	// SkipEmptyFiles leaves zero byte files out of the resources gathered
+	// from a directory, and therefore out of the zip. Directories are always
+	// gathered.
+	SkipEmptyFiles bool
+
+	// ZipStoreUncompressed stores files in zips without compressing them.
+	// Defaults to deflating them.
+	ZipStoreUncompressed bool
+
+	// ZipCompressionLevel is the flate compression level used when deflating
+	// files in zips. Zero uses flate.DefaultCompression, so
+	// flate.NoCompression cannot be set: ZipStoreUncompressed is the only way
+	// to store files uncompressed. Levels outside flate.HuffmanOnly to
+	// flate.BestCompression return an InvalidCompressionLevelError before
+	// any zip is created.
+	ZipCompressionLevel int
+
+	// ZipDeduplicate compresses files that share a SHA1 once and reuses the
+	// compressed contents for every other copy in the zip. The compressed
+	// contents are held in memory until the last copy has been written.
+	ZipDeduplicate bool
+
+	// ZipModifiedTime, when set, is used as the modification time of every
+	// zip entry so that zipping the same files always produces the same
+	// bytes. By default entries keep the modification time of their source.
+	ZipModifiedTime time.Time
+
+	// ZipOwner, when set, is recorded as the owner of every zip entry in an
+	// Info-ZIP Unix extra field, so that zips built by different users are
+	// identical and unzip extracts them with a known owner. By default
+	// entries record no owner. The mode is stored separately and is not
+	// affected.
+	ZipOwner *ZipOwner
+
+	// ZipEmbeddedManifestName, when set, adds an entry of that name to the
+	// root of zips created from a directory, holding the JSON manifest of the
+	// zipped resources written by MarshalResources, for buildpacks that want
+	// a listing of the app's files. The entry has no source file, so it is
+	// not checked against a SHA1 and is not counted in ZipSummary. A
+	// resource stored under the same name returns an
+	// EmbeddedManifestConflictError. Disabled by default; see
+	// DefaultZipEmbeddedManifestName.
+	ZipEmbeddedManifestName string
+
+	// ZipTempDir is the directory zip files and downloaded remote archives
+	// are created in. It must exist and be writable. Defaults to the OS temp
+	// directory. When a gathered directory contains it, the actor's
+	// temporary zips inside it are left out, so that zips being written
+	// concurrently are not gathered.
+	ZipTempDir string
+
+	// ZipSync flushes each zip file to disk before returning its location,
+	// so that a crash shortly after zipping cannot leave an incomplete zip
+	// behind. Disabled by default as it waits for the disk.
+	ZipSync bool
+
+	// ZipVerify rereads each directory zip after writing it and returns an
+	// IncompleteZipError if it is missing entries. Disabled by default as
+	// it reads every zip a second time.
+	ZipVerify bool
+
+	// PreserveFileModes keeps the modes reported by the file system when
+	// gathering and zipping directory resources. By default, files on
+	// Windows are made readable, writable and executable by their owner,
+	// since Windows has no executable bit. Archive modes are always kept.
+	PreserveFileModes bool
+
+	// PreserveSymlinks gathers and zips symlinks in a directory as links
+	// rather than following them. Each link is stored as a zip entry with
+	// the symlink mode bit set and the link's target as its content, which
+	// is how unzip recreates links. Links must still point inside the
+	// source directory. Disabled by default.
+	PreserveSymlinks bool
+
+	// FilePermissions are the permissions given to archive files, and to
+	// files gathered from memory, that have no permissions of their own.
+	// Defaults to DefaultArchiveFilePermissions.
+	FilePermissions os.FileMode
+
+	// FolderPermissions are the permissions given to archived directories
+	// that have no permissions of their own when they are zipped. Defaults
+	// to DefaultFolderPermissions.
+	FolderPermissions os.FileMode
+
+	// ModeOverrides replace the permissions of archive files whose
+	// slash-separated filename matches their Pattern when gathering archive
+	// resources, for archives that carry no meaningful modes. When several
+	// patterns match a file, the last one wins. Files matching no pattern
+	// keep the mode found in the archive. Setuid, setgid and sticky bits are
+	// never overridden.
+	ModeOverrides []ModeOverride
+
+	// HTTPClient fetches remote archives. Defaults to http.DefaultClient,
+	// which uses the proxy set in the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// environment variables.
+	HTTPClient *http.Client
+
+	// OpenFile opens the files being gathered and zipped. Defaults to
+	// os.Open.
+	OpenFile func(name string) (*os.File, error)
+
+	// OpenRetryAttempts is the number of times opening a file is retried
+	// after a transient failure, such as a sharing violation while a virus
+	// scanner holds the file on Windows. Defaults to
+	// DefaultOpenRetryAttempts; a negative value disables retries.
+	OpenRetryAttempts int
+
+	// OpenRetryDelay is the delay before the first retry of a transient
+	// open failure. It doubles after every retry. Defaults to
+	// DefaultOpenRetryDelay.
+	OpenRetryDelay time.Duration
+
+	// ResourceMatchBatchSize is the maximum number of resources sent in a
+	// single resource match request. Defaults to
+	// DefaultResourceMatchBatchSize.
+	ResourceMatchBatchSize int
+
+	// FileReadTimeout, when set, is the longest hashing a single file may
+	// take while gathering directory resources before a
+	// FileReadTimeoutError is returned, so that a stalled network mount
+	// cannot hang the gather. Cancelling the gather's context also
+	// interrupts a stalled read when it is set. Disabled by default.
+	FileReadTimeout time.Duration
+
+	// HashProgress, when set, is called periodically while files of at
+	// least HashProgressThreshold bytes are hashed, so that gathering a
+	// directory dominated by a huge file can show progress. It is not
+	// called for a file again once reading it has timed out, so no new call
+	// starts after the FileReadTimeoutError is returned.
+	HashProgress HashProgressFunc
+
+	// HashProgressThreshold is the size, in bytes, from which files report
+	// their hashing progress to HashProgress. Defaults to
+	// DefaultHashProgressThreshold.
+	HashProgressThreshold int64
+
+	// EstimateSampleRate is the fraction of files, between 0 and 1, that
+	// EstimateCompressedSize compresses to estimate the size of a zip.
+	// Lower rates are faster but less accurate. Defaults to compressing
+	// every file for an exact size.
+	EstimateSampleRate float64
+
+	// Logger receives the actor's resource gathering and zipping logs.
+	// Defaults to the global logrus logger.
+	Logger log.FieldLogger
+
+	domainCache *domainCache
 }
 
 // NewActor returns a new actor.
@@ -16,6 +259,14 @@ func NewActor(ccClient CloudControllerClient, uaaClient UAAClient) *Actor {
 	return &Actor{
 		CloudControllerClient: ccClient,
 		UAAClient:             uaaClient,
-		domainCache:           map[string]Domain{},
+		NewResourceHash:       sha1.New,
+		domainCache:           newDomainCache(),
+	}
+}
+
+func (actor Actor) logger() log.FieldLogger {
+	if actor.Logger == nil {
+		return log.StandardLogger()
 	}
+	return actor.Logger
 }
@@ -0,0 +1,395 @@
+package v2action
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"code.cloudfoundry.org/ykk"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	tarMagic  = []byte("ustar")
+	utf8BOM   = "\xef\xbb\xbf"
+)
+
+// zipUTF8Flag is the general purpose flag bit set on zip entries whose names
+// are encoded in UTF-8.
+const zipUTF8Flag = 0x800
+
+// tarMagicOffset is the offset of the magic field in a tar header.
+const tarMagicOffset = 257
+
+// zipCreatorUnix and zipCreatorMacOSX are the zip creator systems whose
+// entries store a Unix mode in their external attributes.
+const (
+	zipCreatorUnix   = 3
+	zipCreatorMacOSX = 19
+)
+
+// archiveEntry is a single file or directory in an archive. open is only
+// valid for the duration of the archiveReader.walk callback.
+type archiveEntry struct {
+	name string
+	info os.FileInfo
+	open func() (io.ReadCloser, error)
+}
+
+// archiveReader walks the entries of an archive in the order they are stored.
+type archiveReader interface {
+	walk(func(entry archiveEntry) error) error
+}
+
+// openArchiveReader returns a reader for the archive stored in the given
+// file. See newArchiveReader for the supported formats.
+func (actor Actor) openArchiveReader(archive *os.File) (archiveReader, error) {
+	info, err := archive.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := actor.readArchive(archive, info.Size())
+	if _, ok := err.(InvalidArchiveError); ok {
+		return nil, InvalidArchiveError{Path: archive.Name()}
+	}
+
+	if gzipReader, ok := reader.(gzipFileArchiveReader); ok {
+		gzipReader.name = strings.TrimSuffix(filepath.Base(archive.Name()), ".gz")
+		reader = gzipReader
+	}
+	return reader, err
+}
+
+// readArchive validates archive and size before passing them on to
+// newArchiveReader, since archives come from untrusted sources. A missing or
+// empty archive, or a negative size, is an InvalidArchiveError.
+func (actor Actor) readArchive(archive io.ReaderAt, size int64) (archiveReader, error) {
+	if archive == nil || size <= 0 {
+		return nil, InvalidArchiveError{}
+	}
+	return actor.newArchiveReader(archive, size)
+}
+
+// newArchiveReader returns a reader for the zip, tar or gzipped tar archive
+// stored in the first size bytes of archive. The format is detected from the
+// archive's contents. A gzipped file that is not a tar archive is read as an
+// archive containing that single file.
+func (actor Actor) newArchiveReader(archive io.ReaderAt, size int64) (archiveReader, error) {
+	header := make([]byte, tarMagicOffset+len(tarMagic))
+	n, err := archive.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	source := io.NewSectionReader(archive, 0, size)
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		isTar, err := isGzippedTar(source)
+		if err != nil {
+			actor.logger().Errorln("reading gzip:", err)
+			return nil, InvalidArchiveError{}
+		}
+		if !isTar {
+			return gzipFileArchiveReader{archive: archive, size: size}, nil
+		}
+		return gzipTarArchiveReader{source: io.NewSectionReader(archive, 0, size)}, nil
+	case isTarHeader(header):
+		return tarArchiveReader{source: source}, nil
+	}
+
+	reader, err := ykk.NewReader(source, size)
+	if err != nil {
+		actor.logger().Errorln("reading zip:", err)
+		return nil, InvalidArchiveError{}
+	}
+	return zipArchiveReader{reader: reader}, nil
+}
+
+// sanitizeArchivePath converts backslashes in an archive entry's name to
+// slashes and returns an UnsafeArchivePathError if the name has a volume or
+// host, or if its '..' segments lead outside of the archive root. A single
+// leading '/' refers to the archive root. Safe names are cleaned and made
+// relative to the archive root, so that every file has a single name, while
+// directories keep their trailing '/'. The archive root directory itself is
+// named "."; a file cannot be.
+func sanitizeArchivePath(name string, isDir bool) (string, error) {
+	sanitized := strings.Replace(name, `\`, "/", -1)
+	if strings.HasPrefix(sanitized, "//") || len(sanitized) >= 2 && sanitized[1] == ':' {
+		return "", UnsafeArchivePathError{Name: name}
+	}
+
+	depth := 0
+	for _, segment := range strings.Split(sanitized, "/") {
+		switch segment {
+		case "", ".":
+		case "..":
+			depth--
+			if depth < 0 {
+				return "", UnsafeArchivePathError{Name: name}
+			}
+		default:
+			depth++
+		}
+	}
+
+	cleaned := path.Clean(strings.TrimPrefix(sanitized, "/"))
+	if cleaned == "." && !isDir {
+		return "", UnsafeArchivePathError{Name: name}
+	}
+	if cleaned != "." && strings.HasSuffix(sanitized, "/") {
+		cleaned += "/"
+	}
+	return cleaned, nil
+}
+
+// isGzippedTar returns true if the gzipped stream read from source starts
+// with a tar header.
+func isGzippedTar(source io.Reader) (bool, error) {
+	gzipReader, err := gzip.NewReader(source)
+	if err != nil {
+		return false, err
+	}
+	defer gzipReader.Close()
+
+	header := make([]byte, tarMagicOffset+len(tarMagic))
+	n, err := io.ReadFull(gzipReader, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return isTarHeader(header[:n]), nil
+}
+
+func isTarHeader(header []byte) bool {
+	return len(header) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic)
+}
+
+type zipArchiveReader struct {
+	reader *zip.Reader
+}
+
+func (r zipArchiveReader) walk(fn func(entry archiveEntry) error) error {
+	for _, archivedFile := range r.reader.File {
+		info := archivedFile.FileInfo()
+		name, err := sanitizeArchivePath(decodeZipEntryName(archivedFile.FileHeader), info.IsDir())
+		if err != nil {
+			return err
+		}
+		// the archive root is not an entry of its own
+		if name == "." {
+			continue
+		}
+
+		if info.IsDir() && !hasUnixMode(archivedFile.FileHeader) {
+			info = modelessDirectoryInfo{FileInfo: info}
+		}
+
+		err = fn(archiveEntry{
+			name: name,
+			info: info,
+			open: archivedFile.Open,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeZipEntryName returns the entry's name with any leading byte order
+// mark removed. Names without the UTF-8 flag that are not valid UTF-8 were
+// written by tools, mostly on Windows, that use the original CP437 encoding
+// and are decoded from it. Unflagged names that are valid UTF-8 are kept,
+// since many tools write UTF-8 without setting the flag.
+func decodeZipEntryName(header zip.FileHeader) string {
+	name := strings.TrimPrefix(header.Name, utf8BOM)
+	if header.Flags&zipUTF8Flag != 0 || utf8.ValidString(name) {
+		return name
+	}
+
+	decoded, err := charmap.CodePage437.NewDecoder().String(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+// setNameEncoding declares the header's name as UTF-8 by setting the UTF-8
+// flag when it contains non-ASCII characters, so that unzip tools do not
+// decode it as CP437. zip.Writer's CreateHeader sets the flag on its own,
+// but CreateRaw, used for deduplicated files, does not.
+func setNameEncoding(header *zip.FileHeader) {
+	header.NonUTF8 = !utf8.ValidString(header.Name)
+	if header.NonUTF8 {
+		return
+	}
+
+	for i := 0; i < len(header.Name); i++ {
+		if header.Name[i] >= utf8.RuneSelf {
+			header.Flags |= zipUTF8Flag
+			return
+		}
+	}
+}
+
+type tarArchiveReader struct {
+	source io.Reader
+}
+
+func (r tarArchiveReader) walk(fn func(entry archiveEntry) error) error {
+	reader := tar.NewReader(r.source)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		info := header.FileInfo()
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			continue
+		}
+
+		name, err := sanitizeArchivePath(header.Name, info.IsDir())
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			continue
+		}
+
+		err = fn(archiveEntry{
+			name: name,
+			info: info,
+			open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(reader), nil
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type gzipTarArchiveReader struct {
+	source io.Reader
+}
+
+func (r gzipTarArchiveReader) walk(fn func(entry archiveEntry) error) error {
+	gzipReader, err := gzip.NewReader(r.source)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	return tarArchiveReader{source: gzipReader}.walk(fn)
+}
+
+// gzipFileArchiveReader reads a single gzipped file as an archive containing
+// just that file. The file is named after name, falling back on the name
+// stored in the gzip header.
+type gzipFileArchiveReader struct {
+	archive io.ReaderAt
+	size    int64
+	name    string
+}
+
+func (r gzipFileArchiveReader) walk(fn func(entry archiveEntry) error) error {
+	gzipReader, err := r.open()
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	name := r.name
+	if name == "" {
+		name = gzipReader.Header.Name
+	}
+	if name == "" {
+		return InvalidArchiveError{}
+	}
+
+	name, err = sanitizeArchivePath(name, false)
+	if err != nil {
+		return err
+	}
+
+	// the uncompressed size is only known once the whole stream is read
+	size, err := io.Copy(ioutil.Discard, gzipReader)
+	if err == io.ErrUnexpectedEOF {
+		return TruncatedArchiveError{Name: name}
+	} else if err != nil {
+		return archiveEntryReadError(name, err)
+	}
+
+	return fn(archiveEntry{
+		name: name,
+		info: gzipFileInfo{
+			name:    path.Base(name),
+			size:    size,
+			modTime: gzipReader.Header.ModTime,
+		},
+		open: func() (io.ReadCloser, error) {
+			return r.open()
+		},
+	})
+}
+
+// archiveEntryReadError converts the checksum errors returned when the
+// contents of the archive entry name do not match the CRC32 stored in the
+// archive into a CorruptArchiveEntryError.
+func archiveEntryReadError(name string, err error) error {
+	if err == zip.ErrChecksum || err == gzip.ErrChecksum {
+		return CorruptArchiveEntryError{Name: name}
+	}
+	return err
+}
+
+func (r gzipFileArchiveReader) open() (*gzip.Reader, error) {
+	return gzip.NewReader(io.NewSectionReader(r.archive, 0, r.size))
+}
+
+// hasUnixMode returns true if the zip entry was written by a system that
+// stores a Unix mode. The mode of other entries is made up from their DOS
+// attributes.
+func hasUnixMode(header zip.FileHeader) bool {
+	creator := header.CreatorVersion >> 8
+	return creator == zipCreatorUnix || creator == zipCreatorMacOSX
+}
+
+// modelessDirectoryInfo describes a directory in a zip that was written
+// without a Unix mode, so that it is given the actor's default permissions
+// rather than ones made up from its DOS attributes.
+type modelessDirectoryInfo struct {
+	os.FileInfo
+}
+
+func (info modelessDirectoryInfo) Mode() os.FileMode { return os.ModeDir }
+
+// gzipFileInfo describes the file stored in a gzipFileArchiveReader. Gzip
+// does not store a mode, so the file is given the actor's default.
+type gzipFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (info gzipFileInfo) Name() string       { return info.name }
+func (info gzipFileInfo) Size() int64        { return info.size }
+func (info gzipFileInfo) Mode() os.FileMode  { return 0 }
+func (info gzipFileInfo) ModTime() time.Time { return info.modTime }
+func (info gzipFileInfo) IsDir() bool        { return false }
+func (info gzipFileInfo) Sys() interface{}   { return nil }
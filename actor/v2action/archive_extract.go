@@ -0,0 +1,163 @@
+package v2action
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractArchive extracts the zip, tar or gzipped tar archive at archivePath
+// into destDir, which is created if needed, and returns the archive's
+// resources as gathered by GatherArchiveResources. Each extracted file and
+// directory is given its resource's Mode, and files are checked against
+// their SHA1. Entries that lead outside of destDir, including through
+// symlinks already in destDir, return an UnsafeArchivePathError. Existing
+// files are never overwritten: an entry for a file that already exists
+// returns an error for which os.IsExist is true. Directories that already
+// exist are kept as they are. Entries that are neither files nor
+// directories, such as symlinks, return an UnsupportedFileTypeError. On
+// error, the entries extracted so far are left in destDir.
+func (actor Actor) ExtractArchive(archivePath string, destDir string) ([]Resource, error) {
+	resources, err := actor.GatherArchiveResources(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	reader, err := actor.openArchiveReader(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(destDir, actor.folderPermissions()); err != nil {
+		return nil, err
+	}
+	root, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// directories are given their mode once all of their files are written,
+	// in case it does not allow writing to them
+	type extractedDir struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []extractedDir
+
+	index := 0
+	err = reader.walk(func(entry archiveEntry) error {
+		// the archive changed since it was gathered
+		if index >= len(resources) {
+			return InvalidArchiveError{Path: archivePath}
+		}
+		resource := resources[index]
+		index++
+
+		path := filepath.Join(root, filepath.FromSlash(entry.name))
+		if entry.info.IsDir() {
+			if err := checkExtractPath(root, path, entry.name); err != nil {
+				return err
+			}
+			if _, err := os.Lstat(path); err == nil {
+				return nil
+			}
+			if err := os.MkdirAll(path, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, extractedDir{path: path, mode: resource.Mode})
+			return nil
+		}
+
+		if !entry.info.Mode().IsRegular() {
+			return UnsupportedFileTypeError{Filename: entry.name, Mode: entry.info.Mode()}
+		}
+
+		if err := checkExtractPath(root, filepath.Dir(path), entry.name); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), actor.folderPermissions()); err != nil {
+			return err
+		}
+		return actor.extractFile(entry, path, resource)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, extractMode(dirs[i].mode)); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// extractFile writes the archive entry to a new file at path, which must not
+// already exist, and returns a FileChangedError if its contents do not match
+// resource's SHA1.
+func (actor Actor) extractFile(entry archiveEntry, path string, resource Resource) error {
+	fileReader, err := entry.open()
+	if err != nil {
+		return err
+	}
+	defer fileReader.Close()
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	checksums, err := actor.checksumReader(context.Background(), io.TeeReader(fileReader, file))
+	if err != nil {
+		err = archiveEntryReadError(entry.name, err)
+	}
+	if err == nil {
+		err = file.Chmod(extractMode(resource.Mode))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && checksums.sha1 != resource.SHA1 {
+		err = FileChangedError{Filename: path, ExpectedSHA1: resource.SHA1, ActualSHA1: checksums.sha1}
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+// checkExtractPath returns an UnsafeArchivePathError for the entry named name
+// if path, or the deepest of its parents that exists, is outside of root
+// once its symlinks are resolved. Creating path could otherwise follow a
+// symlink out of root.
+func checkExtractPath(root string, path string, name string) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	for os.IsNotExist(err) && path != root {
+		path = filepath.Dir(path)
+		resolved, err = filepath.EvalSymlinks(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	relPath, err := filepath.Rel(root, resolved)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return UnsafeArchivePathError{Name: name}
+	}
+	return nil
+}
+
+// extractMode returns the permission bits of mode, along with its setuid,
+// setgid and sticky bits, which os.Chmod applies.
+func extractMode(mode os.FileMode) os.FileMode {
+	return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+}
@@ -0,0 +1,162 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive Extract Actions", func() {
+	var (
+		actor       *Actor
+		tempDir     string
+		archivePath string
+		destDir     string
+	)
+
+	writeArchive := func(names ...string) {
+		archive, err := os.Create(archivePath)
+		Expect(err).ToNot(HaveOccurred())
+		defer archive.Close()
+
+		contents := map[string]string{
+			"level1/tmpFile1": "why hello",
+			"tmpFile2":        "Hello, Binky",
+		}
+		writer := zip.NewWriter(archive)
+		for _, name := range names {
+			fileWriter, err := writer.Create(name)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = fileWriter.Write([]byte(contents[name]))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(writer.Close()).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		tempDir, err = ioutil.TempDir("", "v2-archive-extract")
+		Expect(err).ToNot(HaveOccurred())
+		archivePath = filepath.Join(tempDir, "archive.zip")
+		destDir = filepath.Join(tempDir, "extracted")
+
+		writeArchive("level1/", "level1/tmpFile1", "tmpFile2")
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	Describe("ExtractArchive", func() {
+		It("extracts the archive and returns its resources", func() {
+			resources, err := actor.ExtractArchive(archivePath, destDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			gathered, err := actor.GatherArchiveResources(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(Equal(gathered))
+
+			Expect(filepath.Join(destDir, "level1")).To(BeADirectory())
+			Expect(ioutil.ReadFile(filepath.Join(destDir, "level1", "tmpFile1"))).To(Equal([]byte("why hello")))
+			Expect(ioutil.ReadFile(filepath.Join(destDir, "tmpFile2"))).To(Equal([]byte("Hello, Binky")))
+		})
+
+		It("extracts files the way they were gathered", func() {
+			_, err := actor.ExtractArchive(archivePath, destDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			gathered, err := actor.GatherArchiveResources(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+			extracted, err := actor.GatherDirectoryResources(destDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(actor.ResourcesContentEqual(extracted, []Resource{
+				{Filename: "level1"},
+				gathered[1],
+				gathered[2],
+			})).To(BeTrue())
+		})
+
+		It("creates parent directories missing from the archive", func() {
+			writeArchive("level1/tmpFile1")
+
+			_, err := actor.ExtractArchive(archivePath, destDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.ReadFile(filepath.Join(destDir, "level1", "tmpFile1"))).To(Equal([]byte("why hello")))
+		})
+
+		Context("when an entry leads outside of the destination", func() {
+			BeforeEach(func() {
+				writeArchive("../tmpFile2")
+			})
+
+			It("returns an UnsafeArchivePathError without extracting anything", func() {
+				_, err := actor.ExtractArchive(archivePath, destDir)
+				Expect(err).To(MatchError(UnsafeArchivePathError{Name: "../tmpFile2"}))
+				Expect(filepath.Join(tempDir, "tmpFile2")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		Context("when a file already exists", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(destDir, 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(destDir, "tmpFile2"), []byte("Bananarama"), 0600)).To(Succeed())
+			})
+
+			It("does not overwrite it", func() {
+				_, err := actor.ExtractArchive(archivePath, destDir)
+				Expect(os.IsExist(err)).To(BeTrue())
+				Expect(ioutil.ReadFile(filepath.Join(destDir, "tmpFile2"))).To(Equal([]byte("Bananarama")))
+			})
+		})
+
+		Context("when a directory already exists", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(destDir, "level1"), 0700)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(destDir, "level1", "tmpFile3"), []byte("Bananarama"), 0600)).To(Succeed())
+			})
+
+			It("extracts into it", func() {
+				_, err := actor.ExtractArchive(archivePath, destDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ioutil.ReadFile(filepath.Join(destDir, "level1", "tmpFile1"))).To(Equal([]byte("why hello")))
+				Expect(ioutil.ReadFile(filepath.Join(destDir, "level1", "tmpFile3"))).To(Equal([]byte("Bananarama")))
+			})
+		})
+
+		Context("when an extracted file does not match its SHA1", func() {
+			BeforeEach(func() {
+				// every hash is seeded differently, so no two checksums match
+				seed := byte(0)
+				actor.NewResourceHash = func() hash.Hash {
+					seed++
+					sum := sha1.New()
+					sum.Write([]byte{seed})
+					return sum
+				}
+			})
+
+			It("returns a FileChangedError and removes the file", func() {
+				_, err := actor.ExtractArchive(archivePath, destDir)
+				Expect(err).To(BeAssignableToTypeOf(FileChangedError{}))
+				Expect(err.(FileChangedError).Filename).To(Equal(filepath.Join(destDir, "level1", "tmpFile1")))
+				Expect(filepath.Join(destDir, "level1", "tmpFile1")).ToNot(BeAnExistingFile())
+			})
+		})
+
+		Context("when the archive does not exist", func() {
+			It("returns the error", func() {
+				_, err := actor.ExtractArchive(filepath.Join(tempDir, "missing.zip"), destDir)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+})
@@ -0,0 +1,117 @@
+// +build go1.18
+
+package v2action_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+)
+
+// fuzzTimeout is how long gathering a single fuzzed archive may take before
+// it is considered hung.
+const fuzzTimeout = 10 * time.Second
+
+func FuzzGatherArchiveResources(f *testing.F) {
+	for _, seed := range archiveFuzzSeeds(f) {
+		f.Add(seed)
+	}
+
+	actor := NewActor(nil, nil)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		type result struct {
+			resources []Resource
+			err       error
+		}
+		done := make(chan result, 1)
+		go func() {
+			resources, err := actor.GatherArchiveResourcesFromReader(bytes.NewReader(data), int64(len(data)))
+			done <- result{resources: resources, err: err}
+		}()
+
+		select {
+		case gathered := <-done:
+			if gathered.err != nil {
+				return
+			}
+			for _, resource := range gathered.resources {
+				if name := path.Clean(resource.Filename); name == ".." || strings.HasPrefix(name, "../") || strings.HasPrefix(name, "/") {
+					t.Fatalf("gathered resource %q outside of the archive root", resource.Filename)
+				}
+				if resource.Size < 0 {
+					t.Fatalf("gathered resource %q with negative size %d", resource.Filename, resource.Size)
+				}
+			}
+		case <-time.After(fuzzTimeout):
+			t.Fatalf("gathering %d bytes did not return within %s", len(data), fuzzTimeout)
+		}
+	})
+}
+
+// archiveFuzzSeeds returns small zips, including ones with names that stay
+// inside the archive only once cleaned, and a tar, gzipped tar and gzipped
+// file for the fuzzer to mutate.
+func archiveFuzzSeeds(f *testing.F) [][]byte {
+	zipped := func(names ...string) []byte {
+		var buffer bytes.Buffer
+		zipWriter := zip.NewWriter(&buffer)
+		for _, name := range names {
+			file, err := zipWriter.Create(name)
+			if err != nil {
+				f.Fatal(err)
+			}
+			if strings.HasSuffix(name, "/") {
+				continue
+			}
+			if _, err := file.Write([]byte("why hello")); err != nil {
+				f.Fatal(err)
+			}
+		}
+		if err := zipWriter.Close(); err != nil {
+			f.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+
+	var tarred bytes.Buffer
+	tarWriter := tar.NewWriter(&tarred)
+	if err := tarWriter.WriteHeader(&tar.Header{Name: "tmpFile2", Mode: 0644, Size: 12, Typeflag: tar.TypeReg}); err != nil {
+		f.Fatal(err)
+	}
+	if _, err := tarWriter.Write([]byte("Hello, Binky")); err != nil {
+		f.Fatal(err)
+	}
+	if err := tarWriter.Close(); err != nil {
+		f.Fatal(err)
+	}
+
+	gzipped := func(contents []byte) []byte {
+		var buffer bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buffer)
+		gzipWriter.Name = "tmpFile3"
+		if _, err := gzipWriter.Write(contents); err != nil {
+			f.Fatal(err)
+		}
+		if err := gzipWriter.Close(); err != nil {
+			f.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+
+	return [][]byte{
+		{},
+		zipped("level1/", "level1/tmpFile1"),
+		zipped("level1/", "level1/../tmpFile1"),
+		zipped("/etc/passwd"),
+		tarred.Bytes(),
+		gzipped(tarred.Bytes()),
+		gzipped([]byte("Bananarama")),
+	}
+}
@@ -0,0 +1,98 @@
+package v2action
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ArchiveSubPathNotFoundError is returned when an archive has no entries
+// under the requested SubPath.
+type ArchiveSubPathNotFoundError struct {
+	Path    string
+	SubPath string
+}
+
+func (e ArchiveSubPathNotFoundError) Error() string {
+	return fmt.Sprintf("The provided archive '%s' does not contain '%s'", e.Path, e.SubPath)
+}
+
+// GatherArchiveResourcesUnder behaves like GatherArchiveResources, but only
+// gathers the entries under subPath, renamed relative to it so that subPath
+// becomes the root of the archive. Directories below subPath keep their
+// trailing '/', while the entry for subPath itself is left out. subPath uses
+// '/' separators and an empty subPath gathers the whole archive. The
+// resources must be zipped with ZipArchiveResourcesUnder and the same
+// subPath, since their names no longer match the archive's entries.
+func (actor Actor) GatherArchiveResourcesUnder(archivePath string, subPath string) ([]Resource, error) {
+	resources, err := actor.GatherArchiveResources(archivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := archiveSubPathPrefix(subPath)
+	if prefix == "" {
+		return resources, nil
+	}
+
+	var (
+		found   bool
+		rebased []Resource
+	)
+	for _, resource := range resources {
+		name := strings.TrimPrefix(resource.Filename, "/")
+		if name == prefix {
+			found = true
+			continue
+		}
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		found = true
+		resource.Filename = strings.TrimPrefix(name, prefix)
+		rebased = append(rebased, resource)
+	}
+
+	if !found {
+		return nil, ArchiveSubPathNotFoundError{Path: archivePath, SubPath: subPath}
+	}
+	return rebased, nil
+}
+
+// ZipArchiveResourcesUnder behaves like ZipArchiveResources for resources
+// gathered by GatherArchiveResourcesUnder: only the entries under subPath are
+// zipped, renamed relative to it, and each is checked against the matching
+// entry of filesToInclude. An empty subPath zips the whole archive.
+func (actor Actor) ZipArchiveResourcesUnder(sourceArchivePath string, subPath string, filesToInclude []Resource) (string, error) {
+	prefix := archiveSubPathPrefix(subPath)
+	if prefix == "" {
+		return actor.ZipArchiveResources(sourceArchivePath, filesToInclude)
+	}
+
+	// the archive's entries are matched using their original names
+	prefixed := make([]Resource, 0, len(filesToInclude))
+	for _, resource := range filesToInclude {
+		resource.Filename = prefix + resource.Filename
+		prefixed = append(prefixed, resource)
+	}
+
+	rename := func(original string) (string, bool) {
+		if !strings.HasPrefix(original, prefix) {
+			return "", false
+		}
+		return strings.TrimPrefix(original, prefix), true
+	}
+	return actor.zipArchiveResources(sourceArchivePath, prefixed, zipOptions{rename: rename})
+}
+
+// archiveSubPathPrefix returns the '/' terminated prefix of the entries
+// under subPath, or an empty string when subPath is the archive's root.
+func archiveSubPathPrefix(subPath string) string {
+	root := strings.Trim(path.Clean("/"+filepath.ToSlash(subPath)), "/")
+	if root == "" {
+		return ""
+	}
+	return root + "/"
+}
@@ -0,0 +1,159 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Archive Sub Path Actions", func() {
+	var (
+		actor       *Actor
+		archivePath string
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		archive, err := ioutil.TempFile("", "v2-archive-sub-path")
+		Expect(err).ToNot(HaveOccurred())
+		defer archive.Close()
+		archivePath = archive.Name()
+
+		writer := zip.NewWriter(archive)
+		for name, contents := range map[string]string{
+			"README":              "read me",
+			"dist/":               "",
+			"dist/app.js":         "why hello",
+			"dist/assets/":        "",
+			"dist/assets/app.css": "Hello, Binky",
+			"distribution/notes":  "Bananarama",
+			"src/app.ts":          "why hello",
+		} {
+			fileWriter, err := writer.Create(name)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = fileWriter.Write([]byte(contents))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(writer.Close()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(archivePath)).To(Succeed())
+	})
+
+	Describe("GatherArchiveResourcesUnder", func() {
+		It("only gathers the entries under the sub path, relative to it", func() {
+			resources, err := actor.GatherArchiveResourcesUnder(archivePath, "dist")
+			Expect(err).ToNot(HaveOccurred())
+
+			var filenames []string
+			for _, resource := range resources {
+				filenames = append(filenames, resource.Filename)
+			}
+			Expect(filenames).To(ConsistOf("app.js", "assets/", "assets/app.css"))
+		})
+
+		It("keeps the checksums and sizes of the rebased files", func() {
+			resources, err := actor.GatherArchiveResourcesUnder(archivePath, "dist")
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, resource := range resources {
+				if resource.Filename == "app.js" {
+					Expect(resource.SHA1).To(Equal("9e36efec86d571de3a38389ea799a796fe4782f4"))
+					Expect(resource.Size).To(BeEquivalentTo(9))
+				}
+			}
+		})
+
+		It("ignores leading and trailing slashes in the sub path", func() {
+			resources, err := actor.GatherArchiveResourcesUnder(archivePath, "/dist/assets/")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(HaveLen(1))
+			Expect(resources[0].Filename).To(Equal("app.css"))
+		})
+
+		Context("when the sub path only exists as a prefix of other entries", func() {
+			It("gathers the entries below it", func() {
+				resources, err := actor.GatherArchiveResourcesUnder(archivePath, "src")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].Filename).To(Equal("app.ts"))
+			})
+		})
+
+		Context("when the sub path is empty", func() {
+			It("gathers the whole archive", func() {
+				resources, err := actor.GatherArchiveResourcesUnder(archivePath, "")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(7))
+			})
+		})
+
+		Context("when no entries are under the sub path", func() {
+			It("returns an ArchiveSubPathNotFoundError", func() {
+				_, err := actor.GatherArchiveResourcesUnder(archivePath, "dis")
+				Expect(err).To(MatchError(ArchiveSubPathNotFoundError{Path: archivePath, SubPath: "dis"}))
+
+				_, err = actor.GatherArchiveResourcesUnder(archivePath, "README")
+				Expect(err).To(MatchError(ArchiveSubPathNotFoundError{Path: archivePath, SubPath: "README"}))
+			})
+		})
+	})
+
+	Describe("ZipArchiveResourcesUnder", func() {
+		var resources []Resource
+
+		BeforeEach(func() {
+			var err error
+			resources, err = actor.GatherArchiveResourcesUnder(archivePath, "dist")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("only zips the entries under the sub path, relative to it", func() {
+			zipPath, err := actor.ZipArchiveResourcesUnder(archivePath, "dist", resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			Expect(resourceFilenamesFromZip(reader.File)).To(ConsistOf("app.js", "assets/", "assets/app.css"))
+			expectFileContentsToEqual(findZipFile(reader.File, "app.js"), "why hello")
+			expectFileContentsToEqual(findZipFile(reader.File, "assets/app.css"), "Hello, Binky")
+		})
+
+		It("checks the files against the gathered resources", func() {
+			for i := range resources {
+				if resources[i].Filename == "app.js" {
+					resources[i].SHA1 = "i dunno, 7?"
+				}
+			}
+
+			_, err := actor.ZipArchiveResourcesUnder(archivePath, "dist", resources)
+			Expect(err).To(MatchError(FileChangedError{
+				Filename:     "dist/app.js",
+				ExpectedSHA1: "i dunno, 7?",
+				ActualSHA1:   "9e36efec86d571de3a38389ea799a796fe4782f4",
+			}))
+		})
+
+		Context("when the sub path is empty", func() {
+			It("zips the whole archive", func() {
+				zipPath, err := actor.ZipArchiveResourcesUnder(archivePath, "", nil)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(reader.File).To(HaveLen(7))
+			})
+		})
+	})
+})
@@ -0,0 +1,50 @@
+package v2action
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CaseConflictError is returned when resources have filenames that differ
+// only in case, which collide when unpacked on a case-insensitive file
+// system. Each conflict lists the colliding filenames, sorted.
+type CaseConflictError struct {
+	Conflicts [][]string
+}
+
+func (e CaseConflictError) Error() string {
+	conflicts := make([]string, 0, len(e.Conflicts))
+	for _, filenames := range e.Conflicts {
+		conflicts = append(conflicts, strings.Join(filenames, ", "))
+	}
+	return fmt.Sprintf("Filenames differ only in case and collide on case-insensitive file systems: %s", strings.Join(conflicts, "; "))
+}
+
+// CheckCaseConflicts returns a CaseConflictError if any of the resources have
+// filenames that differ only in case. Gathering never performs this check
+// itself, since the collision only matters for some file systems.
+func (_ Actor) CheckCaseConflicts(resources []Resource) error {
+	filenamesByKey := map[string][]string{}
+	var keys []string
+	for _, resource := range uniqueSortedResources(resources) {
+		key := strings.ToLower(strings.TrimSuffix(resource.Filename, "/"))
+		if _, ok := filenamesByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		filenamesByKey[key] = append(filenamesByKey[key], resource.Filename)
+	}
+	sort.Strings(keys)
+
+	var conflicts [][]string
+	for _, key := range keys {
+		if len(filenamesByKey[key]) > 1 {
+			conflicts = append(conflicts, filenamesByKey[key])
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return CaseConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
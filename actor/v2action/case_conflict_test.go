@@ -0,0 +1,48 @@
+package v2action_test
+
+import (
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Case Conflict Actions", func() {
+	var actor *Actor
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+	})
+
+	Describe("CheckCaseConflicts", func() {
+		It("returns a CaseConflictError listing filenames that differ only in case", func() {
+			err := actor.CheckCaseConflicts([]Resource{
+				{Filename: "readme.md", SHA1: "some-sha-1"},
+				{Filename: "docs"},
+				{Filename: "Docs/"},
+				{Filename: "docs/guide.md", SHA1: "some-sha-2"},
+				{Filename: "README.md", SHA1: "some-sha-3"},
+			})
+			Expect(err).To(MatchError(CaseConflictError{Conflicts: [][]string{
+				{"Docs/", "docs"},
+				{"README.md", "readme.md"},
+			}}))
+			Expect(err.Error()).To(Equal("Filenames differ only in case and collide on case-insensitive file systems: Docs/, docs; README.md, readme.md"))
+		})
+
+		It("ignores filenames that are listed more than once", func() {
+			err := actor.CheckCaseConflicts([]Resource{
+				{Filename: "README.md", SHA1: "some-sha-1"},
+				{Filename: "README.md", SHA1: "some-sha-1"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns nil when every filename is unique", func() {
+			err := actor.CheckCaseConflicts([]Resource{
+				{Filename: "README.md", SHA1: "some-sha-1"},
+				{Filename: "LICENSE", SHA1: "some-sha-2"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+})
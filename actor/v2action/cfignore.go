@@ -0,0 +1,160 @@
+package v2action
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CFIgnoreFilename is the name of the file, located at the root of an
+// application directory, that lists the paths to exclude when gathering
+// resources. Patterns follow .gitignore semantics.
+const CFIgnoreFilename = ".cfignore"
+
+type ignorePattern struct {
+	segments []string
+	anchored bool
+	dirOnly  bool
+	negate   bool
+}
+
+type ignoreMatcher []ignorePattern
+
+// readCFIgnore returns the patterns listed in sourceDir's .cfignore file. A
+// missing file results in no patterns.
+func readCFIgnore(sourceDir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(sourceDir, CFIgnoreFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return scanCFIgnore(file)
+}
+
+// readCFIgnoreFS behaves like readCFIgnore, but reads the .cfignore file of
+// the slash separated sourceDir from fsys.
+func readCFIgnoreFS(fsys fs.FS, sourceDir string) ([]string, error) {
+	file, err := fsys.Open(path.Join(sourceDir, CFIgnoreFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return scanCFIgnore(file)
+}
+
+// scanCFIgnore returns the lines of a .cfignore file.
+func scanCFIgnore(reader io.Reader) ([]string, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return patterns, scanner.Err()
+}
+
+// newIgnoreMatcher parses .gitignore style patterns. Blank lines and lines
+// starting with '#' are skipped, a leading '!' negates the pattern, a
+// trailing '/' only matches directories and a pattern containing a '/' is
+// anchored to the root of the directory.
+func newIgnoreMatcher(patterns []string) ignoreMatcher {
+	var matcher ignoreMatcher
+	for _, rawPattern := range patterns {
+		pattern := strings.TrimRight(rawPattern, " \t\r")
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		var ignore ignorePattern
+		if strings.HasPrefix(pattern, "!") {
+			ignore.negate = true
+			pattern = pattern[1:]
+		} else if strings.HasPrefix(pattern, `\`) {
+			pattern = pattern[1:]
+		}
+
+		if strings.HasSuffix(pattern, "/") {
+			ignore.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+
+		if strings.Contains(pattern, "/") {
+			ignore.anchored = true
+			pattern = strings.TrimLeft(pattern, "/")
+		}
+
+		if pattern == "" {
+			continue
+		}
+
+		ignore.segments = strings.Split(pattern, "/")
+		matcher = append(matcher, ignore)
+	}
+	return matcher
+}
+
+// ignored returns true if the slash separated relPath should be excluded. The
+// last matching pattern wins.
+func (matcher ignoreMatcher) ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range matcher {
+		if pattern.matches(relPath, isDir) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+func (pattern ignorePattern) matches(relPath string, isDir bool) bool {
+	if pattern.dirOnly && !isDir {
+		return false
+	}
+
+	pathSegments := strings.Split(relPath, "/")
+	if pattern.anchored {
+		return matchSegments(pattern.segments, pathSegments)
+	}
+
+	for i := range pathSegments {
+		if matchSegments(pattern.segments, pathSegments[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches each path segment against the corresponding glob,
+// where '**' matches zero or more segments.
+func matchSegments(globs []string, pathSegments []string) bool {
+	if len(globs) == 0 {
+		return len(pathSegments) == 0
+	}
+
+	if globs[0] == "**" {
+		for i := 0; i <= len(pathSegments); i++ {
+			if matchSegments(globs[1:], pathSegments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(pathSegments) == 0 {
+		return false
+	}
+
+	matched, err := path.Match(globs[0], pathSegments[0])
+	if err != nil || !matched {
+		return false
+	}
+	return matchSegments(globs[1:], pathSegments[1:])
+}
@@ -0,0 +1,50 @@
+package v2action
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultModTimeTolerance is how much earlier than since a file can have
+// been modified and still be considered changed by GatherChangedResources
+// when ModTimeTolerance is not set.
+const DefaultModTimeTolerance = 2 * time.Second
+
+// GatherChangedResources gathers sourceDir like GatherDirectoryResources, but
+// only hashes the files modified after since, such as the time of the
+// previous push, and returns them as changed. Every other file, along with
+// every directory, is returned as unchanged without its contents being read,
+// so its SHA1 is empty and has to be taken from the previously gathered
+// resources. Files modified up to the actor's ModTimeTolerance before since
+// still count as changed, to allow for clock skew and coarse modification
+// times. Detection relies on modification times alone: a file whose
+// contents change without its modification time moving forward, such as
+// one restored with its original time, is returned as unchanged.
+func (actor Actor) GatherChangedResources(sourceDir string, since time.Time) ([]Resource, []Resource, error) {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report, err := actor.gatherDirectoryResources(context.Background(), sourceDir, ignorePatterns, gatherOptions{changedSince: since.Add(-actor.modTimeTolerance())})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changed, unchanged []Resource
+	for _, resource := range report.Resources {
+		if resource.SHA1 != "" {
+			changed = append(changed, resource)
+		} else {
+			unchanged = append(unchanged, resource)
+		}
+	}
+	return changed, unchanged, nil
+}
+
+func (actor Actor) modTimeTolerance() time.Duration {
+	if actor.ModTimeTolerance <= 0 {
+		return DefaultModTimeTolerance
+	}
+	return actor.ModTimeTolerance
+}
@@ -0,0 +1,104 @@
+package v2action_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Changed Resource Actions", func() {
+	var (
+		actor  *Actor
+		srcDir string
+		since  time.Time
+		opened []string
+	)
+
+	writeFile := func(filename string, contents string, modTime time.Time) {
+		path := filepath.Join(srcDir, filename)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+		opened = nil
+		actor.HashWorkers = 1
+		actor.OpenFile = func(name string) (*os.File, error) {
+			opened = append(opened, filepath.Base(name))
+			return os.Open(name)
+		}
+
+		var err error
+		srcDir, err = ioutil.TempDir("", "v2-changed-resources")
+		Expect(err).ToNot(HaveOccurred())
+
+		since = time.Now().Add(-time.Hour)
+		Expect(os.Mkdir(filepath.Join(srcDir, "level1"), 0755)).To(Succeed())
+		writeFile("level1/tmpFile1", "why hello", since.Add(-time.Hour))
+		writeFile("tmpFile2", "Hello, Binky", since.Add(time.Minute))
+		writeFile("tmpFile3", "Bananarama", since.Add(-time.Hour))
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(srcDir)).To(Succeed())
+	})
+
+	Describe("GatherChangedResources", func() {
+		It("only hashes the files modified since the given time", func() {
+			changed, unchanged, err := actor.GatherChangedResources(srcDir, since)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resourceFilenames(changed)).To(Equal([]string{"tmpFile2"}))
+			Expect(changed[0].SHA1).To(Equal("e594bdc795bb293a0e55724137e53a36dc0d9e95"))
+			Expect(changed[0].Size).To(BeNumerically("==", 12))
+
+			Expect(resourceFilenames(unchanged)).To(Equal([]string{"level1", "level1/tmpFile1", "tmpFile3"}))
+			for _, resource := range unchanged {
+				Expect(resource.SHA1).To(BeEmpty())
+			}
+			Expect(unchanged[1].Size).To(BeNumerically("==", 9))
+			Expect(opened).To(Equal([]string{"tmpFile2"}))
+		})
+
+		It("treats files modified within the tolerance before the given time as changed", func() {
+			writeFile("tmpFile3", "Bananarama", since.Add(-time.Second))
+
+			changed, _, err := actor.GatherChangedResources(srcDir, since)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourceFilenames(changed)).To(Equal([]string{"tmpFile2", "tmpFile3"}))
+		})
+
+		Context("when the actor is configured with a mod time tolerance", func() {
+			BeforeEach(func() {
+				actor.ModTimeTolerance = 2 * time.Hour
+			})
+
+			It("uses the tolerance", func() {
+				changed, unchanged, err := actor.GatherChangedResources(srcDir, since)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(changed)).To(Equal([]string{"level1/tmpFile1", "tmpFile2", "tmpFile3"}))
+				Expect(resourceFilenames(unchanged)).To(Equal([]string{"level1"}))
+			})
+		})
+
+		It("applies the .cfignore file", func() {
+			writeFile(".cfignore", "tmpFile2\n", since.Add(-time.Hour))
+
+			changed, unchanged, err := actor.GatherChangedResources(srcDir, since)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(changed).To(BeEmpty())
+			Expect(resourceFilenames(unchanged)).To(Equal([]string{".cfignore", "level1", "level1/tmpFile1", "tmpFile3"}))
+		})
+
+		It("returns an error when the directory does not exist", func() {
+			_, _, err := actor.GatherChangedResources(filepath.Join(srcDir, "missing"), since)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,123 @@
+package v2action
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ChecksumCacheFilename is the name of the file, in the actor's
+// ChecksumCacheDir, that stores previously computed checksums.
+const ChecksumCacheFilename = "resource-checksums.json"
+
+type checksumCacheEntry struct {
+	ModTime     int64  `json:"mod_time"`
+	Size        int64  `json:"size"`
+	SHA1        string `json:"sha1"`
+	SHA256      string `json:"sha256,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// checksumCache maps the absolute path of a file to the checksum computed
+// for it, which stays valid while its modification time and size are
+// unchanged. A nil cache never contains any checksums.
+type checksumCache struct {
+	path string
+
+	mutex   sync.Mutex
+	entries map[string]checksumCacheEntry
+	dirty   bool
+}
+
+// loadChecksumCache reads the cache stored in dir. A missing or unreadable
+// cache file results in an empty cache.
+func loadChecksumCache(dir string) *checksumCache {
+	cache := &checksumCache{
+		path:    filepath.Join(dir, ChecksumCacheFilename),
+		entries: map[string]checksumCacheEntry{},
+	}
+
+	raw, err := ioutil.ReadFile(cache.path)
+	if err == nil {
+		if err := json.Unmarshal(raw, &cache.entries); err != nil {
+			cache.entries = map[string]checksumCacheEntry{}
+		}
+	}
+	return cache
+}
+
+func (cache *checksumCache) lookup(path string, modTime time.Time, size int64) (resourceChecksums, bool) {
+	if cache == nil {
+		return resourceChecksums{}, false
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[path]
+	if !ok || entry.ModTime != modTime.UnixNano() || entry.Size != size {
+		return resourceChecksums{}, false
+	}
+	return resourceChecksums{sha1: entry.SHA1, sha256: entry.SHA256, contentType: entry.ContentType}, true
+}
+
+func (cache *checksumCache) store(path string, modTime time.Time, size int64, checksums resourceChecksums) {
+	if cache == nil {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.entries[path] = checksumCacheEntry{
+		ModTime:     modTime.UnixNano(),
+		Size:        size,
+		SHA1:        checksums.sha1,
+		SHA256:      checksums.sha256,
+		ContentType: checksums.contentType,
+	}
+	cache.dirty = true
+}
+
+// save writes the cache back to disk if any checksums were stored. The file
+// is replaced atomically so concurrent gathers never read a partial cache.
+func (cache *checksumCache) save() error {
+	if cache == nil {
+		return nil
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if !cache.dirty {
+		return nil
+	}
+
+	raw, err := json.Marshal(cache.entries)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(cache.path), ChecksumCacheFilename)
+	if err != nil {
+		return err
+	}
+
+	_, err = tempFile.Write(raw)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), cache.path)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	cache.dirty = false
+	return nil
+}
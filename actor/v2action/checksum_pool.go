@@ -0,0 +1,158 @@
+package v2action
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// errChecksumPoolStopped is returned when adding files to a pool that has
+// already encountered an error.
+var errChecksumPoolStopped = errors.New("checksum pool stopped")
+
+type checksumJob struct {
+	index   int
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// checksumPool computes file checksums across a bounded number of goroutines.
+// Results are keyed by the index the file was added with.
+type checksumPool struct {
+	jobs  chan checksumJob
+	done  chan struct{}
+	wg    sync.WaitGroup
+	fsys  fileSystem
+	cache *checksumCache
+
+	// skip, when set, reports which errors skip the file at path rather than
+	// stopping the pool.
+	skip func(path string, err error) bool
+
+	mutex     sync.Mutex
+	checksums map[int]resourceChecksums
+	skipped   map[int]error
+	err       error
+}
+
+// startChecksumPool starts the pool's workers, which read files from fsys.
+// Checksums found in cache are used instead of hashing the file; a nil cache
+// is ignored.
+func (actor Actor) startChecksumPool(ctx context.Context, fsys fileSystem, cache *checksumCache) *checksumPool {
+	workers := actor.HashWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	pool := &checksumPool{
+		jobs:      make(chan checksumJob),
+		done:      make(chan struct{}),
+		fsys:      fsys,
+		cache:     cache,
+		checksums: map[int]resourceChecksums{},
+		skipped:   map[int]error{},
+	}
+
+	for i := 0; i < workers; i++ {
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			for job := range pool.jobs {
+				if pool.stopped() {
+					continue
+				}
+				checksums, err := actor.checksumFile(ctx, pool.fsys, pool.cache, job)
+				pool.record(job, checksums, err)
+			}
+		}()
+	}
+
+	return pool
+}
+
+// add queues the file at path, whose size and modification time were
+// recorded when it was gathered, to be checksummed. It returns
+// errChecksumPoolStopped once any worker has failed.
+func (pool *checksumPool) add(index int, path string, size int64, modTime time.Time) error {
+	select {
+	case pool.jobs <- checksumJob{index: index, path: path, size: size, modTime: modTime}:
+		return nil
+	case <-pool.done:
+		return errChecksumPoolStopped
+	}
+}
+
+// wait blocks until all queued files have been checksummed and returns the
+// results, the errors of any skipped files and the first error encountered.
+func (pool *checksumPool) wait() (map[int]resourceChecksums, map[int]error, error) {
+	close(pool.jobs)
+	pool.wg.Wait()
+	return pool.checksums, pool.skipped, pool.err
+}
+
+// checksumFile returns the checksums of the file in fsys described by job,
+// using and updating cache when it is not nil.
+func (actor Actor) checksumFile(ctx context.Context, fsys fileSystem, cache *checksumCache, job checksumJob) (resourceChecksums, error) {
+	var absPath string
+	if cache != nil {
+		var err error
+		absPath, err = filepath.Abs(job.path)
+		if err != nil {
+			return resourceChecksums{}, err
+		}
+
+		checksums, ok := cache.lookup(absPath, job.modTime, job.size)
+		if ok && (checksums.sha256 != "" || !actor.GatherSHA256) && (checksums.contentType != "" || !actor.DetectContentType) {
+			if !actor.GatherSHA256 {
+				checksums.sha256 = ""
+			}
+			if !actor.DetectContentType {
+				checksums.contentType = ""
+			}
+			return checksums, nil
+		}
+	}
+
+	checksums, err := actor.computeChecksum(ctx, fsys, job.path)
+	if err == nil && actor.GatherStrict {
+		err = checkFileSize(fsys, job.path, job.size)
+	}
+	if err != nil {
+		return resourceChecksums{}, err
+	}
+
+	cache.store(absPath, job.modTime, job.size, checksums)
+	return checksums, nil
+}
+
+func (pool *checksumPool) stopped() bool {
+	select {
+	case <-pool.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pool *checksumPool) record(job checksumJob, checksums resourceChecksums, err error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	if err != nil && pool.skip != nil && pool.skip(job.path, err) {
+		pool.skipped[job.index] = err
+		return
+	}
+
+	if err != nil {
+		if pool.err == nil {
+			pool.err = err
+			close(pool.done)
+		}
+		return
+	}
+	pool.checksums[job.index] = checksums
+}
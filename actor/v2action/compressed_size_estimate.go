@@ -0,0 +1,117 @@
+package v2action
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// zipLocalHeaderSize, zipCentralHeaderSize and zipEndRecordSize are the
+	// fixed sizes of a zip's local file headers, central directory headers
+	// and end of central directory record.
+	zipLocalHeaderSize   = 30
+	zipCentralHeaderSize = 46
+	zipEndRecordSize     = 22
+
+	// zipDataDescriptorSize is the size of the data descriptor following
+	// each file's contents.
+	zipDataDescriptorSize = 16
+
+	// zipModTimeExtraSize is the size of the extended timestamp stored in
+	// both headers of every entry.
+	zipModTimeExtraSize = 9
+)
+
+// EstimateCompressedSize returns the size of the zip ZipDirectoryResources
+// would create for files without writing it to disk. By default every file
+// is compressed and the size is exact. When the actor's
+// EstimateSampleRate is between 0 and 1, only that fraction of the files is
+// compressed and their compression ratio is applied to the rest, trading
+// accuracy for speed. Sampled files are not checked against their SHA1.
+func (actor Actor) EstimateCompressedSize(sourceDir string, files []Resource) (int64, error) {
+	if actor.EstimateSampleRate <= 0 || actor.EstimateSampleRate >= 1 {
+		counter := new(countingWriter)
+		_, err := actor.writeDirectoryZip(context.Background(), counter, sourceDir, files, zipOptions{})
+		return counter.count, err
+	}
+
+	files = sortResources(files)
+	step := int(math.Ceil(1 / actor.EstimateSampleRate))
+
+	var (
+		totalSize, sampledSize, compressedSize int64
+		fileIndex                              int
+	)
+	for _, resource := range files {
+		if isDirectoryResource(resource) {
+			continue
+		}
+
+		totalSize += resource.Size
+		if fileIndex%step == 0 {
+			uncompressed, compressed, err := actor.compressFile(sourceDir, resource)
+			if err != nil {
+				return 0, err
+			}
+			sampledSize += uncompressed
+			compressedSize += compressed
+		}
+		fileIndex++
+	}
+
+	estimate := totalSize
+	if sampledSize > 0 {
+		estimate = int64(math.Round(float64(totalSize) * float64(compressedSize) / float64(sampledSize)))
+	}
+	return estimate + actor.zipOverhead(files), nil
+}
+
+// compressFile compresses the resource's file with the actor's zip settings
+// and returns its uncompressed and compressed sizes.
+func (actor Actor) compressFile(sourceDir string, resource Resource) (int64, int64, error) {
+	file, err := actor.openFile(context.Background(), filepath.Join(sourceDir, resource.Filename))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	content, err := actor.compressContent(file, actor.zipMethod())
+	if err != nil {
+		return 0, 0, err
+	}
+	return int64(content.uncompressedSize), int64(len(content.data)), nil
+}
+
+// zipOverhead returns the number of bytes a zip of resources spends on
+// headers rather than file contents, ignoring the zip64 records needed for
+// very large files.
+func (actor Actor) zipOverhead(resources []Resource) int64 {
+	overhead := int64(zipEndRecordSize)
+	for _, resource := range resources {
+		name := resource.Filename
+		if isDirectoryResource(resource) && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+
+		overhead += zipLocalHeaderSize + zipCentralHeaderSize + 2*int64(len(name)) + 2*zipModTimeExtraSize
+		if actor.ZipOwner != nil {
+			overhead += 2 * zipUnixExtraSize
+		}
+		if !isDirectoryResource(resource) {
+			overhead += zipDataDescriptorSize
+		}
+	}
+	return overhead
+}
+
+// countingWriter discards everything written to it, counting the bytes.
+type countingWriter struct {
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.count += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,122 @@
+package v2action_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Compressed Size Estimate Actions", func() {
+	var (
+		actor     *Actor
+		srcDir    string
+		resources []Resource
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		srcDir, err = ioutil.TempDir("", "v2-compressed-size-estimate")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(srcDir, "level1"), 0777)).To(Succeed())
+		for name, contents := range map[string]string{
+			"level1/tmpFile1": strings.Repeat("why hello ", 500),
+			"tmpFile2":        strings.Repeat("Hello, Binky ", 400),
+			"tmpFile3":        strings.Repeat("Bananarama ", 300),
+			"tmpFile4":        strings.Repeat("Bananarama! ", 200),
+		} {
+			Expect(ioutil.WriteFile(filepath.Join(srcDir, name), []byte(contents), 0644)).To(Succeed())
+		}
+
+		resources, err = actor.GatherDirectoryResources(srcDir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(srcDir)).To(Succeed())
+	})
+
+	zipSize := func() int64 {
+		zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+		Expect(err).ToNot(HaveOccurred())
+		defer os.Remove(zipPath)
+
+		info, err := os.Stat(zipPath)
+		Expect(err).ToNot(HaveOccurred())
+		return info.Size()
+	}
+
+	Describe("EstimateCompressedSize", func() {
+		It("returns the exact size of the zip", func() {
+			estimate, err := actor.EstimateCompressedSize(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(estimate).To(Equal(zipSize()))
+		})
+
+		It("does not create a zip file", func() {
+			actor.ZipTempDir, _ = ioutil.TempDir("", "v2-compressed-size-estimate-zips")
+			defer os.RemoveAll(actor.ZipTempDir)
+
+			_, err := actor.EstimateCompressedSize(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ioutil.ReadDir(actor.ZipTempDir)).To(BeEmpty())
+		})
+
+		Context("when EstimateSampleRate is set", func() {
+			BeforeEach(func() {
+				actor.EstimateSampleRate = 0.5
+			})
+
+			It("only compresses the sampled files", func() {
+				var opened []string
+				actor.OpenFile = func(name string) (*os.File, error) {
+					opened = append(opened, name)
+					return os.Open(name)
+				}
+
+				_, err := actor.EstimateCompressedSize(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(opened).To(Equal([]string{
+					filepath.Join(srcDir, "level1", "tmpFile1"),
+					filepath.Join(srcDir, "tmpFile3"),
+				}))
+			})
+
+			It("estimates the size of the zip", func() {
+				estimate, err := actor.EstimateCompressedSize(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(estimate).To(BeNumerically("~", zipSize(), zipSize()/2))
+			})
+
+			Context("when files are stored uncompressed", func() {
+				BeforeEach(func() {
+					actor.ZipStoreUncompressed = true
+				})
+
+				It("returns the exact size of the zip", func() {
+					estimate, err := actor.EstimateCompressedSize(srcDir, resources)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(estimate).To(Equal(zipSize()))
+				})
+			})
+		})
+
+		Context("when a file is missing", func() {
+			BeforeEach(func() {
+				Expect(os.Remove(filepath.Join(srcDir, "tmpFile2"))).To(Succeed())
+			})
+
+			It("returns the error", func() {
+				_, err := actor.EstimateCompressedSize(srcDir, resources)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+})
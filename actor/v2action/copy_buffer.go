@@ -0,0 +1,28 @@
+package v2action
+
+import (
+	"io"
+	"sync"
+)
+
+// copyBuffers holds the buffers used by Actor.copy so that they are reused
+// across files instead of being allocated for every copy.
+var copyBuffers sync.Pool
+
+// copy copies src to dst like io.Copy, reading with a buffer of
+// CopyBufferSize bytes when it is set.
+func (actor Actor) copy(dst io.Writer, src io.Reader) (int64, error) {
+	if actor.CopyBufferSize <= 0 {
+		return io.Copy(dst, src)
+	}
+
+	buffer, ok := copyBuffers.Get().(*[]byte)
+	if !ok || cap(*buffer) < actor.CopyBufferSize {
+		newBuffer := make([]byte, actor.CopyBufferSize)
+		buffer = &newBuffer
+	}
+	defer copyBuffers.Put(buffer)
+
+	// Hide any WriteTo and ReadFrom methods, which would bypass the buffer.
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, (*buffer)[:actor.CopyBufferSize])
+}
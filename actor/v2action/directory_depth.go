@@ -0,0 +1,27 @@
+package v2action
+
+import "fmt"
+
+// DefaultMaxDirectoryDepth is the deepest a file can be nested below the
+// directory being gathered when MaxDirectoryDepth is not set. It is far
+// deeper than any real application needs, but stops a gather that is
+// following a file system loop, such as a bind mount of a parent directory.
+const DefaultMaxDirectoryDepth = 256
+
+// PathTooDeepError is returned when a file being gathered is nested more
+// directories deep than the actor's MaxDirectoryDepth.
+type PathTooDeepError struct {
+	Path  string
+	Limit int
+}
+
+func (e PathTooDeepError) Error() string {
+	return fmt.Sprintf("'%s' is nested more than %d directories deep", e.Path, e.Limit)
+}
+
+func (actor Actor) maxDirectoryDepth() int {
+	if actor.MaxDirectoryDepth <= 0 {
+		return DefaultMaxDirectoryDepth
+	}
+	return actor.MaxDirectoryDepth
+}
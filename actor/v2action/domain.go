@@ -1,6 +1,8 @@
 package v2action
 
 import (
+	"sync"
+
 	"code.cloudfoundry.org/cli/api/cloudcontroller/ccerror"
 	"code.cloudfoundry.org/cli/api/cloudcontroller/ccv2"
 
@@ -119,13 +121,34 @@ func (actor Actor) GetOrganizationDomains(orgGUID string) ([]Domain, Warnings, e
 	return allDomains, allWarnings, nil
 }
 
+// domainCache holds the domains fetched by an actor, keyed by GUID. It is
+// shared by every copy of the actor, so it is safe for concurrent use.
+type domainCache struct {
+	mutex   sync.RWMutex
+	domains map[string]Domain
+}
+
+func newDomainCache() *domainCache {
+	return &domainCache{domains: map[string]Domain{}}
+}
+
 func (actor Actor) saveDomain(domain ccv2.Domain) {
-	if domain.GUID != "" {
-		actor.domainCache[domain.GUID] = Domain(domain)
+	if domain.GUID == "" || actor.domainCache == nil {
+		return
 	}
+
+	actor.domainCache.mutex.Lock()
+	defer actor.domainCache.mutex.Unlock()
+	actor.domainCache.domains[domain.GUID] = Domain(domain)
 }
 
 func (actor Actor) loadDomain(domainGUID string) (Domain, bool) {
-	domain, found := actor.domainCache[domainGUID]
+	if actor.domainCache == nil {
+		return Domain{}, false
+	}
+
+	actor.domainCache.mutex.RLock()
+	defer actor.domainCache.mutex.RUnlock()
+	domain, found := actor.domainCache.domains[domainGUID]
 	return domain, found
 }
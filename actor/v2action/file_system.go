@@ -0,0 +1,98 @@
+package v2action
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// fileSystem is the file system directory resources are gathered and zipped
+// from. Names are paths in the operating system's format, as built by
+// filepath.Join.
+type fileSystem interface {
+	Open(ctx context.Context, name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// osFileSystem is the operating system's file system. Files are opened with
+// the actor's OpenFile and retried after transient failures.
+type osFileSystem struct {
+	actor Actor
+}
+
+func (fsys osFileSystem) Open(ctx context.Context, name string) (fs.File, error) {
+	file, err := fsys.actor.openFile(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
+// ioFileSystem reads from an fs.FS, converting names to and from the slash
+// separated paths it uses.
+type ioFileSystem struct {
+	fsys fs.FS
+}
+
+func (fsys ioFileSystem) Open(_ context.Context, name string) (fs.File, error) {
+	return fsys.fsys.Open(ioName(name))
+}
+
+func (fsys ioFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(fsys.fsys, ioName(name))
+}
+
+func (fsys ioFileSystem) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return fs.WalkDir(fsys.fsys, ioName(root), func(name string, entry fs.DirEntry, err error) error {
+		return fn(filepath.FromSlash(name), entry, err)
+	})
+}
+
+// ioName returns the fs.FS name of the file at path.
+func ioName(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// sourceFileSystem returns fsys, or the operating system's file system if
+// fsys is nil.
+func (actor Actor) sourceFileSystem(fsys fileSystem) fileSystem {
+	if fsys == nil {
+		return osFileSystem{actor: actor}
+	}
+	return fsys
+}
+
+// GatherDirectoryResourcesWithFS behaves like GatherDirectoryResources, but
+// gathers sourceDir from fsys, such as an embed.FS, instead of the operating
+// system's file system. sourceDir is a slash separated path within fsys; "."
+// gathers all of fsys. The .cfignore file is read from fsys too. Symlinks
+// are not supported and return an UnsupportedFileTypeError. OpenFile,
+// ChecksumCacheDir and SkipVanishedFiles are ignored.
+func (actor Actor) GatherDirectoryResourcesWithFS(fsys fs.FS, sourceDir string) ([]Resource, error) {
+	ignorePatterns, err := readCFIgnoreFS(fsys, sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := actor.gatherDirectoryResources(context.Background(), filepath.FromSlash(path.Clean(sourceDir)), ignorePatterns, gatherOptions{fileSystem: ioFileSystem{fsys: fsys}})
+	return report.Resources, err
+}
+
+// ZipDirectoryResourcesWithFS behaves like ZipDirectoryResources, but reads
+// the files from sourceDir in fsys, a slash separated path as for
+// GatherDirectoryResourcesWithFS. OpenFile and PreserveSymlinks are ignored.
+func (actor Actor) ZipDirectoryResourcesWithFS(fsys fs.FS, sourceDir string, filesToInclude []Resource) (string, error) {
+	zipPath, _, err := actor.zipDirectoryResources(context.Background(), filepath.FromSlash(path.Clean(sourceDir)), filesToInclude, zipOptions{fileSystem: ioFileSystem{fsys: fsys}})
+	return zipPath, err
+}
@@ -0,0 +1,223 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing/fstest"
+	"time"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File System Actions", func() {
+	var (
+		actor *Actor
+		fsys  fstest.MapFS
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+		fsys = fstest.MapFS{
+			"app/level1/level2/tmpFile1": {Data: []byte("why hello"), Mode: 0644},
+			"app/tmpFile2":               {Data: []byte("Hello, Binky"), Mode: 0644},
+			"app/tmpFile3":               {Data: []byte("Bananarama"), Mode: 0644},
+			"other":                      {Data: []byte("not part of the app"), Mode: 0644},
+		}
+	})
+
+	Describe("GatherDirectoryResourcesWithFS", func() {
+		It("gathers the directory from the file system", func() {
+			resources, err := actor.GatherDirectoryResourcesWithFS(fsys, "app")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resourceFilenames(resources)).To(Equal([]string{
+				"level1",
+				"level1/level2",
+				"level1/level2/tmpFile1",
+				"tmpFile2",
+				"tmpFile3",
+			}))
+			Expect(findResource(resources, "level1/level2/tmpFile1").SHA1).To(Equal("9e36efec86d571de3a38389ea799a796fe4782f4"))
+			Expect(findResource(resources, "level1/level2/tmpFile1").Size).To(BeNumerically("==", 9))
+			Expect(findResource(resources, "tmpFile2").SHA1).To(Equal("e594bdc795bb293a0e55724137e53a36dc0d9e95"))
+			Expect(findResource(resources, "tmpFile3").SHA1).To(Equal("f4c9ca85f3e084ffad3abbdabbd2a890c034c879"))
+		})
+
+		It("gathers the whole file system from '.'", func() {
+			resources, err := actor.GatherDirectoryResourcesWithFS(fsys, ".")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resourceFilenames(resources)).To(ContainElement("other"))
+			Expect(resourceFilenames(resources)).To(ContainElement("app/tmpFile2"))
+		})
+
+		It("reads the .cfignore file from the file system", func() {
+			fsys["app/.cfignore"] = &fstest.MapFile{Data: []byte("level1\n.cfignore\n"), Mode: 0644}
+
+			resources, err := actor.GatherDirectoryResourcesWithFS(fsys, "app")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourceFilenames(resources)).To(Equal([]string{"tmpFile2", "tmpFile3"}))
+		})
+
+		It("returns an UnsupportedFileTypeError for symlinks", func() {
+			fsys["app/link"] = &fstest.MapFile{Data: []byte("tmpFile2"), Mode: fs.ModeSymlink | 0777}
+
+			_, err := actor.GatherDirectoryResourcesWithFS(fsys, "app")
+			Expect(err).To(MatchError(UnsupportedFileTypeError{Filename: filepath.FromSlash("app/link"), Mode: fs.ModeSymlink | 0777}))
+		})
+
+		It("returns an error when the directory does not exist", func() {
+			_, err := actor.GatherDirectoryResourcesWithFS(fsys, "missing")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		Context("when reading a file times out", func() {
+			var (
+				release      chan struct{}
+				reportsMutex sync.Mutex
+				reports      []string
+			)
+
+			BeforeEach(func() {
+				release = make(chan struct{})
+				reports = nil
+				actor.FileReadTimeout = 50 * time.Millisecond
+				actor.HashProgressThreshold = 1
+				actor.HashProgress = func(filename string, bytesHashed int64, totalBytes int64) {
+					reportsMutex.Lock()
+					defer reportsMutex.Unlock()
+					reports = append(reports, filename)
+				}
+			})
+
+			AfterEach(func() {
+				close(release)
+			})
+
+			It("stops reporting the file's hashing progress", func() {
+				stalled := stalledFS{MapFS: fsys, name: "app/tmpFile2", release: release}
+				_, err := actor.GatherDirectoryResourcesWithFS(stalled, "app")
+				Expect(err).To(MatchError(FileReadTimeoutError{Filename: filepath.FromSlash("app/tmpFile2")}))
+
+				reportsMutex.Lock()
+				reportedBefore := len(reports)
+				reportsMutex.Unlock()
+
+				release <- struct{}{}
+				Consistently(func() []string {
+					reportsMutex.Lock()
+					defer reportsMutex.Unlock()
+					return reports
+				}, 200*time.Millisecond).Should(HaveLen(reportedBefore))
+			})
+		})
+
+		Context("when the file system is a directory on disk", func() {
+			var srcDir string
+
+			BeforeEach(func() {
+				var err error
+				srcDir, err = ioutil.TempDir("", "v2-file-system")
+				Expect(err).ToNot(HaveOccurred())
+
+				for name, file := range fsys {
+					path := filepath.Join(srcDir, filepath.FromSlash(name))
+					Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+					Expect(ioutil.WriteFile(path, file.Data, 0644)).To(Succeed())
+				}
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(srcDir)).To(Succeed())
+			})
+
+			It("gathers the same resources as GatherDirectoryResources", func() {
+				expected, err := actor.GatherDirectoryResources(filepath.Join(srcDir, "app"))
+				Expect(err).ToNot(HaveOccurred())
+
+				resources, err := actor.GatherDirectoryResourcesWithFS(os.DirFS(srcDir), "app")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(actor.ResourcesEqual(resources, expected)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("ZipDirectoryResourcesWithFS", func() {
+		var resources []Resource
+
+		BeforeEach(func() {
+			var err error
+			resources, err = actor.GatherDirectoryResourcesWithFS(fsys, "app")
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("zips the resources from the file system", func() {
+			zipPath, err := actor.ZipDirectoryResourcesWithFS(fsys, "app", resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			zipFile, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer zipFile.Close()
+
+			Expect(resourceFilenamesFromZip(zipFile.File)).To(Equal([]string{
+				"level1/",
+				"level1/level2/",
+				"level1/level2/tmpFile1",
+				"tmpFile2",
+				"tmpFile3",
+			}))
+			expectFileContentsToEqual(findZipFile(zipFile.File, "level1/level2/tmpFile1"), "why hello")
+			expectFileContentsToEqual(findZipFile(zipFile.File, "tmpFile2"), "Hello, Binky")
+			expectFileContentsToEqual(findZipFile(zipFile.File, "tmpFile3"), "Bananarama")
+		})
+
+		It("returns a FileChangedError when a file changed since it was gathered", func() {
+			fsys["app/tmpFile2"] = &fstest.MapFile{Data: []byte("Hello, Binkx"), Mode: 0644}
+
+			_, err := actor.ZipDirectoryResourcesWithFS(fsys, "app", resources)
+			Expect(err).To(MatchError(FileChangedError{
+				Filename:     filepath.FromSlash("app/tmpFile2"),
+				ExpectedSHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95",
+				ActualSHA1:   "8c3c4d8a6313df08fab52459d6c7ffe8678027cf",
+			}))
+		})
+	})
+})
+
+// stalledFS is a MapFS whose file named name blocks on its first read until
+// release receives, then returns all of its contents along with io.EOF.
+type stalledFS struct {
+	fstest.MapFS
+	name    string
+	release chan struct{}
+}
+
+func (fsys stalledFS) Open(name string) (fs.File, error) {
+	file, err := fsys.MapFS.Open(name)
+	if err != nil || name != fsys.name {
+		return file, err
+	}
+	return &stalledFile{File: file, release: fsys.release}, nil
+}
+
+type stalledFile struct {
+	fs.File
+	release chan struct{}
+}
+
+func (file *stalledFile) Read(p []byte) (int, error) {
+	<-file.release
+	n, err := file.File.Read(p)
+	if err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
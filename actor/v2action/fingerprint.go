@@ -0,0 +1,78 @@
+package v2action
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// DefaultFingerprintSampleSize is the number of bytes read from each end of
+// a file to fingerprint it when FingerprintSampleSize is not set.
+const DefaultFingerprintSampleSize = 64 << 10
+
+// GatherDirectoryResourcesWithFingerprints behaves like
+// GatherDirectoryResourcesMetadataOnly, but sets the Fingerprint of every
+// file, which only requires reading its first and last
+// FingerprintSampleSize bytes. Like metadata only resources, they cannot be
+// matched against the Cloud Controller's resource cache or zipped.
+func (actor Actor) GatherDirectoryResourcesWithFingerprints(sourceDir string) ([]Resource, error) {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := actor.gatherDirectoryResources(context.Background(), sourceDir, ignorePatterns, gatherOptions{metadataOnly: true, fingerprint: true})
+	return report.Resources, err
+}
+
+// fingerprintFile returns the hex encoded SHA1 of the file's size followed by
+// its first and last FingerprintSampleSize bytes, read from fsys. Files no
+// larger than twice the sample size are hashed in full.
+func (actor Actor) fingerprintFile(ctx context.Context, fsys fileSystem, path string, size int64) (string, error) {
+	file, err := fsys.Open(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha1.New()
+	if err := binary.Write(hash, binary.BigEndian, size); err != nil {
+		return "", err
+	}
+
+	sampleSize := actor.fingerprintSampleSize()
+	if size <= 2*sampleSize {
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+	} else if readerAt, ok := file.(io.ReaderAt); ok {
+		if _, err := io.Copy(hash, io.NewSectionReader(readerAt, 0, sampleSize)); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(hash, io.NewSectionReader(readerAt, size-sampleSize, sampleSize)); err != nil {
+			return "", err
+		}
+	} else {
+		// the middle of the file has to be read to reach its end
+		if _, err := io.CopyN(hash, file, sampleSize); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(ioutil.Discard, file, size-2*sampleSize); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(hash, file, sampleSize); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func (actor Actor) fingerprintSampleSize() int64 {
+	if actor.FingerprintSampleSize <= 0 {
+		return DefaultFingerprintSampleSize
+	}
+	return actor.FingerprintSampleSize
+}
@@ -0,0 +1,139 @@
+package v2action_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fingerprint Actions", func() {
+	var (
+		actor  *Actor
+		srcDir string
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+		actor.FingerprintSampleSize = 4
+
+		var err error
+		srcDir, err = ioutil.TempDir("", "v2-fingerprint")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(srcDir, "level1"), 0777)).To(Succeed())
+		for name, contents := range map[string]string{
+			"level1/tmpFile1": "why hello",
+			"tmpFile2":        "Hello, Binky",
+			"tmpFile3":        "Bananarama",
+			"small":           "Hi",
+		} {
+			Expect(ioutil.WriteFile(filepath.Join(srcDir, name), []byte(contents), 0644)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(srcDir)).To(Succeed())
+	})
+
+	fingerprints := func() map[string]string {
+		resources, err := actor.GatherDirectoryResourcesWithFingerprints(srcDir)
+		Expect(err).ToNot(HaveOccurred())
+
+		fingerprints := map[string]string{}
+		for _, resource := range resources {
+			fingerprints[resource.Filename] = resource.Fingerprint
+		}
+		return fingerprints
+	}
+
+	writeFile := func(name string, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(srcDir, name), []byte(contents), 0644)).To(Succeed())
+	}
+
+	Describe("GatherDirectoryResourcesWithFingerprints", func() {
+		It("fingerprints files, without hashing them in full", func() {
+			resources, err := actor.GatherDirectoryResourcesWithFingerprints(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/tmpFile1", "small", "tmpFile2", "tmpFile3"}))
+			for _, resource := range resources {
+				Expect(resource.SHA1).To(BeEmpty())
+				if resource.Filename == "level1" {
+					Expect(resource.Fingerprint).To(BeEmpty())
+				} else {
+					Expect(resource.Fingerprint).To(MatchRegexp("^[0-9a-f]{40}$"))
+				}
+			}
+		})
+
+		It("returns the same fingerprints for unchanged files", func() {
+			Expect(fingerprints()).To(Equal(fingerprints()))
+		})
+
+		It("returns the same fingerprint for files with the same contents", func() {
+			writeFile("copy", "Hello, Binky")
+			Expect(fingerprints()["copy"]).To(Equal(fingerprints()["tmpFile2"]))
+		})
+
+		It("does not leave fingerprints on other resources", func() {
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			for _, resource := range resources {
+				Expect(resource.Fingerprint).To(BeEmpty())
+			}
+		})
+
+		DescribeTable("changing a file",
+			func(name string, contents string, changed bool) {
+				before := fingerprints()[name]
+				writeFile(name, contents)
+				if changed {
+					Expect(fingerprints()[name]).ToNot(Equal(before))
+				} else {
+					Expect(fingerprints()[name]).To(Equal(before))
+				}
+			},
+
+			Entry("changes the fingerprint when the start changes", "tmpFile2", "Jello, Binky", true),
+			Entry("changes the fingerprint when the end changes", "tmpFile2", "Hello, Binkz", true),
+			Entry("changes the fingerprint when the size changes", "tmpFile2", "Hello,  Binky", true),
+			Entry("changes the fingerprint of a file no larger than two samples when any byte changes", "small", "Ho", true),
+			Entry("keeps the fingerprint when only the middle of the file changes", "tmpFile2", "Hello! Binky", false),
+		)
+
+		Context("when FingerprintSampleSize is not set", func() {
+			BeforeEach(func() {
+				actor.FingerprintSampleSize = 0
+			})
+
+			It("samples DefaultFingerprintSampleSize bytes from each end", func() {
+				contents := strings.Repeat("a", 2*DefaultFingerprintSampleSize+1)
+				writeFile("large", contents)
+				before := fingerprints()["large"]
+
+				writeFile("large", contents[:DefaultFingerprintSampleSize]+"b"+contents[DefaultFingerprintSampleSize+1:])
+				Expect(fingerprints()["large"]).To(Equal(before))
+
+				writeFile("large", "b"+contents[1:])
+				Expect(fingerprints()["large"]).ToNot(Equal(before))
+			})
+		})
+
+		Context("when a file cannot be opened", func() {
+			It("returns the error", func() {
+				actor.OpenFile = func(name string) (*os.File, error) {
+					return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+				}
+
+				_, err := actor.GatherDirectoryResourcesWithFingerprints(srcDir)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+})
@@ -0,0 +1,38 @@
+package v2action
+
+// fileID identifies a file by the device and inode it is stored in, which
+// hard links to the same file share.
+type fileID struct {
+	device uint64
+	inode  uint64
+}
+
+// groupHardLinks returns the Filenames of the resources that are hard links
+// to the same file, given the fileID recorded for each linked Filename. Each
+// group keeps the order of resources.
+func groupHardLinks(resources []Resource, ids map[string]fileID) [][]string {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var order []fileID
+	filenamesByID := map[fileID][]string{}
+	for _, resource := range resources {
+		id, ok := ids[resource.Filename]
+		if !ok {
+			continue
+		}
+		if _, seen := filenamesByID[id]; !seen {
+			order = append(order, id)
+		}
+		filenamesByID[id] = append(filenamesByID[id], resource.Filename)
+	}
+
+	var groups [][]string
+	for _, id := range order {
+		if len(filenamesByID[id]) > 1 {
+			groups = append(groups, filenamesByID[id])
+		}
+	}
+	return groups
+}
@@ -0,0 +1,18 @@
+// +build !windows
+
+package v2action
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardLinkID returns the fileID of the file described by info if it has more
+// than one hard link.
+func hardLinkID(info os.FileInfo) (fileID, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{device: uint64(stat.Dev), inode: uint64(stat.Ino)}, true
+}
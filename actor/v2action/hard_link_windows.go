@@ -0,0 +1,11 @@
+// +build windows
+
+package v2action
+
+import "os"
+
+// hardLinkID always returns false on Windows, where the file information
+// returned while walking a directory does not include the file's index.
+func hardLinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,81 @@
+package v2action
+
+import (
+	"io"
+	"io/fs"
+	"sync/atomic"
+)
+
+// DefaultHashProgressThreshold is the size, in bytes, from which files report
+// their hashing progress when the actor's HashProgressThreshold is not set.
+const DefaultHashProgressThreshold = 64 << 20
+
+// hashProgressInterval is the number of bytes hashed between two reports of
+// a file's hashing progress.
+const hashProgressInterval = 4 << 20
+
+// HashProgressFunc is called periodically while a large file is being
+// hashed, and once more when it has been hashed in full. bytesHashed is the
+// number of bytes of the file hashed so far and totalBytes its size. Files
+// are hashed by HashWorkers workers, so it may be called concurrently for
+// different files. Once hashing a file has timed out after the actor's
+// FileReadTimeout, or its context has been cancelled, no new calls are made
+// for it, even if a stalled read of it later returns.
+type HashProgressFunc func(filename string, bytesHashed int64, totalBytes int64)
+
+// hashProgressReader reports the progress of hashing the file it reads.
+type hashProgressReader struct {
+	reader   io.Reader
+	filename string
+	total    int64
+	hashed   int64
+	reported int64
+	progress HashProgressFunc
+
+	// stopped is set once the file's hashing has been abandoned, and is
+	// checked before each report since the abandoned read may still return.
+	stopped int32
+}
+
+func (r *hashProgressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hashed += int64(n)
+	if r.hashed-r.reported >= hashProgressInterval || err == io.EOF && r.hashed != r.reported {
+		r.reported = r.hashed
+		if atomic.LoadInt32(&r.stopped) == 0 {
+			r.progress(r.filename, r.hashed, r.total)
+		}
+	}
+	return n, err
+}
+
+// stopHashProgress stops file, when it reports its hashing progress, from
+// calling HashProgress again.
+func stopHashProgress(file io.Reader) {
+	if r, ok := file.(*hashProgressReader); ok {
+		atomic.StoreInt32(&r.stopped, 1)
+	}
+}
+
+// hashProgress returns a reader of file, opened from path, that reports the
+// progress of hashing it to the actor's HashProgress if the file is at least
+// HashProgressThreshold bytes.
+func (actor Actor) hashProgress(path string, file fs.File) (io.Reader, error) {
+	if actor.HashProgress == nil {
+		return file, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := actor.HashProgressThreshold
+	if threshold <= 0 {
+		threshold = DefaultHashProgressThreshold
+	}
+	if info.Size() < threshold {
+		return file, nil
+	}
+	return &hashProgressReader{reader: file, filename: path, total: info.Size(), progress: actor.HashProgress}, nil
+}
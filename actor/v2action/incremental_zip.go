@@ -0,0 +1,87 @@
+package v2action
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IncrementalZip is the result of zipping only the resources that changed
+// since a previous push.
+type IncrementalZip struct {
+	// Path is the location of the zip, which only contains the added and
+	// modified resources, along with those whose Mode changed.
+	Path string
+
+	// Diff is the delta between the previous and current resources.
+	Diff ResourceDiff
+
+	// Resources lists every current resource with its checksums, to be
+	// persisted as the manifest for the next incremental zip.
+	Resources []Resource
+}
+
+// ZipChangedResources compares the resources gathered from sourceDir during
+// a previous push, typically read back with UnmarshalResources, with the
+// current ones returned by GatherDirectoryResourcesMetadataOnly. Files that
+// are new, whose size differs, or that were modified after since, the time
+// the previous resources were gathered, are hashed; every other file keeps
+// its previous checksums. Only the resources that actually changed are
+// zipped. On success the caller is responsible for removing the zip file.
+func (actor Actor) ZipChangedResources(sourceDir string, previous []Resource, since time.Time, current []Resource) (IncrementalZip, error) {
+	previousByFilename := resourcesByFilename(previous)
+
+	resources := make([]Resource, 0, len(current))
+	for _, resource := range uniqueSortedResources(current) {
+		if !isDirectoryResource(resource) {
+			path := filepath.Join(sourceDir, filepath.FromSlash(resource.Filename))
+			previousResource, ok := previousByFilename[resource.Filename]
+
+			changed, err := resourceChangedSince(path, resource, previousResource, ok, since)
+			if err != nil {
+				return IncrementalZip{}, err
+			}
+
+			checksums := resourceChecksums{sha1: previousResource.SHA1, sha256: previousResource.SHA256, contentType: previousResource.ContentType}
+			if changed {
+				actor.logger().WithField("path", path).Debug("hashing changed file")
+				checksums, err = actor.computeChecksum(context.Background(), osFileSystem{actor: actor}, path)
+				if err != nil {
+					return IncrementalZip{}, err
+				}
+			}
+			resource.SHA1 = checksums.sha1
+			resource.SHA256 = checksums.sha256
+			resource.ContentType = checksums.contentType
+		}
+		resources = append(resources, resource)
+	}
+
+	diff := actor.DiffResources(previous, resources)
+	var filesToZip []Resource
+	filesToZip = append(filesToZip, diff.Added...)
+	filesToZip = append(filesToZip, diff.Modified...)
+	filesToZip = append(filesToZip, diff.ModeChanged...)
+
+	zipPath, err := actor.ZipDirectoryResources(sourceDir, filesToZip)
+	if err != nil {
+		return IncrementalZip{}, err
+	}
+	return IncrementalZip{Path: zipPath, Diff: diff, Resources: resources}, nil
+}
+
+// resourceChangedSince returns true if the file at path, described by
+// resource, may differ from previous: it was not previously gathered, its
+// size changed, or it was modified after since.
+func resourceChangedSince(path string, resource Resource, previous Resource, wasGathered bool, since time.Time) (bool, error) {
+	if !wasGathered || previous.SHA1 == "" || previous.Size != resource.Size {
+		return true, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return info.ModTime().After(since), nil
+}
@@ -0,0 +1,136 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Incremental Zip Actions", func() {
+	var (
+		actor    *Actor
+		srcDir   string
+		previous []Resource
+		since    time.Time
+	)
+
+	writeFile := func(filename string, contents string, modTime time.Time) {
+		path := filepath.Join(srcDir, filename)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).To(Succeed())
+		Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		srcDir, err = ioutil.TempDir("", "v2-incremental-zip")
+		Expect(err).ToNot(HaveOccurred())
+
+		since = time.Now().Add(-time.Hour)
+		before := since.Add(-time.Hour)
+		Expect(os.Mkdir(filepath.Join(srcDir, "level1"), 0755)).To(Succeed())
+		writeFile("level1/tmpFile1", "why hello", before)
+		writeFile("tmpFile2", "Hello, Binky", before)
+		writeFile("tmpFile3", "Bananarama", before)
+		writeFile("touched", "unchanged", before)
+
+		previous, err = actor.GatherDirectoryResources(srcDir)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(srcDir)).To(Succeed())
+	})
+
+	Describe("ZipChangedResources", func() {
+		var (
+			incremental IncrementalZip
+			executeErr  error
+		)
+
+		JustBeforeEach(func() {
+			current, err := actor.GatherDirectoryResourcesMetadataOnly(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			incremental, executeErr = actor.ZipChangedResources(srcDir, previous, since, current)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(incremental.Path)).To(Succeed())
+		})
+
+		Context("when files have been added, removed and changed", func() {
+			BeforeEach(func() {
+				now := time.Now()
+				writeFile("tmpFile2", "Hello, Blinky", now)
+				writeFile("level1/tmpFile4", "so new", now)
+				writeFile("touched", "unchanged", now)
+				Expect(os.Remove(filepath.Join(srcDir, "tmpFile3"))).To(Succeed())
+			})
+
+			It("only zips the changed files", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(incremental.Path)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/tmpFile4", "tmpFile2"}))
+				expectFileContentsToEqual(reader.File[0], "so new")
+				expectFileContentsToEqual(reader.File[1], "Hello, Blinky")
+			})
+
+			It("returns the delta from the previous resources", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				Expect(resourceFilenames(incremental.Diff.Added)).To(Equal([]string{"level1/tmpFile4"}))
+				Expect(resourceFilenames(incremental.Diff.Modified)).To(Equal([]string{"tmpFile2"}))
+				Expect(resourceFilenames(incremental.Diff.Removed)).To(Equal([]string{"tmpFile3"}))
+				Expect(incremental.Diff.ModeChanged).To(BeEmpty())
+			})
+
+			It("returns the current resources with their checksums", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(incremental.Resources).To(Equal(resources))
+			})
+		})
+
+		Context("when a file's mode has changed", func() {
+			BeforeEach(func() {
+				Expect(os.Chmod(filepath.Join(srcDir, "tmpFile3"), 0755)).To(Succeed())
+			})
+
+			It("zips the file", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(incremental.Diff.ModeChanged)).To(Equal([]string{"tmpFile3"}))
+
+				reader, err := zip.OpenReader(incremental.Path)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"tmpFile3"}))
+			})
+		})
+
+		Context("when a changed file's size is unchanged but its modification time is older", func() {
+			BeforeEach(func() {
+				writeFile("tmpFile3", "Bananafana", since.Add(-time.Minute))
+			})
+
+			It("keeps the previous checksums without reading the file", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(incremental.Diff.Modified).To(BeEmpty())
+				Expect(findResource(incremental.Resources, "tmpFile3").SHA1).To(Equal("f4c9ca85f3e084ffad3abbdabbd2a890c034c879"))
+			})
+		})
+	})
+})
@@ -14,6 +14,6 @@ func (actor Actor) PollJob(job Job) (Warnings, error) {
 }
 
 func (actor Actor) UploadApplicationPackage(appGUID string, existingResources []Resource, newResources io.Reader, newResourcesLength int64) (Job, Warnings, error) {
-	job, warnings, err := actor.CloudControllerClient.UploadApplicationPackage(appGUID, actor.actorToCCResources(existingResources), newResources, newResourcesLength)
+	job, warnings, err := actor.CloudControllerClient.UploadApplicationPackage(appGUID, actor.ResourcesToCCResources(existingResources), newResources, newResourcesLength)
 	return Job(job), Warnings(warnings), err
 }
@@ -0,0 +1,41 @@
+package v2action
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MissingResourcesError is returned when resources being validated do not
+// exist in SourceDir. Filenames lists every missing resource, sorted.
+type MissingResourcesError struct {
+	SourceDir string
+	Filenames []string
+}
+
+func (e MissingResourcesError) Error() string {
+	return fmt.Sprintf("Files missing from %s: %s", e.SourceDir, strings.Join(e.Filenames, ", "))
+}
+
+// ValidateResourcesExist stats every file in sourceDir up front and returns a
+// MissingResourcesError listing all of the files that do not exist. Zipping
+// opens each file in turn and fails on the first missing one, so this allows
+// every missing file to be reported at once before any zip is written. Other
+// errors are returned as soon as they are encountered.
+func (_ Actor) ValidateResourcesExist(sourceDir string, files []Resource) error {
+	var missing []string
+	for _, resource := range uniqueSortedResources(files) {
+		_, err := os.Stat(filepath.Join(sourceDir, resource.Filename))
+		if os.IsNotExist(err) {
+			missing = append(missing, resource.Filename)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		return MissingResourcesError{SourceDir: sourceDir, Filenames: missing}
+	}
+	return nil
+}
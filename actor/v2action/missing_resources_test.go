@@ -0,0 +1,61 @@
+package v2action_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Missing Resources Actions", func() {
+	var (
+		actor  *Actor
+		srcDir string
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		srcDir, err = ioutil.TempDir("", "v2-missing-resources")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.Mkdir(filepath.Join(srcDir, "level1"), 0777)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(srcDir, "level1", "tmpFile1"), []byte("why hello"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(srcDir, "tmpFile2"), []byte("Hello, Binky"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(srcDir)).To(Succeed())
+	})
+
+	Describe("ValidateResourcesExist", func() {
+		It("returns nil when every resource exists", func() {
+			err := actor.ValidateResourcesExist(srcDir, []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("returns a MissingResourcesError listing every missing resource", func() {
+			err := actor.ValidateResourcesExist(srcDir, []Resource{
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				{Filename: "level2/tmpFile4"},
+				{Filename: "level1/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9},
+				{Filename: "tmpFile3"},
+				{Filename: "level2"},
+				{Filename: "tmpFile3"},
+			})
+			Expect(err).To(MatchError(MissingResourcesError{
+				SourceDir: srcDir,
+				Filenames: []string{"level2", "level2/tmpFile4", "tmpFile3"},
+			}))
+			Expect(err.Error()).To(Equal("Files missing from " + srcDir + ": level2, level2/tmpFile4, tmpFile3"))
+		})
+	})
+})
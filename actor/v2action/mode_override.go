@@ -0,0 +1,27 @@
+package v2action
+
+import (
+	"os"
+	"strings"
+)
+
+// ModeOverride sets the permissions of every archive file whose filename
+// matches Pattern. Pattern is matched segment by segment like a .cfignore
+// pattern, so "bin/*" matches "bin/start" and "**" matches any number of
+// directories.
+type ModeOverride struct {
+	Pattern string
+	Mode    os.FileMode
+}
+
+// overrideMode returns mode with its permissions replaced by those of the
+// last ModeOverride matching filename.
+func (actor Actor) overrideMode(filename string, mode os.FileMode) os.FileMode {
+	segments := strings.Split(strings.Trim(filename, "/"), "/")
+	for _, override := range actor.ModeOverrides {
+		if matchSegments(strings.Split(strings.Trim(override.Pattern, "/"), "/"), segments) {
+			mode = mode&^os.ModePerm | override.Mode&os.ModePerm
+		}
+	}
+	return mode
+}
@@ -0,0 +1,95 @@
+package v2action
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ResourceCollisionError is returned when more than one of the directories
+// being merged contains a file with the same Filename, or one contains a
+// file where another contains a directory.
+type ResourceCollisionError struct {
+	Filename   string
+	SourceDirs []string
+}
+
+func (e ResourceCollisionError) Error() string {
+	return fmt.Sprintf("%s exists in more than one source directory: %s", e.Filename, strings.Join(e.SourceDirs, ", "))
+}
+
+// ResourceSourceDirNotFoundError is returned when zipping a resource whose
+// SourceDir is not one of the directories being zipped, such as a resource
+// that was not gathered by GatherMultipleDirectoryResources.
+type ResourceSourceDirNotFoundError struct {
+	Filename  string
+	SourceDir string
+}
+
+func (e ResourceSourceDirNotFoundError) Error() string {
+	if e.SourceDir == "" {
+		return fmt.Sprintf("%s was not gathered from any source directory", e.Filename)
+	}
+	return fmt.Sprintf("%s was gathered from %s, which is not a source directory", e.Filename, e.SourceDir)
+}
+
+// GatherMultipleDirectoryResources gathers each of sourceDirs like
+// GatherDirectoryResources, honoring each directory's own .cfignore, and
+// merges the results into one list sorted by Filename. Each resource's
+// SourceDir is set to the directory it was gathered from. Directories
+// present in several sourceDirs are merged, and only the first of several
+// .cfignore files is kept; any other shared Filename returns a
+// ResourceCollisionError.
+func (actor Actor) GatherMultipleDirectoryResources(sourceDirs []string) ([]Resource, error) {
+	var merged []Resource
+	gathered := map[string]Resource{}
+	for _, sourceDir := range sourceDirs {
+		resources, err := actor.GatherDirectoryResources(sourceDir)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, resource := range resources {
+			resource.SourceDir = sourceDir
+			first, exists := gathered[resource.Filename]
+			if !exists {
+				gathered[resource.Filename] = resource
+				merged = append(merged, resource)
+				continue
+			}
+
+			if resource.Filename == ".cfignore" {
+				continue
+			}
+			if !isDirectoryResource(resource) || !isDirectoryResource(first) {
+				return nil, ResourceCollisionError{Filename: resource.Filename, SourceDirs: []string{first.SourceDir, sourceDir}}
+			}
+		}
+	}
+
+	return sortResources(merged), nil
+}
+
+// ZipMultipleDirectoryResources zips resources gathered by
+// GatherMultipleDirectoryResources from sourceDirs and returns the location.
+// Each resource is zipped from its SourceDir, which must be one of
+// sourceDirs. Like ZipDirectoryResources, the caller is responsible for
+// removing the zip file on success.
+func (actor Actor) ZipMultipleDirectoryResources(sourceDirs []string, filesToInclude []Resource) (string, error) {
+	known := make(map[string]bool, len(sourceDirs))
+	for _, sourceDir := range sourceDirs {
+		known[sourceDir] = true
+	}
+
+	resourceDirs := make(map[string]string, len(filesToInclude))
+	for _, resource := range filesToInclude {
+		if !known[resource.SourceDir] {
+			return "", ResourceSourceDirNotFoundError{Filename: resource.Filename, SourceDir: resource.SourceDir}
+		}
+		resourceDirs[resource.Filename] = resource.SourceDir
+	}
+
+	actor.logger().WithField("sourceDirs", sourceDirs).Info("zipping source files")
+	zipPath, _, err := actor.zipDirectoryResources(context.Background(), "", filesToInclude, zipOptions{sourceDirs: resourceDirs})
+	return zipPath, err
+}
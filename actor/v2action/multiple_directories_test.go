@@ -0,0 +1,173 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multiple Directory Actions", func() {
+	var (
+		actor     *Actor
+		staticDir string
+		serverDir string
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		staticDir, err = ioutil.TempDir("", "static")
+		Expect(err).ToNot(HaveOccurred())
+		serverDir, err = ioutil.TempDir("", "server")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.MkdirAll(filepath.Join(staticDir, "public", "css"), 0777)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(staticDir, "public", "css", "app.css"), []byte("body {}"), 0600)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(serverDir, "public"), 0777)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(serverDir, "public", "index.html"), []byte("<html>"), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(serverDir, "server.js"), []byte("listen()"), 0600)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(staticDir)).To(Succeed())
+		Expect(os.RemoveAll(serverDir)).To(Succeed())
+	})
+
+	Describe("GatherMultipleDirectoryResources", func() {
+		It("merges the resources of every directory, sorted by filename", func() {
+			resources, err := actor.GatherMultipleDirectoryResources([]string{staticDir, serverDir})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourceFilenames(resources)).To(Equal([]string{
+				"public",
+				"public/css",
+				"public/css/app.css",
+				"public/index.html",
+				"server.js",
+			}))
+			Expect(findResource(resources, "public/css/app.css").SourceDir).To(Equal(staticDir))
+			Expect(findResource(resources, "server.js").SourceDir).To(Equal(serverDir))
+		})
+
+		Context("when more than one directory has a .cfignore", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(staticDir, ".cfignore"), []byte("*.map\n"), 0600)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(serverDir, ".cfignore"), []byte("*.log\n"), 0600)).To(Succeed())
+			})
+
+			It("keeps the first .cfignore", func() {
+				resources, err := actor.GatherMultipleDirectoryResources([]string{staticDir, serverDir})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					".cfignore",
+					"public",
+					"public/css",
+					"public/css/app.css",
+					"public/index.html",
+					"server.js",
+				}))
+				Expect(findResource(resources, ".cfignore").SourceDir).To(Equal(staticDir))
+			})
+		})
+
+		Context("when a file exists in more than one directory", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(staticDir, "public", "index.html"), []byte("<html></html>"), 0600)).To(Succeed())
+			})
+
+			It("returns a ResourceCollisionError", func() {
+				_, err := actor.GatherMultipleDirectoryResources([]string{staticDir, serverDir})
+				Expect(err).To(MatchError(ResourceCollisionError{
+					Filename:   "public/index.html",
+					SourceDirs: []string{staticDir, serverDir},
+				}))
+			})
+		})
+
+		Context("when a file in one directory is a directory in another", func() {
+			BeforeEach(func() {
+				Expect(os.MkdirAll(filepath.Join(staticDir, "server.js"), 0777)).To(Succeed())
+			})
+
+			It("returns a ResourceCollisionError", func() {
+				_, err := actor.GatherMultipleDirectoryResources([]string{staticDir, serverDir})
+				Expect(err).To(MatchError(ResourceCollisionError{
+					Filename:   "server.js",
+					SourceDirs: []string{staticDir, serverDir},
+				}))
+			})
+		})
+	})
+
+	Describe("ZipMultipleDirectoryResources", func() {
+		It("zips each resource from the directory it was gathered from", func() {
+			resources, err := actor.GatherMultipleDirectoryResources([]string{staticDir, serverDir})
+			Expect(err).ToNot(HaveOccurred())
+
+			zipPath, err := actor.ZipMultipleDirectoryResources([]string{staticDir, serverDir}, resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{
+				"public/",
+				"public/css/",
+				"public/css/app.css",
+				"public/index.html",
+				"server.js",
+			}))
+			expectFileContentsToEqual(findZipFile(reader.File, "public/css/app.css"), "body {}")
+			expectFileContentsToEqual(findZipFile(reader.File, "server.js"), "listen()")
+		})
+
+		Context("when a file is ignored in an earlier directory", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(filepath.Join(staticDir, ".cfignore"), []byte("secret.yml\n"), 0600)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(staticDir, "secret.yml"), []byte("password: hunter2"), 0600)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(serverDir, "secret.yml"), []byte("password: <redacted>"), 0600)).To(Succeed())
+			})
+
+			It("zips the file from the directory it was gathered from", func() {
+				resources, err := actor.GatherMultipleDirectoryResources([]string{staticDir, serverDir})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(findResource(resources, "secret.yml").SourceDir).To(Equal(serverDir))
+
+				zipPath, err := actor.ZipMultipleDirectoryResources([]string{staticDir, serverDir}, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				expectFileContentsToEqual(findZipFile(reader.File, "secret.yml"), "password: <redacted>")
+			})
+		})
+
+		Context("when a resource was not gathered from any of the directories", func() {
+			It("returns a ResourceSourceDirNotFoundError", func() {
+				_, err := actor.ZipMultipleDirectoryResources([]string{staticDir, serverDir}, []Resource{
+					{Filename: "server.js", SHA1: "some-sha", Size: 1, Mode: 0644},
+				})
+				Expect(err).To(MatchError(ResourceSourceDirNotFoundError{Filename: "server.js"}))
+			})
+		})
+
+		Context("when a resource was gathered from another directory", func() {
+			It("returns a ResourceSourceDirNotFoundError", func() {
+				_, err := actor.ZipMultipleDirectoryResources([]string{staticDir}, []Resource{
+					{Filename: "server.js", SHA1: "some-sha", Size: 1, Mode: 0644, SourceDir: serverDir},
+				})
+				Expect(err).To(MatchError(ResourceSourceDirNotFoundError{Filename: "server.js", SourceDir: serverDir}))
+			})
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package v2action
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultOpenRetryAttempts is the number of times opening a file is
+	// retried after a transient failure when the actor's OpenRetryAttempts
+	// is not set.
+	DefaultOpenRetryAttempts = 5
+
+	// DefaultOpenRetryDelay is the delay before the first retry when the
+	// actor's OpenRetryDelay is not set.
+	DefaultOpenRetryDelay = 50 * time.Millisecond
+)
+
+// openFile opens the file at path for gathering or zipping. Transient
+// failures, such as a virus scanner briefly holding the file open on
+// Windows, are retried with an exponential backoff. Any other error, such as
+// the file not existing or not being readable, is returned immediately.
+func (actor Actor) openFile(ctx context.Context, path string) (*os.File, error) {
+	open := actor.OpenFile
+	if open == nil {
+		open = os.Open
+	}
+
+	attempts := actor.OpenRetryAttempts
+	if attempts == 0 {
+		attempts = DefaultOpenRetryAttempts
+	}
+	delay := actor.OpenRetryDelay
+	if delay == 0 {
+		delay = DefaultOpenRetryDelay
+	}
+
+	for retry := 0; ; retry++ {
+		file, err := open(path)
+		if err == nil || retry >= attempts || !isTransientOpenError(err) {
+			return file, err
+		}
+
+		actor.logger().WithField("path", path).Warnln("retrying open after transient error:", err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay << uint(retry)):
+		}
+	}
+}
+
+// isTransientOpenError returns true if err, returned when opening a file, is
+// likely to go away if the open is retried.
+func isTransientOpenError(err error) bool {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return isTransientOpenErrno(pathErr.Err)
+	}
+	return false
+}
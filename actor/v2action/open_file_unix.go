@@ -0,0 +1,11 @@
+// +build !windows
+
+package v2action
+
+import "syscall"
+
+// isTransientOpenErrno returns true for the errors returned by file systems,
+// such as networked ones, when a file is temporarily unavailable.
+func isTransientOpenErrno(err error) bool {
+	return err == syscall.EAGAIN || err == syscall.EBUSY
+}
@@ -0,0 +1,17 @@
+// +build windows
+
+package v2action
+
+import "syscall"
+
+const (
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// isTransientOpenErrno returns true for the sharing and lock violations
+// returned while another process, usually a virus scanner, holds the file
+// open.
+func isTransientOpenErrno(err error) bool {
+	return err == errorSharingViolation || err == errorLockViolation
+}
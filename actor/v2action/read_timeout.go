@@ -0,0 +1,57 @@
+package v2action
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// FileReadTimeoutError is returned when hashing a file takes longer than the
+// actor's FileReadTimeout.
+type FileReadTimeoutError struct {
+	Filename string
+}
+
+func (e FileReadTimeoutError) Error() string {
+	return fmt.Sprintf("Timed out reading '%s'", e.Filename)
+}
+
+// checksumFileWithTimeout hashes file, read from path, giving up once the
+// actor's FileReadTimeout has elapsed or ctx is cancelled. A read from a
+// stalled file system may never return, so the file is hashed in its own
+// goroutine, which is abandoned on timeout and unblocked where possible by
+// the caller closing the file. An abandoned file stops reporting its
+// hashing progress.
+func (actor Actor) checksumFileWithTimeout(ctx context.Context, path string, file io.Reader) (resourceChecksums, error) {
+	readCtx, cancel := context.WithTimeout(ctx, actor.FileReadTimeout)
+	defer cancel()
+
+	type result struct {
+		checksums resourceChecksums
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		checksums, err := actor.checksumReader(readCtx, file)
+		done <- result{checksums: checksums, err: err}
+	}()
+
+	var checksums result
+	select {
+	case checksums = <-done:
+	case <-readCtx.Done():
+		stopHashProgress(file)
+		checksums.err = readCtx.Err()
+	}
+
+	if checksums.err != nil {
+		if err := ctx.Err(); err != nil {
+			return resourceChecksums{}, err
+		}
+		if readCtx.Err() == context.DeadlineExceeded {
+			actor.logger().WithField("path", path).Errorln("timed out reading file after", actor.FileReadTimeout)
+			return resourceChecksums{}, FileReadTimeoutError{Filename: path}
+		}
+	}
+	return checksums.checksums, checksums.err
+}
@@ -0,0 +1,133 @@
+package v2action
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxRemoteArchiveRedirects is the number of redirects followed when
+// fetching a remote archive with a client that has no redirect policy.
+const maxRemoteArchiveRedirects = 10
+
+// RemoteArchiveStatusError is returned when fetching a remote archive
+// responds with a status other than 200 OK.
+type RemoteArchiveStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e RemoteArchiveStatusError) Error() string {
+	return fmt.Sprintf("Fetching archive '%s' failed with status %d", e.URL, e.StatusCode)
+}
+
+// RemoteArchiveRedirectError is returned when fetching a remote archive is
+// redirected too many times.
+type RemoteArchiveRedirectError struct {
+	URL string
+}
+
+func (e RemoteArchiveRedirectError) Error() string {
+	return fmt.Sprintf("Fetching archive '%s' was redirected more than %d times", e.URL, maxRemoteArchiveRedirects)
+}
+
+// GatherRemoteArchiveResources downloads the archive at archiveURL to a
+// temporary file, following redirects, and returns a list of its resources
+// like GatherArchiveResources. The temporary file is always removed before
+// returning.
+func (actor Actor) GatherRemoteArchiveResources(archiveURL string) ([]Resource, error) {
+	archivePath, err := actor.downloadRemoteArchive(archiveURL)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(filepath.Dir(archivePath))
+
+	return actor.GatherArchiveResources(archivePath)
+}
+
+// downloadRemoteArchive saves the archive at archiveURL into a new temporary
+// directory in the actor's ZipTempDir, named after the last segment of its
+// URL path so that gzipped files keep their name.
+func (actor Actor) downloadRemoteArchive(archiveURL string) (string, error) {
+	response, err := actor.httpClient(archiveURL).Get(archiveURL)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			if redirectErr, ok := urlErr.Err.(RemoteArchiveRedirectError); ok {
+				return "", redirectErr
+			}
+		}
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", RemoteArchiveStatusError{URL: archiveURL, StatusCode: response.StatusCode}
+	}
+
+	tempDir, err := ioutil.TempDir(actor.ZipTempDir, "cf-remote-archive")
+	if err != nil {
+		return "", err
+	}
+
+	archivePath := filepath.Join(tempDir, remoteArchiveName(response.Request.URL.Path))
+
+	err = writeRemoteArchive(archivePath, response.Body)
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	actor.logger().WithField("url", archiveURL).Debug("downloaded remote archive")
+	return archivePath, nil
+}
+
+// remoteArchiveName returns the last segment of urlPath, or "archive" when
+// there is none or it could name a file outside of the directory it is
+// joined to, such as a decoded "..\evil" on Windows.
+func remoteArchiveName(urlPath string) string {
+	name := path.Base(urlPath)
+	if name == "." || strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return "archive"
+	}
+	return name
+}
+
+func writeRemoteArchive(archivePath string, body io.Reader) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(archive, body)
+	if closeErr := archive.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// httpClient returns the actor's HTTPClient, limiting redirects with a
+// RemoteArchiveRedirectError unless the client has its own redirect policy.
+func (actor Actor) httpClient(archiveURL string) *http.Client {
+	client := http.DefaultClient
+	if actor.HTTPClient != nil {
+		client = actor.HTTPClient
+	}
+	if client.CheckRedirect != nil {
+		return client
+	}
+
+	limitedClient := *client
+	limitedClient.CheckRedirect = func(_ *http.Request, via []*http.Request) error {
+		if len(via) >= maxRemoteArchiveRedirects {
+			return RemoteArchiveRedirectError{URL: archiveURL}
+		}
+		return nil
+	}
+	return &limitedClient
+}
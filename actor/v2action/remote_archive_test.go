@@ -0,0 +1,236 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Remote Archive Actions", func() {
+	var (
+		actor  *Actor
+		server *ghttp.Server
+
+		tempDirsBefore []string
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+		server = ghttp.NewServer()
+
+		var err error
+		tempDirsBefore, err = filepath.Glob(filepath.Join(os.TempDir(), "cf-remote-archive*"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+
+		tempDirsAfter, err := filepath.Glob(filepath.Join(os.TempDir(), "cf-remote-archive*"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tempDirsAfter).To(ConsistOf(tempDirsBefore))
+	})
+
+	Describe("GatherRemoteArchiveResources", func() {
+		var (
+			resources  []Resource
+			executeErr error
+		)
+
+		JustBeforeEach(func() {
+			resources, executeErr = actor.GatherRemoteArchiveResources(server.URL() + "/artifacts/app.zip")
+		})
+
+		Context("when the server responds with the archive", func() {
+			BeforeEach(func() {
+				buffer := new(bytes.Buffer)
+				writer := zip.NewWriter(buffer)
+				entry, err := writer.Create("tmpFile1")
+				Expect(err).ToNot(HaveOccurred())
+				_, err = entry.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest(http.MethodGet, "/artifacts/app.zip"),
+						ghttp.RespondWith(http.StatusOK, buffer.Bytes()),
+					),
+				)
+			})
+
+			It("gathers the archive's resources", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].Filename).To(Equal("tmpFile1"))
+				Expect(resources[0].SHA1).To(Equal("9e36efec86d571de3a38389ea799a796fe4782f4"))
+			})
+		})
+
+		Context("when the server redirects to a gzipped file", func() {
+			BeforeEach(func() {
+				buffer := new(bytes.Buffer)
+				writer := gzip.NewWriter(buffer)
+				_, err := writer.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest(http.MethodGet, "/artifacts/app.zip"),
+						ghttp.RespondWith(http.StatusFound, nil, http.Header{"Location": {"/storage/app.bin.gz"}}),
+					),
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest(http.MethodGet, "/storage/app.bin.gz"),
+						ghttp.RespondWith(http.StatusOK, buffer.Bytes()),
+					),
+				)
+			})
+
+			It("follows the redirect and names the file after the final URL", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].Filename).To(Equal("app.bin"))
+			})
+		})
+
+		Context("when the final URL's last segment is not a safe file name", func() {
+			var (
+				parentDir  string
+				zipTempDir string
+			)
+
+			BeforeEach(func() {
+				var err error
+				parentDir, err = ioutil.TempDir("", "v2-remote-archive-parent-dir")
+				Expect(err).ToNot(HaveOccurred())
+				zipTempDir = filepath.Join(parentDir, "zip-temp-dir")
+				Expect(os.Mkdir(zipTempDir, 0700)).To(Succeed())
+				actor.ZipTempDir = zipTempDir
+
+				buffer := new(bytes.Buffer)
+				writer := gzip.NewWriter(buffer)
+				_, err = writer.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusFound, nil, http.Header{"Location": {"/storage/..%5C..%5Cevil.gz"}}),
+					ghttp.RespondWith(http.StatusOK, buffer.Bytes()),
+				)
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(parentDir)).To(Succeed())
+			})
+
+			It("names the file archive inside the ZipTempDir", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].Filename).To(Equal("archive"))
+
+				contents, err := filepath.Glob(filepath.Join(parentDir, "*"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(contents).To(Equal([]string{zipTempDir}))
+			})
+		})
+
+		Context("when the server redirects too many times", func() {
+			BeforeEach(func() {
+				server.RouteToHandler(http.MethodGet, "/artifacts/app.zip",
+					ghttp.RespondWith(http.StatusFound, nil, http.Header{"Location": {"/artifacts/app.zip"}}),
+				)
+			})
+
+			It("returns a RemoteArchiveRedirectError", func() {
+				Expect(executeErr).To(MatchError(RemoteArchiveRedirectError{URL: server.URL() + "/artifacts/app.zip"}))
+			})
+		})
+
+		Context("when the server responds with an error status", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusNotFound, "not found"),
+				)
+			})
+
+			It("returns a RemoteArchiveStatusError", func() {
+				Expect(executeErr).To(MatchError(RemoteArchiveStatusError{
+					URL:        server.URL() + "/artifacts/app.zip",
+					StatusCode: http.StatusNotFound,
+				}))
+			})
+		})
+
+		Context("when the downloaded file is not an archive", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, "not an archive"),
+				)
+			})
+
+			It("returns an InvalidArchiveError", func() {
+				Expect(executeErr).To(BeAssignableToTypeOf(InvalidArchiveError{}))
+			})
+		})
+
+		Context("when the actor has a ZipTempDir", func() {
+			var zipTempDir string
+
+			BeforeEach(func() {
+				var err error
+				zipTempDir, err = ioutil.TempDir("", "v2-remote-archive-zip-temp-dir")
+				Expect(err).ToNot(HaveOccurred())
+				actor.ZipTempDir = filepath.Join(zipTempDir, "missing")
+
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusOK, "not an archive"),
+				)
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(zipTempDir)).To(Succeed())
+			})
+
+			It("creates the download in it", func() {
+				Expect(os.IsNotExist(executeErr)).To(BeTrue())
+			})
+		})
+
+		Context("when the actor has an HTTP client", func() {
+			var transport *recordingTransport
+
+			BeforeEach(func() {
+				transport = &recordingTransport{}
+				actor.HTTPClient = &http.Client{Transport: transport}
+
+				server.AppendHandlers(
+					ghttp.RespondWith(http.StatusNotFound, nil),
+				)
+			})
+
+			It("fetches the archive with it", func() {
+				Expect(executeErr).To(HaveOccurred())
+				Expect(transport.requests).To(Equal(1))
+			})
+		})
+	})
+})
+
+type recordingTransport struct {
+	requests int
+}
+
+func (transport *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	transport.requests++
+	return http.DefaultTransport.RoundTrip(request)
+}
@@ -2,177 +2,1634 @@ package v2action
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
 	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/cli/api/cloudcontroller/ccv2"
-	"code.cloudfoundry.org/ykk"
 	log "github.com/sirupsen/logrus"
 )
 
+// DefaultArchiveFilePermissions are the permissions given to files that have
+// no mode of their own, unless the actor's FilePermissions is set.
+const DefaultArchiveFilePermissions = 0744
+
+// DefaultFolderPermissions are the permissions given to archived directories
+// that have no mode of their own, unless the actor's FolderPermissions is
+// set.
+const DefaultFolderPermissions = 0755
+
+// FileChangedError is returned when a file's contents no longer match the
+// SHA1 recorded when its resource was gathered, or when its size changes
+// while it is being gathered.
 type FileChangedError struct {
+	Filename     string
+	ExpectedSHA1 string
+	ActualSHA1   string
+	ExpectedSize int64
+	ActualSize   int64
+}
+
+func (e FileChangedError) Error() string {
+	if e.ExpectedSize != e.ActualSize {
+		return fmt.Sprintf("Size changed while gathering: %s (expected %d bytes, got %d)", e.Filename, e.ExpectedSize, e.ActualSize)
+	}
+	return fmt.Sprintf("SHA1 mismatch for: %s (expected %s, got %s)", e.Filename, e.ExpectedSHA1, e.ActualSHA1)
+}
+
+// FileTooLargeError is returned when a file being gathered is larger than the
+// actor's MaxFileSize.
+type FileTooLargeError struct {
+	Filename string
+	Size     int64
+	Limit    int64
+}
+
+func (e FileTooLargeError) Error() string {
+	return fmt.Sprintf("File %s is %d bytes, which exceeds the limit of %d bytes", e.Filename, e.Size, e.Limit)
+}
+
+// ArchiveTooLargeError is returned when the combined size of the files being
+// zipped, or of a streamed archive, is larger than the actor's MaxTotalSize.
+// For streams, TotalSize is the number of bytes read before giving up.
+type ArchiveTooLargeError struct {
+	TotalSize int64
+	Limit     int64
+}
+
+func (e ArchiveTooLargeError) Error() string {
+	return fmt.Sprintf("Files total %d bytes, which exceeds the limit of %d bytes", e.TotalSize, e.Limit)
+}
+
+// UnsupportedFileTypeError is returned when a directory being gathered
+// contains a file that is neither a regular file nor a directory, such as a
+// named pipe, device or socket, or when such a file is gathered on its own.
+type UnsupportedFileTypeError struct {
 	Filename string
+	Mode     os.FileMode
+}
+
+func (e UnsupportedFileTypeError) Error() string {
+	return fmt.Sprintf("File %s has unsupported type %s; only regular files and directories can be pushed", e.Filename, e.Mode)
+}
+
+// IncompleteZipError is returned when a zip read back after being written
+// does not contain every resource that was added to it.
+type IncompleteZipError struct {
+	Path            string
+	ExpectedEntries int
+	ActualEntries   int
+}
+
+func (e IncompleteZipError) Error() string {
+	return fmt.Sprintf("The zip file '%s' is incomplete: expected %d entries, found %d", e.Path, e.ExpectedEntries, e.ActualEntries)
+}
+
+// InvalidArchiveError is returned when a file is not a valid archive.
+type InvalidArchiveError struct {
+	Path string
+}
+
+func (e InvalidArchiveError) Error() string {
+	if e.Path == "" {
+		return "The provided archive is not a valid zip archive"
+	}
+	return fmt.Sprintf("The provided file '%s' is not a valid zip archive", e.Path)
+}
+
+// InvalidCompressionLevelError is returned when zipping with a
+// ZipCompressionLevel that is not a flate compression level.
+type InvalidCompressionLevelError struct {
+	Level int
+}
+
+func (e InvalidCompressionLevelError) Error() string {
+	return fmt.Sprintf("Invalid zip compression level %d: must be between %d and %d", e.Level, flate.HuffmanOnly, flate.BestCompression)
+}
+
+// InsufficientDiskSpaceError is returned when the directory zip files are
+// written to runs out of space.
+type InsufficientDiskSpaceError struct {
+	Dir string
+}
+
+func (e InsufficientDiskSpaceError) Error() string {
+	return fmt.Sprintf("Not enough disk space in '%s' to create the zip file", e.Dir)
+}
+
+// TruncatedArchiveError is returned when the compressed stream of an archive
+// ends before the file it contains does.
+type TruncatedArchiveError struct {
+	Name string
+}
+
+func (e TruncatedArchiveError) Error() string {
+	return fmt.Sprintf("The archive is truncated: '%s' is incomplete", e.Name)
+}
+
+// CorruptArchiveEntryError is returned when the contents of an archive entry
+// do not match the CRC32 checksum the archive stores for it, which usually
+// means the archive was damaged while being downloaded or copied.
+type CorruptArchiveEntryError struct {
+	Name string
+}
+
+func (e CorruptArchiveEntryError) Error() string {
+	return fmt.Sprintf("The archive is corrupt: '%s' does not match its checksum", e.Name)
+}
+
+// UnsafeArchivePathError is returned when an archive contains an entry whose
+// name leads outside of the archive.
+type UnsafeArchivePathError struct {
+	Name string
+}
+
+func (e UnsafeArchivePathError) Error() string {
+	return fmt.Sprintf("The archive entry '%s' is outside of the archive", e.Name)
+}
+
+// SymlinkOutsideDirectoryError is returned when a symlink in the source
+// directory resolves to a path outside of it.
+type SymlinkOutsideDirectoryError struct {
+	Filename string
+	Target   string
+}
+
+func (e SymlinkOutsideDirectoryError) Error() string {
+	return fmt.Sprintf("Symlink '%s' points to '%s', which is outside of the source directory", e.Filename, e.Target)
+}
+
+// ZipProgressFunc is called after each resource is added to a zip.
+// bytesWritten is the number of bytes copied from the files zipped so far,
+// which only differs from their combined Size when a file changed size after
+// it was gathered, and totalBytes is the combined Size of all the resources
+// being zipped.
+type ZipProgressFunc func(filename string, bytesWritten int64, totalBytes int64)
+
+// ZipSummary describes a zip written by the actor. FileCount is the number of
+// files zipped and DirectoryCount the number of directory entries.
+// UncompressedSize is the total Size of the zipped resources and
+// CompressedSize is the size of the zip file. CopiedSize is the number of
+// bytes actually read from the zipped files, which differs from
+// UncompressedSize when a file changed size after it was gathered. SHA256 is
+// the hex encoded SHA256 of the zip file, computed while it is written, for
+// comparing against what the Cloud Controller reports after an upload.
+type ZipSummary struct {
+	FileCount        int
+	DirectoryCount   int
+	UncompressedSize int64
+	CopiedSize       int64
+	CompressedSize   int64
+	SHA256           string
+	Duration         time.Duration
+}
+
+// GatherReport is the result of gathering a directory's resources while
+// skipping the files that cannot be read.
+type GatherReport struct {
+	Resources []Resource
+	Skipped   []SkippedFile
+
+	// Vanished lists the files and directories that were deleted while
+	// being gathered, when the actor's SkipVanishedFiles is set.
+	Vanished []SkippedFile
+
+	// HardLinks lists the Filenames of the gathered files that are hard
+	// links to the same file, one sorted group per file. Every link is
+	// still zipped as a separate copy; set the actor's ZipDeduplicate to
+	// compress their contents once. Hard links are only detected on UNIX
+	// systems, since the file information on Windows has no inode.
+	HardLinks [][]string
+}
+
+// SkippedFile is a file or directory that was left out of a GatherReport's
+// resources, along with the error encountered reading it.
+type SkippedFile struct {
+	Path string
+	Err  error
+}
+
+// gatherOptions holds the per call settings used when gathering a
+// directory's resources.
+type gatherOptions struct {
+	skipUnreadable bool
+	metadataOnly   bool
+
+	// fingerprint sets the Fingerprint of every file.
+	fingerprint bool
+
+	// changedSince, when set, only hashes the files modified after it.
+	changedSince time.Time
+
+	// fileSystem, when set, is gathered from instead of the operating
+	// system's file system.
+	fileSystem fileSystem
+
+	// each, when set, is called with every resource as soon as it has been
+	// hashed instead of collecting the resources.
+	each func(Resource) error
+}
+
+// changed returns true if a file modified at modTime is hashed.
+func (options gatherOptions) changed(modTime time.Time) bool {
+	return options.changedSince.IsZero() || modTime.After(options.changedSince)
+}
+
+// zipOptions holds the per call settings used when writing a directory zip.
+type zipOptions struct {
+	progress ZipProgressFunc
+
+	// sourceDirs, when set, maps a resource's Filename to the directory it
+	// is zipped from, and the sourceDir passed in is ignored. Resources
+	// missing from it return a ResourceSourceDirNotFoundError.
+	sourceDirs map[string]string
+
+	// rename, when set, maps each entry's original name to the name it is
+	// stored under in the zip. See ZipNameFunc.
+	rename ZipNameFunc
+
+	// destPaths maps a resource's Filename to the name it is stored under
+	// in the zip when it differs. It is computed from rename.
+	destPaths map[string]string
+
+	// includedOnly leaves archive entries without a matching resource out
+	// of the zip.
+	includedOnly bool
+
+	// transform, when set, replaces the contents of every zipped file. See
+	// ZipTransformFunc.
+	transform ZipTransformFunc
+
+	// gzip wraps the whole zip in a gzip stream.
+	gzip bool
+
+	// checksum computes the SHA256 of the zip file for its summary.
+	checksum bool
+
+	// fileSystem, when set, is zipped from instead of the operating
+	// system's file system.
+	fileSystem fileSystem
+}
+
+// Resource represents a file or directory that is part of an application's
+// bits. SHA1 holds the checksum computed by the actor's NewResourceHash,
+// which is SHA1 unless configured otherwise, and SHA256 is only set when the
+// actor's GatherSHA256 is enabled. ContentType is the MIME type sniffed from
+// a file's contents, only set when the actor's DetectContentType is enabled;
+// directories have none. Symlinks have os.ModeSymlink set in their Mode,
+// while their checksums and Size describe the file the link points to.
+// Symlinks to directories are recorded with os.ModeSymlink|os.ModeDir and
+// their contents are not gathered. When the actor's PreserveSymlinks is
+// enabled, a symlink's checksums and Size describe its target path instead.
+// The setuid, setgid and sticky bits of a Mode are kept when zipping, since
+// zip entries store them alongside the permissions. Fingerprint is only set
+// by GatherDirectoryResourcesWithFingerprints and is a quick hash of a
+// file's size and the ends of its contents, meant for detecting local
+// changes, such as in a cache of previously gathered resources. Files that
+// only differ in the middle share a Fingerprint, so it must never be used in
+// place of SHA1 for resource matching. SourceDir is only set by
+// GatherMultipleDirectoryResources and names the directory the resource was
+// gathered from.
+type Resource struct {
+	Filename    string
+	Size        int64
+	SHA1        string
+	SHA256      string
+	ContentType string
+	Mode        os.FileMode
+	Fingerprint string
+	SourceDir   string
+}
+
+// resourceChecksums holds the checksums computed for a file's contents,
+// along with the content type sniffed while reading them.
+type resourceChecksums struct {
+	sha1        string
+	sha256      string
+	contentType string
+}
+
+// GatherResources returns a list of resources for path, gathering them from
+// the directory when path is a directory and from the archive when it is a
+// regular file. Any other type of file returns an UnsupportedFileTypeError.
+func (actor Actor) GatherResources(path string) ([]Resource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return actor.GatherDirectoryResources(path)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, UnsupportedFileTypeError{Filename: path, Mode: info.Mode()}
+	}
+	return actor.GatherArchiveResources(path)
+}
+
+// GatherArchiveResources returns a list of resources for a zip, tar or
+// gzipped tar archive. Directories keep the mode stored in the archive,
+// falling back to the actor's FolderPermissions when it has no permissions
+// or the zip was written without Unix modes.
+func (actor Actor) GatherArchiveResources(archivePath string) ([]Resource, error) {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	reader, err := actor.openArchiveReader(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return actor.gatherArchiveResources(reader)
+}
+
+// GatherArchiveResourcesFromReader returns a list of resources for the zip,
+// tar or gzipped tar archive stored in the first size bytes of archive.
+func (actor Actor) GatherArchiveResourcesFromReader(archive io.ReaderAt, size int64) ([]Resource, error) {
+	reader, err := actor.readArchive(archive, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return actor.gatherArchiveResources(reader)
+}
+
+// GatherResourcesFromMap returns a list of resources, sorted by Filename, for
+// the in-memory files keyed by their slash separated filename. Each file is
+// given the actor's FilePermissions.
+func (actor Actor) GatherResourcesFromMap(files map[string][]byte) []Resource {
+	resources := make([]Resource, 0, len(files))
+	for filename, contents := range files {
+		// reading from memory cannot fail
+		checksums, _ := actor.checksumReader(context.Background(), bytes.NewReader(contents))
+
+		resources = append(resources, Resource{
+			Filename:    filename,
+			Size:        int64(len(contents)),
+			SHA1:        checksums.sha1,
+			SHA256:      checksums.sha256,
+			ContentType: checksums.contentType,
+			Mode:        actor.filePermissions(),
+		})
+	}
+	return sortResources(resources)
+}
+
+func (actor Actor) gatherArchiveResources(reader archiveReader) ([]Resource, error) {
+	var resources []Resource
+
+	err := reader.walk(func(entry archiveEntry) error {
+		resource := Resource{Filename: filepath.ToSlash(entry.name)}
+		if !entry.info.IsDir() {
+			// zip sizes are unsigned and overflow int64 when absurdly large
+			if entry.info.Size() < 0 {
+				return InvalidArchiveError{}
+			}
+
+			fileReader, err := entry.open()
+			if err != nil {
+				return err
+			}
+			defer fileReader.Close()
+
+			checksums, err := actor.checksumReader(context.Background(), fileReader)
+			if err != nil {
+				return archiveEntryReadError(entry.name, err)
+			}
+
+			resource.Size = entry.info.Size()
+			resource.SHA1 = checksums.sha1
+			resource.SHA256 = checksums.sha256
+			resource.ContentType = checksums.contentType
+			resource.Mode = actor.overrideMode(resource.Filename, actor.defaultMode(entry.info.Mode()))
+		} else {
+			resource.Mode = actor.defaultMode(entry.info.Mode())
+		}
+		resources = append(resources, resource)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// GatherDirectoryResources returns a list of resources for a directory,
+// sorted by Filename, excluding any paths that match the patterns in the
+// directory's .cfignore file.
+func (actor Actor) GatherDirectoryResources(sourceDir string) ([]Resource, error) {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return actor.GatherDirectoryResourcesWithIgnore(sourceDir, ignorePatterns)
+}
+
+// GatherDirectoryResourcesWithContext behaves like GatherDirectoryResources,
+// but stops and returns ctx.Err() as soon as ctx is cancelled.
+func (actor Actor) GatherDirectoryResourcesWithContext(ctx context.Context, sourceDir string) ([]Resource, error) {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := actor.gatherDirectoryResources(ctx, sourceDir, ignorePatterns, gatherOptions{})
+	return report.Resources, err
+}
+
+// GatherDirectoryResourcesWithIgnore returns a list of resources for a
+// directory, excluding any paths that match the provided .gitignore style
+// patterns. Ignored directories are skipped entirely. Files are hashed
+// concurrently by HashWorkers workers, but the resources are always returned
+// sorted by Filename.
+func (actor Actor) GatherDirectoryResourcesWithIgnore(sourceDir string, ignorePatterns []string) ([]Resource, error) {
+	report, err := actor.gatherDirectoryResources(context.Background(), sourceDir, ignorePatterns, gatherOptions{})
+	return report.Resources, err
+}
+
+// GatherDirectoryResourcesWithReport behaves like GatherDirectoryResources,
+// but files and directories below sourceDir that cannot be read, including
+// special files such as named pipes, are left out of the resources and
+// listed in the report's Skipped files instead of failing the gather.
+func (actor Actor) GatherDirectoryResourcesWithReport(sourceDir string) (GatherReport, error) {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return GatherReport{}, err
+	}
+
+	return actor.gatherDirectoryResources(context.Background(), sourceDir, ignorePatterns, gatherOptions{skipUnreadable: true})
+}
+
+// GatherDirectoryResourcesMetadataOnly behaves like GatherDirectoryResources,
+// but does not read any file contents, so every resource's SHA1 is left
+// empty. The resources are only suitable for listing files and their sizes:
+// they cannot be matched against the Cloud Controller's resource cache or
+// zipped, since zipping checks each file against its SHA1.
+func (actor Actor) GatherDirectoryResourcesMetadataOnly(sourceDir string) ([]Resource, error) {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := actor.gatherDirectoryResources(context.Background(), sourceDir, ignorePatterns, gatherOptions{metadataOnly: true})
+	return report.Resources, err
+}
+
+// WalkResources calls fn with each of a directory's resources, in walk
+// order, as soon as it has been found and hashed, without holding on to the
+// resources. It applies the same filtering as GatherDirectoryResources, but
+// hashes files one at a time. If fn returns an error, the walk stops and
+// WalkResources returns that error.
+func (actor Actor) WalkResources(sourceDir string, fn func(Resource) error) error {
+	ignorePatterns, err := readCFIgnore(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	_, err = actor.gatherDirectoryResources(context.Background(), sourceDir, ignorePatterns, gatherOptions{each: fn})
+	return err
+}
+
+func (actor Actor) gatherDirectoryResources(ctx context.Context, sourceDir string, ignorePatterns []string, options gatherOptions) (GatherReport, error) {
+	matcher := newIgnoreMatcher(ignorePatterns)
+	fsys := actor.sourceFileSystem(options.fileSystem)
+	onOS := options.fileSystem == nil
+
+	var cache *checksumCache
+	if actor.ChecksumCacheDir != "" && !options.metadataOnly && onOS {
+		cache = loadChecksumCache(actor.ChecksumCacheDir)
+	}
+	var tempDir os.FileInfo
+	if onOS {
+		tempDir = actor.zipTempDirInfo()
+	}
+	pool := actor.startChecksumPool(ctx, fsys, cache)
+	skipVanished := actor.SkipVanishedFiles && onOS
+	skippable := func(path string, err error) bool {
+		return options.skipUnreadable && isUnreadableError(err) || skipVanished && fileVanished(path, err)
+	}
+	pool.skip = skippable
+
+	var (
+		resources []Resource
+		skipped   []SkippedFile
+		vanished  []SkippedFile
+		linkIDs   = map[string]fileID{}
+	)
+	recordSkipped := func(path string, err error) {
+		if skipVanished && fileVanished(path, err) {
+			actor.logger().WithField("path", path).Warnln("skipping file that vanished while gathering:", err)
+			vanished = append(vanished, SkippedFile{Path: path, Err: err})
+		} else {
+			skipped = append(skipped, SkippedFile{Path: path, Err: err})
+		}
+	}
+	addResource := func(resource Resource, path string, modTime time.Time, isFile bool) error {
+		if isFile && options.fingerprint {
+			fingerprint, err := actor.fingerprintFile(ctx, fsys, path, resource.Size)
+			if err != nil {
+				return err
+			}
+			resource.Fingerprint = fingerprint
+		}
+
+		hash := isFile && !options.metadataOnly && options.changed(modTime)
+		if options.each == nil {
+			if hash {
+				if err := pool.add(len(resources), path, resource.Size, modTime); err != nil {
+					return err
+				}
+			}
+			resources = append(resources, resource)
+			return nil
+		}
+
+		if hash {
+			checksums, err := actor.checksumFile(ctx, fsys, cache, checksumJob{path: path, size: resource.Size, modTime: modTime})
+			if err != nil {
+				return err
+			}
+			resource.SHA1 = checksums.sha1
+			resource.SHA256 = checksums.sha256
+			resource.ContentType = checksums.contentType
+		}
+		return options.each(resource)
+	}
+
+	gatherFile := func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		resource := Resource{
+			Filename: filepath.ToSlash(relPath),
+		}
+
+		if matcher.ignored(resource.Filename, entry.IsDir()) || actor.skipHidden(entry.Name()) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.IsDir() && isZipTempFile(tempDir, path) {
+			actor.logger().WithField("path", path).Debug("skipping temporary zip file")
+			return nil
+		}
+
+		if depth := strings.Count(resource.Filename, "/") + 1; depth > actor.maxDirectoryDepth() {
+			return PathTooDeepError{Path: path, Limit: actor.maxDirectoryDepth()}
+		}
+
+		if entry.IsDir() {
+			return addResource(resource, path, time.Time{}, false)
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !onOS {
+				return UnsupportedFileTypeError{Filename: path, Mode: info.Mode()}
+			}
+
+			targetInfo, err := resolveSymlink(sourceDir, path)
+			if err != nil {
+				return err
+			}
+
+			if !targetInfo.IsDir() && !actor.includedExtension(resource.Filename) {
+				return nil
+			}
+
+			if actor.PreserveSymlinks {
+				target, err := readSymlinkTarget(path)
+				if err != nil {
+					return err
+				}
+
+				resource.Size = int64(len(target))
+				resource.Mode = actor.NormalizeMode(info.Mode())
+				if !options.metadataOnly && options.changed(info.ModTime()) {
+					checksums, err := actor.checksumReader(ctx, strings.NewReader(target))
+					if err != nil {
+						return err
+					}
+					resource.SHA1 = checksums.sha1
+					resource.SHA256 = checksums.sha256
+					resource.ContentType = checksums.contentType
+				}
+				return addResource(resource, path, info.ModTime(), false)
+			}
+
+			if targetInfo.IsDir() {
+				resource.Mode = os.ModeSymlink | os.ModeDir
+				return addResource(resource, path, targetInfo.ModTime(), false)
+			}
+			resource.Mode = os.ModeSymlink
+			info = targetInfo
+		}
+
+		if !actor.includedExtension(resource.Filename) {
+			return nil
+		}
+
+		if !info.Mode().IsRegular() {
+			return UnsupportedFileTypeError{Filename: path, Mode: info.Mode()}
+		}
+
+		if actor.SkipEmptyFiles && info.Size() == 0 {
+			return nil
+		}
+
+		if actor.MaxFileSize > 0 && info.Size() > actor.MaxFileSize {
+			return FileTooLargeError{Filename: path, Size: info.Size(), Limit: actor.MaxFileSize}
+		}
+
+		resource.Size = info.Size()
+		resource.Mode |= actor.NormalizeMode(info.Mode())
+
+		if id, ok := hardLinkID(info); ok && resource.Mode&os.ModeSymlink == 0 {
+			linkIDs[resource.Filename] = id
+		}
+		return addResource(resource, path, info.ModTime(), true)
+	}
+
+	// WalkDir is used rather than Walk so that only the files that are
+	// gathered, and not every directory and ignored entry, are stat'd.
+	walkErr := fsys.WalkDir(sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		gatherErr := gatherFile(path, entry, err)
+		if gatherErr != nil && path != sourceDir && skippable(path, gatherErr) {
+			recordSkipped(path, gatherErr)
+			if entry == nil || !entry.IsDir() {
+				return nil
+			}
+
+			// a directory is gathered before it is listed, so one that
+			// cannot be listed has already been gathered
+			relPath, relErr := filepath.Rel(sourceDir, path)
+			if last := len(resources) - 1; err != nil && relErr == nil && last >= 0 && resources[last].Filename == filepath.ToSlash(relPath) {
+				resources = resources[:last]
+			}
+			return filepath.SkipDir
+		}
+		return gatherErr
+	})
+
+	checksums, skippedChecksums, poolErr := pool.wait()
+	if err := ctx.Err(); err != nil {
+		return GatherReport{}, err
+	}
+	if poolErr != nil {
+		return GatherReport{}, poolErr
+	}
+	if walkErr != nil {
+		return GatherReport{}, walkErr
+	}
+
+	for index, fileChecksums := range checksums {
+		resources[index].SHA1 = fileChecksums.sha1
+		resources[index].SHA256 = fileChecksums.sha256
+		resources[index].ContentType = fileChecksums.contentType
+	}
+
+	if len(skippedChecksums) > 0 {
+		gathered := make([]Resource, 0, len(resources)-len(skippedChecksums))
+		for index, resource := range resources {
+			if err, ok := skippedChecksums[index]; ok {
+				recordSkipped(filepath.Join(sourceDir, filepath.FromSlash(resource.Filename)), err)
+				continue
+			}
+			gathered = append(gathered, resource)
+		}
+		resources = gathered
+	}
+	resources = sortResources(resources)
+	sortSkippedFiles(skipped)
+	sortSkippedFiles(vanished)
+
+	if err := cache.save(); err != nil {
+		actor.logger().WithField("checksumCacheDir", actor.ChecksumCacheDir).Errorln("saving checksum cache:", err)
+	}
+	return GatherReport{Resources: resources, Skipped: skipped, Vanished: vanished, HardLinks: groupHardLinks(resources, linkIDs)}, nil
+}
+
+func sortSkippedFiles(files []SkippedFile) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+}
+
+// ZipDirectoryResources zips a directory and a list of resources, sorted by
+// Filename before zipping, and returns the location. On Windows, the
+// filemode for user is forced to be readable and executable. On success the
+// caller is responsible for removing the zip file; on error it is removed
+// before returning.
+func (actor Actor) ZipDirectoryResources(sourceDir string, filesToInclude []Resource) (string, error) {
+	return actor.ZipDirectoryResourcesWithContext(context.Background(), sourceDir, filesToInclude)
+}
+
+// ZipDirectoryResourcesWithContext behaves like ZipDirectoryResources, but
+// stops and returns ctx.Err() as soon as ctx is cancelled.
+func (actor Actor) ZipDirectoryResourcesWithContext(ctx context.Context, sourceDir string, filesToInclude []Resource) (string, error) {
+	zipPath, _, err := actor.zipDirectoryResources(ctx, sourceDir, filesToInclude, zipOptions{})
+	return zipPath, err
+}
+
+// ZipDirectoryResourcesWithProgress behaves like ZipDirectoryResources, but
+// calls progress after each resource has been added to the zip. A nil
+// progress is ignored.
+func (actor Actor) ZipDirectoryResourcesWithProgress(sourceDir string, filesToInclude []Resource, progress ZipProgressFunc) (string, error) {
+	zipPath, _, err := actor.zipDirectoryResources(context.Background(), sourceDir, filesToInclude, zipOptions{progress: progress})
+	return zipPath, err
+}
+
+// ZipDirectoryResourcesWithSummary behaves like ZipDirectoryResources, but
+// also returns a summary of the zip that was written, including its SHA256.
+func (actor Actor) ZipDirectoryResourcesWithSummary(sourceDir string, filesToInclude []Resource) (string, ZipSummary, error) {
+	return actor.zipDirectoryResources(context.Background(), sourceDir, filesToInclude, zipOptions{checksum: true})
+}
+
+// ZipDirectoryResourcesMatching behaves like ZipDirectoryResources, but only
+// zips the files whose Filename matches at least one of the include globs.
+// Globs use the same syntax as .cfignore patterns. Directories are only
+// zipped when they contain a matching file. An empty include zips all files.
+func (actor Actor) ZipDirectoryResourcesMatching(sourceDir string, filesToInclude []Resource, include []string) (string, error) {
+	return actor.ZipDirectoryResources(sourceDir, filterResources(filesToInclude, include))
+}
+
+func (actor Actor) zipDirectoryResources(ctx context.Context, sourceDir string, filesToInclude []Resource, options zipOptions) (string, ZipSummary, error) {
+	if options.sourceDirs == nil {
+		actor.logger().WithField("sourceDir", sourceDir).Info("zipping source files")
+	}
+	start := time.Now()
+	if options.rename != nil {
+		filesToInclude, options.destPaths = renameResources(filesToInclude, options.rename)
+	}
+	if err := actor.checkTotalSize(filesToInclude); err != nil {
+		return "", ZipSummary{}, err
+	}
+	if err := actor.checkCompressionLevel(); err != nil {
+		return "", ZipSummary{}, err
+	}
+	zipFile, err := actor.createZipFile()
+	if err != nil {
+		return "", ZipSummary{}, err
+	}
+
+	var w io.Writer = zipFile
+	var zipSum hash.Hash
+	if options.checksum {
+		zipSum = sha256.New()
+		w = io.MultiWriter(zipFile, zipSum)
+	}
+	var gzipWriter *gzip.Writer
+	if options.gzip {
+		gzipWriter = gzip.NewWriter(w)
+		w = gzipWriter
+	}
+
+	copiedSize, err := actor.writeDirectoryZip(ctx, w, sourceDir, filesToInclude, options)
+	if err == nil && gzipWriter != nil {
+		err = gzipWriter.Close()
+	}
+	if err == nil && actor.ZipVerify && !options.gzip {
+		err = actor.verifyZipEntryCount(zipFile, actor.zipEntryCount(filesToInclude))
+	}
+	var zipInfo os.FileInfo
+	if err == nil {
+		zipInfo, err = zipFile.Stat()
+	}
+	if err == nil {
+		err = actor.closeZipFile(zipFile)
+	}
+	if err != nil {
+		actor.removeZipFile(zipFile)
+		return "", ZipSummary{}, actor.checkDiskSpace(err)
+	}
+
+	fileCount, directoryCount := countResources(filesToInclude)
+	summary := ZipSummary{
+		FileCount:        fileCount,
+		DirectoryCount:   directoryCount,
+		UncompressedSize: actor.CalculateResourcesSize(filesToInclude),
+		CopiedSize:       copiedSize,
+		CompressedSize:   zipInfo.Size(),
+		Duration:         time.Since(start),
+	}
+	fields := log.Fields{
+		"zip_file_location":      zipFile.Name(),
+		"zipped_file_count":      summary.FileCount,
+		"zipped_directory_count": summary.DirectoryCount,
+		"uncompressed_size":      summary.UncompressedSize,
+		"copied_size":            summary.CopiedSize,
+		"compressed_size":        summary.CompressedSize,
+		"duration":               summary.Duration,
+	}
+	if zipSum != nil {
+		summary.SHA256 = fmt.Sprintf("%x", zipSum.Sum(nil))
+		fields["zip_sha256"] = summary.SHA256
+	}
+	actor.logger().WithFields(fields).Info("zip file created")
+	return zipFile.Name(), summary, nil
+}
+
+// ZipArchiveResources repackages a zip, tar or gzipped tar archive into a
+// zip and returns its location. The Mode and SHA1 of each archived file are
+// taken from the matching entry in filesToInclude; files without a matching
+// entry keep their archived mode. On success the caller is responsible for
+// removing the zip file; on error it is removed before returning.
+func (actor Actor) ZipArchiveResources(sourceArchivePath string, filesToInclude []Resource) (string, error) {
+	return actor.zipArchiveResources(sourceArchivePath, filesToInclude, zipOptions{})
+}
+
+// ZipArchiveResourcesIncludedOnly behaves like ZipArchiveResources, but
+// archive entries without a matching entry in filesToInclude are left out of
+// the zip, so that only a subset of the archive, such as the resources left
+// unmatched by MatchResources, is uploaded.
+func (actor Actor) ZipArchiveResourcesIncludedOnly(sourceArchivePath string, filesToInclude []Resource) (string, error) {
+	return actor.zipArchiveResources(sourceArchivePath, filesToInclude, zipOptions{includedOnly: true})
+}
+
+func (actor Actor) zipArchiveResources(sourceArchivePath string, filesToInclude []Resource, options zipOptions) (string, error) {
+	actor.logger().WithField("sourceArchive", sourceArchivePath).Info("zipping source files from archive")
+	if err := actor.checkCompressionLevel(); err != nil {
+		return "", err
+	}
+	source, err := os.Open(sourceArchivePath)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	reader, err := actor.openArchiveReader(source)
+	if err != nil {
+		return "", err
+	}
+
+	zipFile, err := actor.createZipFile()
+	if err != nil {
+		return "", err
+	}
+
+	writer := zip.NewWriter(zipFile)
+	actor.registerCompressor(writer)
+
+	resourcesToInclude := archiveResourcesByName(filesToInclude)
+	var fileCount, directoryCount int
+	err = reader.walk(func(entry archiveEntry) error {
+		// a missing entry results in an empty Resource
+		resource, included := resourcesToInclude[filepath.ToSlash(entry.name)]
+		if options.includedOnly && !included {
+			return nil
+		}
+
+		destPath, ok := zipEntryName(filepath.ToSlash(entry.name), options.rename)
+		if !ok {
+			return nil
+		}
+		actor.logger().WithField("archivedFile", entry.name).Debug("zipping archived file")
+		if entry.info.IsDir() {
+			directoryCount++
+		} else {
+			fileCount++
+		}
+		return actor.addArchiveEntryToZip(entry, destPath, resource, writer)
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = actor.closeZipFile(zipFile)
+	}
+	if err != nil {
+		actor.logger().WithField("sourceArchive", sourceArchivePath).Errorln("zipping archived files:", err)
+		actor.removeZipFile(zipFile)
+		return "", actor.checkDiskSpace(err)
+	}
+
+	actor.logger().WithFields(log.Fields{
+		"zip_file_location":      zipFile.Name(),
+		"zipped_file_count":      fileCount,
+		"zipped_directory_count": directoryCount,
+	}).Info("zip file created")
+	return zipFile.Name(), nil
+}
+
+// ZipDirectoryResourcesToWriter zips a directory and a list of resources,
+// sorted by Filename before zipping, directly to w, allowing the zip to be
+// streamed without an intermediate file.
+func (actor Actor) ZipDirectoryResourcesToWriter(sourceDir string, filesToInclude []Resource, w io.Writer) error {
+	actor.logger().WithField("sourceDir", sourceDir).Info("zipping source files to writer")
+	if err := actor.checkTotalSize(filesToInclude); err != nil {
+		return err
+	}
+	if err := actor.checkCompressionLevel(); err != nil {
+		return err
+	}
+	_, err := actor.writeDirectoryZip(context.Background(), w, sourceDir, filesToInclude, zipOptions{})
+	return err
+}
+
+// checkTotalSize returns an ArchiveTooLargeError if the combined size of
+// filesToInclude exceeds the actor's MaxTotalSize.
+func (actor Actor) checkTotalSize(filesToInclude []Resource) error {
+	if actor.MaxTotalSize <= 0 {
+		return nil
+	}
+
+	totalSize := actor.CalculateResourcesSize(filesToInclude)
+	if totalSize > actor.MaxTotalSize {
+		return ArchiveTooLargeError{TotalSize: totalSize, Limit: actor.MaxTotalSize}
+	}
+	return nil
+}
+
+// writeDirectoryZip zips filesToInclude from sourceDir to w and returns the
+// number of bytes copied from the zipped files.
+func (actor Actor) writeDirectoryZip(ctx context.Context, w io.Writer, sourceDir string, filesToInclude []Resource, options zipOptions) (int64, error) {
+	filesToInclude = sortResources(filesToInclude)
+	writer := zip.NewWriter(w)
+	actor.registerCompressor(writer)
+
+	var bytesWritten, totalBytes int64
+	for _, resource := range filesToInclude {
+		totalBytes += resource.Size
+	}
+
+	if err := actor.checkEmbeddedManifestName(filesToInclude, options.destPaths); err != nil {
+		return 0, err
+	}
+
+	var cache *zipContentCache
+	if actor.ZipDeduplicate {
+		cache = newZipContentCache(filesToInclude)
+	}
+
+	fsys := actor.sourceFileSystem(options.fileSystem)
+	var zipped []Resource
+	for _, resource := range filesToInclude {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		dir := sourceDir
+		if options.sourceDirs != nil {
+			resourceDir, ok := options.sourceDirs[resource.Filename]
+			if !ok {
+				return 0, ResourceSourceDirNotFoundError{Filename: resource.Filename}
+			}
+			dir = resourceDir
+		}
+		destPath := resource.Filename
+		if renamed, ok := options.destPaths[resource.Filename]; ok {
+			destPath = renamed
+		}
+		fullPath := filepath.Join(dir, resource.Filename)
+		actor.logger().WithField("fullPath", fullPath).Debug("zipping file")
+		copied, err := actor.addFileToZip(ctx, fsys, fullPath, destPath, resource.SHA1, cache, options.transform, writer)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+		if err != nil {
+			actor.logger().WithField("fullPath", fullPath).Errorln("zipping file:", err)
+			return 0, err
+		}
+
+		if isDirectoryResource(resource) {
+			copied = resource.Size
+		} else if copied != resource.Size {
+			actor.logger().WithFields(log.Fields{
+				"fullPath":      fullPath,
+				"expected_size": resource.Size,
+				"copied_size":   copied,
+			}).Warn("zipped file size differs from gathered size")
+		}
+
+		bytesWritten += copied
+		if options.progress != nil {
+			options.progress(resource.Filename, bytesWritten, totalBytes)
+		}
+
+		resource.Filename = destPath
+		zipped = append(zipped, resource)
+	}
+
+	if actor.ZipEmbeddedManifestName != "" {
+		if err := actor.addEmbeddedManifestToZip(zipped, writer); err != nil {
+			return 0, err
+		}
+	}
+
+	return bytesWritten, writer.Close()
 }
 
-func (e FileChangedError) Error() string {
-	return fmt.Sprint("SHA1 mismatch for:", e.Filename)
+// registerCompressor configures writer to deflate files using the actor's
+// ZipCompressionLevel.
+func (actor Actor) registerCompressor(writer *zip.Writer) {
+	level := actor.compressionLevel()
+	writer.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
 }
 
-type Resource ccv2.Resource
+// checkCompressionLevel returns an InvalidCompressionLevelError if the
+// actor's ZipCompressionLevel would fail in flate.NewWriter, so that it is
+// reported before a zip is created rather than when the first file is
+// deflated.
+func (actor Actor) checkCompressionLevel() error {
+	if level := actor.compressionLevel(); level < flate.HuffmanOnly || level > flate.BestCompression {
+		return InvalidCompressionLevelError{Level: level}
+	}
+	return nil
+}
 
-// GatherArchiveResources returns a list of resources for a directory.
-func (_ Actor) GatherArchiveResources(archivePath string) ([]Resource, error) {
-	var resources []Resource
+// compressionLevel returns the flate level used to deflate files, defaulting
+// to flate.DefaultCompression.
+func (actor Actor) compressionLevel() int {
+	if actor.ZipCompressionLevel == 0 {
+		return flate.DefaultCompression
+	}
+	return actor.ZipCompressionLevel
+}
 
-	archive, err := os.Open(archivePath)
+// setModified sets the header's modification time to modified, or to
+// ZipModifiedTime when it is set. The MS-DOS date and time are set as well,
+// since CreateRaw, used for deduplicated files, only writes those and does
+// not convert Modified the way CreateHeader does.
+func (actor Actor) setModified(header *zip.FileHeader, modified time.Time) {
+	if !actor.ZipModifiedTime.IsZero() {
+		modified = actor.ZipModifiedTime
+	}
+	header.SetModTime(modified)
+	header.Modified = modified
+}
+
+// zipMethod returns the compression method used for files added to zips.
+func (actor Actor) zipMethod() uint16 {
+	if actor.ZipStoreUncompressed {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// verifyZipEntryCount rereads the zip written to zipFile and returns an
+// IncompleteZipError unless it contains expected entries.
+func (actor Actor) verifyZipEntryCount(zipFile *os.File, expected int) error {
+	reader, err := actor.openArchiveReader(zipFile)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer archive.Close()
 
-	info, err := archive.Stat()
+	var actual int
+	err = reader.walk(func(archiveEntry) error {
+		actual++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if actual != expected {
+		actor.logger().WithFields(log.Fields{
+			"zip_file_location": zipFile.Name(),
+			"expected_entries":  expected,
+			"actual_entries":    actual,
+		}).Error("verifying zip file")
+		return IncompleteZipError{Path: zipFile.Name(), ExpectedEntries: expected, ActualEntries: actual}
+	}
+	return nil
+}
+
+// createZipFile creates an empty temporary file, in ZipTempDir when it is
+// set, for a zip to be written to.
+func (actor Actor) createZipFile() (*os.File, error) {
+	zipFile, err := ioutil.TempFile(actor.ZipTempDir, zipTempFilePrefix)
+	if err != nil {
+		actor.logger().WithField("tempDir", actor.zipTempDir()).Errorln("creating zip file:", err)
+		return nil, actor.checkDiskSpace(err)
+	}
+	return zipFile, nil
+}
+
+func (actor Actor) zipTempDir() string {
+	if actor.ZipTempDir == "" {
+		return os.TempDir()
+	}
+	return actor.ZipTempDir
+}
+
+// checkDiskSpace returns an InsufficientDiskSpaceError when err was caused by
+// the zip's temp directory running out of space, and err otherwise.
+func (actor Actor) checkDiskSpace(err error) error {
+	if isNoSpaceError(err) {
+		return InsufficientDiskSpaceError{Dir: actor.zipTempDir()}
+	}
+	return err
+}
+
+func isNoSpaceError(err error) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.SyscallError:
+		err = e.Err
+	}
+	return err == syscall.ENOSPC
+}
+
+// closeZipFile closes a fully written zip file, first flushing it to disk
+// when the actor's ZipSync is set.
+func (actor Actor) closeZipFile(zipFile *os.File) error {
+	if actor.ZipSync {
+		if err := zipFile.Sync(); err != nil {
+			actor.logger().WithField("zipFile", zipFile.Name()).Errorln("syncing zip file:", err)
+			return err
+		}
+	}
+	return zipFile.Close()
+}
+
+// removeZipFile closes and deletes a partially written zip file.
+func (actor Actor) removeZipFile(zipFile *os.File) {
+	_ = zipFile.Close()
+	err := os.Remove(zipFile.Name())
+	if err != nil {
+		actor.logger().WithField("zipFile", zipFile.Name()).Errorln("removing zip file:", err)
+	}
+}
+
+// resolveSymlink returns the file info of the symlink's target, ensuring that
+// the target is located within sourceDir.
+func resolveSymlink(sourceDir string, path string) (os.FileInfo, error) {
+	resolvedSourceDir, err := filepath.EvalSymlinks(sourceDir)
 	if err != nil {
 		return nil, err
 	}
 
-	reader, err := ykk.NewReader(archive, info.Size())
+	target, err := filepath.EvalSymlinks(path)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, archivedFile := range reader.File {
-		resource := Resource{Filename: filepath.ToSlash(archivedFile.Name)}
-		if !archivedFile.FileInfo().IsDir() {
-			fileReader, err := archivedFile.Open()
-			if err != nil {
-				return nil, err
-			}
-			defer fileReader.Close()
+	relTarget, err := filepath.Rel(resolvedSourceDir, target)
+	if err != nil || relTarget == ".." || strings.HasPrefix(relTarget, ".."+string(filepath.Separator)) {
+		return nil, SymlinkOutsideDirectoryError{Filename: path, Target: target}
+	}
 
-			hash := sha1.New()
+	return os.Stat(target)
+}
 
-			_, err = io.Copy(hash, fileReader)
-			if err != nil {
-				return nil, err
-			}
-			info := archivedFile.FileInfo()
+// computeChecksum returns the hex encoded checksums of the file at path in
+// fsys.
+func (actor Actor) computeChecksum(ctx context.Context, fsys fileSystem, path string) (resourceChecksums, error) {
+	file, err := fsys.Open(ctx, path)
+	if err != nil {
+		return resourceChecksums{}, err
+	}
+	defer file.Close()
+
+	reader, err := actor.hashProgress(path, file)
+	if err != nil {
+		return resourceChecksums{}, err
+	}
+
+	if actor.FileReadTimeout > 0 {
+		return actor.checksumFileWithTimeout(ctx, path, reader)
+	}
+	return actor.checksumReader(ctx, reader)
+}
+
+// NormalizeMode returns the mode a file with the given mode is given when it
+// is gathered from a directory and zipped. On Windows, the owner is given
+// read, write and execute permissions unless PreserveFileModes is set.
+func (actor Actor) NormalizeMode(mode os.FileMode) os.FileMode {
+	if actor.PreserveFileModes {
+		return mode
+	}
+	return fixMode(mode)
+}
+
+// defaultMode gives an archived file or directory whose mode has no
+// permissions the actor's FilePermissions or FolderPermissions.
+func (actor Actor) defaultMode(mode os.FileMode) os.FileMode {
+	if mode.Perm() != 0 {
+		return mode
+	}
+	if mode.IsDir() {
+		return mode | actor.folderPermissions()
+	}
+	return mode | actor.filePermissions()
+}
+
+func (actor Actor) filePermissions() os.FileMode {
+	if actor.FilePermissions == 0 {
+		return DefaultArchiveFilePermissions
+	}
+	return actor.FilePermissions.Perm()
+}
+
+func (actor Actor) folderPermissions() os.FileMode {
+	if actor.FolderPermissions == 0 {
+		return DefaultFolderPermissions
+	}
+	return actor.FolderPermissions.Perm()
+}
+
+// includedExtension returns true if IncludeExtensions is empty or the file
+// named filename ends with one of its extensions, ignoring case.
+func (actor Actor) includedExtension(filename string) bool {
+	if len(actor.IncludeExtensions) == 0 {
+		return true
+	}
 
-			resource.Size = archivedFile.FileInfo().Size()
-			resource.SHA1 = fmt.Sprintf("%x", hash.Sum(nil))
-			resource.Mode = info.Mode()
+	filename = strings.ToLower(filename)
+	for _, extension := range actor.IncludeExtensions {
+		if strings.HasSuffix(filename, "."+strings.ToLower(strings.TrimPrefix(extension, "."))) {
+			return true
 		}
-		resources = append(resources, resource)
 	}
-	return resources, nil
+	return false
 }
 
-// GatherDirectoryResources returns a list of resources for a directory.
-func (_ Actor) GatherDirectoryResources(sourceDir string) ([]Resource, error) {
-	var resources []Resource
-	walkErr := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+// skipHidden returns true if SkipHiddenFiles is set and name is a hidden
+// name that is not allowed by HiddenFilesAllowed.
+func (actor Actor) skipHidden(name string) bool {
+	if !actor.SkipHiddenFiles || !strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	allowed := actor.HiddenFilesAllowed
+	if allowed == nil {
+		allowed = []string{".profile", ".profile.d"}
+	}
+	for _, allowedName := range allowed {
+		if name == allowedName {
+			return false
 		}
+	}
+	return true
+}
 
-		relPath, err := filepath.Rel(sourceDir, path)
-		if err != nil {
-			return err
+// isUnreadableError returns true for errors caused by a single file or
+// directory that cannot be read, which GatherDirectoryResourcesWithReport
+// skips rather than failing on.
+func isUnreadableError(err error) bool {
+	switch err.(type) {
+	case *os.PathError, *os.LinkError, *os.SyscallError, SymlinkOutsideDirectoryError, UnsupportedFileTypeError:
+		return true
+	}
+	return false
+}
+
+// fileVanished returns true if err was caused by the file at path, or one of
+// its parent directories, having been deleted. Dangling symlinks, whose
+// target is missing but which still exist themselves, have not vanished.
+func fileVanished(path string, err error) bool {
+	if !os.IsNotExist(err) {
+		return false
+	}
+
+	_, statErr := os.Lstat(path)
+	return os.IsNotExist(statErr)
+}
+
+// checkFileSize returns a FileChangedError if the file at path in fsys is no
+// longer size bytes long.
+func checkFileSize(fsys fileSystem, path string, size int64) error {
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != size {
+		return FileChangedError{Filename: path, ExpectedSize: size, ActualSize: info.Size()}
+	}
+	return nil
+}
+
+// checksumReader returns the hex encoded checksums of reader's contents,
+// computing the SHA256 and sniffing the content type in the same pass when
+// GatherSHA256 and DetectContentType are enabled.
+func (actor Actor) checksumReader(ctx context.Context, reader io.Reader) (resourceChecksums, error) {
+	sum := actor.newResourceHash()
+	writers := []io.Writer{sum}
+	var sha256Sum hash.Hash
+	if actor.GatherSHA256 {
+		sha256Sum = sha256.New()
+		writers = append(writers, sha256Sum)
+	}
+	var sniffer *contentSniffer
+	if actor.DetectContentType {
+		sniffer = new(contentSniffer)
+		writers = append(writers, sniffer)
+	}
+
+	var writer io.Writer = sum
+	if len(writers) > 1 {
+		writer = io.MultiWriter(writers...)
+	}
+	_, err := actor.copy(writer, contextReader{ctx: ctx, reader: reader})
+	if err != nil {
+		return resourceChecksums{}, err
+	}
+
+	checksums := resourceChecksums{sha1: fmt.Sprintf("%x", sum.Sum(nil))}
+	if sha256Sum != nil {
+		checksums.sha256 = fmt.Sprintf("%x", sha256Sum.Sum(nil))
+	}
+	if sniffer != nil {
+		checksums.contentType = http.DetectContentType(sniffer.data)
+	}
+	return checksums, nil
+}
+
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+// contentSniffer keeps the first sniffLen bytes written to it.
+type contentSniffer struct {
+	data []byte
+}
+
+func (sniffer *contentSniffer) Write(p []byte) (int, error) {
+	if remaining := sniffLen - len(sniffer.data); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
 		}
+		sniffer.data = append(sniffer.data, p[:remaining]...)
+	}
+	return len(p), nil
+}
 
-		if relPath == "." {
-			return nil
+// newResourceHash returns the hash used to compute Resource.SHA1, falling
+// back to SHA1 when none has been configured.
+func (actor Actor) newResourceHash() hash.Hash {
+	if actor.NewResourceHash == nil {
+		return sha1.New()
+	}
+	return actor.NewResourceHash()
+}
+
+// CalculateResourcesSize returns the combined size of all the files in
+// resources. Directories do not count towards the total.
+func (_ Actor) CalculateResourcesSize(resources []Resource) int64 {
+	var total int64
+	for _, resource := range resources {
+		if !isDirectoryResource(resource) {
+			total += resource.Size
 		}
+	}
+	return total
+}
 
-		resource := Resource{
-			Filename: filepath.ToSlash(relPath),
+// isDirectoryResource returns true if the resource represents a directory.
+// Gathered directories have neither a mode nor a SHA1, while archived
+// directories end with a '/'.
+func isDirectoryResource(resource Resource) bool {
+	return resource.Mode.IsDir() ||
+		strings.HasSuffix(resource.Filename, "/") ||
+		(resource.Mode == 0 && resource.SHA1 == "")
+}
+
+// countResources returns the number of files and directories in resources.
+func countResources(resources []Resource) (int, int) {
+	var files, directories int
+	for _, resource := range resources {
+		if isDirectoryResource(resource) {
+			directories++
+		} else {
+			files++
 		}
+	}
+	return files, directories
+}
 
-		if !info.IsDir() {
-			resource.Size = info.Size()
-			resource.Mode = fixMode(info.Mode())
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
+// filterResources returns the files in resources that match one of the
+// include globs, along with the directories containing them.
+func filterResources(resources []Resource, include []string) []Resource {
+	if len(include) == 0 {
+		return resources
+	}
 
-			sum := sha1.New()
-			_, err = io.Copy(sum, file)
-			if err != nil {
-				return err
+	var globs [][]string
+	for _, pattern := range include {
+		globs = append(globs, strings.Split(strings.Trim(pattern, "/"), "/"))
+	}
+
+	matched := map[int]bool{}
+	matchedDirs := map[string]bool{}
+	for i, resource := range resources {
+		if isDirectoryResource(resource) {
+			continue
+		}
+
+		filename := strings.Trim(resource.Filename, "/")
+		for _, glob := range globs {
+			if matchSegments(glob, strings.Split(filename, "/")) {
+				matched[i] = true
+				for dir := filename; strings.Contains(dir, "/"); {
+					dir = dir[:strings.LastIndex(dir, "/")]
+					matchedDirs[dir] = true
+				}
+				break
 			}
-			resource.SHA1 = fmt.Sprintf("%x", sum.Sum(nil))
 		}
-		resources = append(resources, resource)
-		return nil
-	})
+	}
 
-	return resources, walkErr
+	var filtered []Resource
+	for i, resource := range resources {
+		if matched[i] || isDirectoryResource(resource) && matchedDirs[strings.Trim(resource.Filename, "/")] {
+			filtered = append(filtered, resource)
+		}
+	}
+	return filtered
 }
 
-// ZipDirectoryResources zips a directory and a sorted (based on full
-// path/filename) list of resources and returns the location. On Windows, the
-// filemode for user is forced to be readable and executable.
-func (actor Actor) ZipDirectoryResources(sourceDir string, filesToInclude []Resource) (string, error) {
-	log.WithField("sourceDir", sourceDir).Info("zipping source files")
-	zipFile, err := ioutil.TempFile("", "cf-cli-")
-	if err != nil {
-		return "", err
-	}
-	defer zipFile.Close()
+// sortResources returns a copy of resources sorted by Filename, so that the
+// same resources are always zipped in the same order.
+func sortResources(resources []Resource) []Resource {
+	sorted := make([]Resource, len(resources))
+	copy(sorted, resources)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Filename < sorted[j].Filename
+	})
+	return sorted
+}
 
-	writer := zip.NewWriter(zipFile)
-	defer writer.Close()
+// resourcesByFilename indexes resources by their Filename. When multiple
+// resources share a filename, the first one wins.
+func resourcesByFilename(resources []Resource) map[string]Resource {
+	index := make(map[string]Resource, len(resources))
+	for _, resource := range resources {
+		if _, ok := index[resource.Filename]; !ok {
+			index[resource.Filename] = resource
+		}
+	}
+	return index
+}
 
-	for _, resource := range filesToInclude {
-		fullPath := filepath.Join(sourceDir, resource.Filename)
-		log.WithField("fullPath", fullPath).Debug("zipping file")
-		err := actor.addFileToZip(fullPath, resource.Filename, resource.SHA1, writer)
+// archiveResourcesByName indexes resources by the name their Filename is
+// given when it is read from an archive, so that resources gathered before
+// archive names were cleaned, such as "/level1/tmpFile1", still match their
+// entries. When multiple resources share a name, the first one wins.
+func archiveResourcesByName(resources []Resource) map[string]Resource {
+	index := make(map[string]Resource, len(resources))
+	for _, resource := range resources {
+		name, err := sanitizeArchivePath(resource.Filename, isDirectoryResource(resource))
 		if err != nil {
-			log.WithField("fullPath", fullPath).Errorln("zipping file:", err)
-			return "", err
+			name = resource.Filename
+		}
+		if _, ok := index[name]; !ok {
+			index[name] = resource
 		}
 	}
-
-	log.WithFields(log.Fields{
-		"zip_file_location": zipFile.Name(),
-		"zipped_file_count": len(filesToInclude),
-	}).Info("zip file created")
-	return zipFile.Name(), nil
+	return index
 }
 
-func (_ Actor) actorToCCResources(resources []Resource) []ccv2.Resource {
+// ResourcesToCCResources converts resources into their Cloud Controller
+// representation. The result is never nil, since the Cloud Controller treats a
+// null list differently from an empty one.
+func (_ Actor) ResourcesToCCResources(resources []Resource) []ccv2.Resource {
 	apiResources := make([]ccv2.Resource, 0, len(resources)) // Explicitly done to prevent nils
 
 	for _, resource := range resources {
-		apiResources = append(apiResources, ccv2.Resource(resource))
+		apiResources = append(apiResources, ccv2.Resource{
+			Filename: resource.Filename,
+			Size:     resource.Size,
+			SHA1:     resource.SHA1,
+			Mode:     resource.Mode,
+		})
 	}
 
 	return apiResources
 }
 
-func (_ Actor) addFileToZip(srcPath string, destPath string, sha1Sum string, zipFile *zip.Writer) error {
-	srcFile, err := os.Open(srcPath)
+// CCResourcesToResources converts Cloud Controller resources into actor
+// resources. The result is never nil.
+func (_ Actor) CCResourcesToResources(apiResources []ccv2.Resource) []Resource {
+	resources := make([]Resource, 0, len(apiResources)) // Explicitly done to prevent nils
+
+	for _, apiResource := range apiResources {
+		resources = append(resources, Resource{
+			Filename: apiResource.Filename,
+			Size:     apiResource.Size,
+			SHA1:     apiResource.SHA1,
+			Mode:     apiResource.Mode,
+		})
+	}
+
+	return resources
+}
+
+func (actor Actor) addFileToZip(ctx context.Context, fsys fileSystem, srcPath string, destPath string, sha1Sum string, cache *zipContentCache, transform ZipTransformFunc, zipFile *zip.Writer) (int64, error) {
+	if _, onOS := fsys.(osFileSystem); onOS && actor.PreserveSymlinks {
+		linkInfo, err := os.Lstat(srcPath)
+		if err != nil {
+			actor.logger().WithField("srcPath", srcPath).Errorln("stat error in dir:", err)
+			return 0, err
+		}
+		if linkInfo.Mode()&os.ModeSymlink != 0 {
+			return actor.addSymlinkToZip(srcPath, destPath, sha1Sum, linkInfo, zipFile)
+		}
+	}
+
+	srcFile, err := fsys.Open(ctx, srcPath)
 	if err != nil {
-		log.WithField("srcPath", srcPath).Errorln("opening path in dir:", err)
-		return err
+		actor.logger().WithField("srcPath", srcPath).Errorln("opening path in dir:", err)
+		return 0, err
 	}
 	defer srcFile.Close()
 
 	fileInfo, err := srcFile.Stat()
 	if err != nil {
-		log.WithField("srcPath", srcPath).Errorln("stat error in dir:", err)
-		return err
+		actor.logger().WithField("srcPath", srcPath).Errorln("stat error in dir:", err)
+		return 0, err
+	}
+
+	header, err := actor.newZipFileHeader(srcPath, destPath, fileInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	// transformed contents may differ between copies of the same file
+	if !fileInfo.IsDir() && transform == nil && cache.has(sha1Sum) {
+		return actor.addCachedFileToZip(ctx, srcPath, srcFile, header, sha1Sum, cache, zipFile)
+	}
+
+	destFileWriter, err := zipFile.CreateHeader(header)
+	if err != nil {
+		actor.logger().Errorln("creating header:", err)
+		return 0, err
+	}
+
+	if fileInfo.IsDir() {
+		return 0, nil
+	}
+
+	sum := actor.newResourceHash()
+
+	var copied int64
+	if transform == nil {
+		multi := io.MultiWriter(sum, destFileWriter)
+		copied, err = actor.copy(multi, contextReader{ctx: ctx, reader: srcFile})
+	} else {
+		source := io.TeeReader(contextReader{ctx: ctx, reader: srcFile}, sum)
+		copied, err = actor.copyTransformed(destPath, transform, destFileWriter, source)
 	}
+	if err != nil {
+		actor.logger().WithField("srcPath", srcPath).Errorln("copying data in dir:", err)
+		return 0, err
+	}
+
+	actualSHA1 := fmt.Sprintf("%x", sum.Sum(nil))
+	if sha1Sum != actualSHA1 {
+		return 0, FileChangedError{Filename: srcPath, ExpectedSHA1: sha1Sum, ActualSHA1: actualSHA1}
+	}
+	return copied, nil
+}
 
+// newZipFileHeader returns the zip header used for the file at srcPath,
+// described by fileInfo, when it is stored as destPath.
+func (actor Actor) newZipFileHeader(srcPath string, destPath string, fileInfo os.FileInfo) (*zip.FileHeader, error) {
 	header, err := zip.FileInfoHeader(fileInfo)
 	if err != nil {
-		log.WithField("srcPath", srcPath).Errorln("getting file info in dir:", err)
-		return err
+		actor.logger().WithField("srcPath", srcPath).Errorln("getting file info in dir:", err)
+		return nil, err
 	}
 
 	// An extra '/' indicates that this file is a directory
@@ -181,35 +1638,100 @@ func (_ Actor) addFileToZip(srcPath string, destPath string, sha1Sum string, zip
 	}
 
 	header.Name = destPath
-	header.Method = zip.Deflate
+	header.Method = actor.zipMethod()
+	setNameEncoding(header)
 
-	mode := fixMode(fileInfo.Mode())
+	mode := actor.NormalizeMode(fileInfo.Mode())
 	header.SetMode(mode)
-	log.WithFields(log.Fields{
+	actor.setModified(header, fileInfo.ModTime())
+	actor.setOwner(header)
+	actor.logger().WithFields(log.Fields{
 		"srcPath":  srcPath,
 		"destPath": destPath,
 		"mode":     mode,
 	}).Debug("setting mode for file")
 
+	return header, nil
+}
+
+// contextReader fails reads once its context has been cancelled, allowing
+// long running copies to be interrupted.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// addArchiveEntryToZip copies entry into the zip, stored as destPath.
+func (actor Actor) addArchiveEntryToZip(entry archiveEntry, destPath string, resource Resource, zipFile *zip.Writer) error {
+	header, err := zip.FileInfoHeader(entry.info)
+	if err != nil {
+		actor.logger().WithField("archivedFile", entry.name).Errorln("getting file info in archive:", err)
+		return err
+	}
+
+	mode := entry.info.Mode()
+	if entry.info.IsDir() {
+		// An extra '/' indicates that this file is a directory
+		if !strings.HasSuffix(destPath, "/") {
+			destPath += "/"
+		}
+	} else {
+		header.Method = actor.zipMethod()
+		if resource.Mode != 0 {
+			mode = resource.Mode
+		}
+	}
+	mode = actor.defaultMode(mode)
+
+	header.Name = destPath
+	setNameEncoding(header)
+	header.SetMode(mode)
+	actor.setModified(header, entry.info.ModTime())
+	actor.setOwner(header)
+	actor.logger().WithFields(log.Fields{
+		"destPath": destPath,
+		"mode":     mode,
+	}).Debug("setting mode for archived file")
+
 	destFileWriter, err := zipFile.CreateHeader(header)
 	if err != nil {
-		log.Errorln("creating header:", err)
+		actor.logger().Errorln("creating header:", err)
 		return err
 	}
 
-	if !fileInfo.IsDir() {
-		sum := sha1.New()
+	if entry.info.IsDir() {
+		return nil
+	}
 
-		multi := io.MultiWriter(sum, destFileWriter)
-		if _, err := io.Copy(multi, srcFile); err != nil {
-			log.WithField("srcPath", srcPath).Errorln("copying data in dir:", err)
-			return err
-		}
+	srcFile, err := entry.open()
+	if err != nil {
+		actor.logger().WithField("archivedFile", entry.name).Errorln("opening file in archive:", err)
+		return err
+	}
+	defer srcFile.Close()
 
-		if sha1Sum != fmt.Sprintf("%x", sum.Sum(nil)) {
-			return FileChangedError{Filename: srcPath}
-		}
+	if resource.SHA1 == "" {
+		_, err = actor.copy(destFileWriter, srcFile)
+		return archiveEntryReadError(entry.name, err)
+	}
+
+	sum := actor.newResourceHash()
+	multi := io.MultiWriter(sum, destFileWriter)
+	if _, err := actor.copy(multi, srcFile); err != nil {
+		actor.logger().WithField("archivedFile", entry.name).Errorln("copying data in archive:", err)
+		return archiveEntryReadError(entry.name, err)
 	}
 
+	actualSHA1 := fmt.Sprintf("%x", sum.Sum(nil))
+	if resource.SHA1 != actualSHA1 {
+		return FileChangedError{Filename: entry.name, ExpectedSHA1: resource.SHA1, ActualSHA1: actualSHA1}
+	}
 	return nil
 }
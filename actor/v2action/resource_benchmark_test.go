@@ -0,0 +1,183 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+)
+
+func BenchmarkZipDirectoryResources(b *testing.B) {
+	b.Run("without deduplication", func(b *testing.B) {
+		benchmarkZipDuplicatedTree(b, false)
+	})
+	b.Run("with deduplication", func(b *testing.B) {
+		benchmarkZipDuplicatedTree(b, true)
+	})
+}
+
+// benchmarkZipDuplicatedTree zips a node_modules style tree where most files
+// are byte-identical copies of each other.
+func benchmarkZipDuplicatedTree(b *testing.B, deduplicate bool) {
+	srcDir, err := ioutil.TempDir("", "zip-benchmark")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	contents := []string{
+		strings.Repeat("module.exports = require('./lib');\n", 512),
+		strings.Repeat("The MIT License (MIT)\n", 256),
+	}
+	for i := 0; i < 200; i++ {
+		dir := filepath.Join(srcDir, "node_modules", fmt.Sprintf("package-%d", i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			b.Fatal(err)
+		}
+		for j, content := range contents {
+			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%d", j)), []byte(content), 0644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	actor := NewActor(nil, nil)
+	actor.ZipDeduplicate = deduplicate
+	resources, err := actor.GatherDirectoryResources(srcDir)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.StopTimer()
+		info, err := os.Stat(zipPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(info.Size()), "zip-bytes")
+		os.Remove(zipPath)
+		b.StartTimer()
+	}
+}
+
+func BenchmarkGatherDirectoryResources(b *testing.B) {
+	srcDir := createWideDeepTree(b)
+	defer os.RemoveAll(srcDir)
+
+	b.Run("walking with filepath.Walk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := filepath.Walk(srcDir, func(_ string, _ os.FileInfo, err error) error {
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("walking with filepath.WalkDir", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			err := filepath.WalkDir(srcDir, func(_ string, _ fs.DirEntry, err error) error {
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("gathering metadata", func(b *testing.B) {
+		actor := NewActor(nil, nil)
+		for i := 0; i < b.N; i++ {
+			if _, err := actor.GatherDirectoryResourcesMetadataOnly(srcDir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// createWideDeepTree creates a tree of many deeply nested directories, each
+// holding a few small files.
+func createWideDeepTree(b *testing.B) string {
+	srcDir, err := ioutil.TempDir("", "gather-benchmark")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(srcDir, fmt.Sprintf("package-%d", i))
+		for depth := 0; depth < 30; depth++ {
+			dir = filepath.Join(dir, fmt.Sprintf("level-%d", depth))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				b.Fatal(err)
+			}
+			for j := 0; j < 5; j++ {
+				if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("file-%d", j)), []byte("why hello"), 0644); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+	return srcDir
+}
+
+func BenchmarkGatherArchiveResourcesFromReader(b *testing.B) {
+	b.Run("with the default copy buffer", func(b *testing.B) {
+		benchmarkGatherHighLatencyArchive(b, 0)
+	})
+	b.Run("with a 1MB copy buffer", func(b *testing.B) {
+		benchmarkGatherHighLatencyArchive(b, 1<<20)
+	})
+}
+
+// benchmarkGatherHighLatencyArchive gathers an uncompressed archive through a
+// reader that waits before every read, like a file on a network file system.
+func benchmarkGatherHighLatencyArchive(b *testing.B, copyBufferSize int) {
+	buffer := new(bytes.Buffer)
+	writer := zip.NewWriter(buffer)
+	entry, err := writer.CreateHeader(&zip.FileHeader{Name: "large-file", Method: zip.Store})
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := entry.Write(bytes.Repeat([]byte("why hello"), 1<<20)); err != nil {
+		b.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	archive := highLatencyReaderAt{reader: bytes.NewReader(buffer.Bytes()), latency: 100 * time.Microsecond}
+
+	actor := NewActor(nil, nil)
+	actor.CopyBufferSize = copyBufferSize
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := actor.GatherArchiveResourcesFromReader(archive, int64(buffer.Len())); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type highLatencyReaderAt struct {
+	reader  io.ReaderAt
+	latency time.Duration
+}
+
+func (reader highLatencyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	time.Sleep(reader.latency)
+	return reader.reader.ReadAt(p, off)
+}
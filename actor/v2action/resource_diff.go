@@ -0,0 +1,56 @@
+package v2action
+
+// ResourceDiff describes how one list of resources differs from another.
+// Every list is sorted by Filename.
+type ResourceDiff struct {
+	// Added contains the resources that only exist in the new list.
+	Added []Resource
+	// Removed contains the resources that only exist in the old list.
+	Removed []Resource
+	// Modified contains the new version of resources whose SHA1 changed.
+	Modified []Resource
+	// ModeChanged contains the new version of resources whose contents are
+	// unchanged but whose Mode differs.
+	ModeChanged []Resource
+}
+
+// DiffResources compares oldResources with newResources by Filename. When a
+// filename is listed more than once, only its first occurrence is compared.
+func (_ Actor) DiffResources(oldResources []Resource, newResources []Resource) ResourceDiff {
+	oldByFilename := resourcesByFilename(oldResources)
+	newByFilename := resourcesByFilename(newResources)
+
+	var diff ResourceDiff
+	for _, newResource := range uniqueSortedResources(newResources) {
+		oldResource, ok := oldByFilename[newResource.Filename]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, newResource)
+		case oldResource.SHA1 != newResource.SHA1:
+			diff.Modified = append(diff.Modified, newResource)
+		case oldResource.Mode != newResource.Mode:
+			diff.ModeChanged = append(diff.ModeChanged, newResource)
+		}
+	}
+
+	for _, oldResource := range uniqueSortedResources(oldResources) {
+		if _, ok := newByFilename[oldResource.Filename]; !ok {
+			diff.Removed = append(diff.Removed, oldResource)
+		}
+	}
+
+	return diff
+}
+
+// uniqueSortedResources sorts resources by Filename and keeps only the first
+// occurrence of each filename.
+func uniqueSortedResources(resources []Resource) []Resource {
+	var unique []Resource
+	for _, resource := range sortResources(resources) {
+		if len(unique) > 0 && unique[len(unique)-1].Filename == resource.Filename {
+			continue
+		}
+		unique = append(unique, resource)
+	}
+	return unique
+}
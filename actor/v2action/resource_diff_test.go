@@ -0,0 +1,96 @@
+package v2action_test
+
+import (
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Diff Actions", func() {
+	var actor *Actor
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+	})
+
+	Describe("DiffResources", func() {
+		var (
+			oldResources []Resource
+			newResources []Resource
+			diff         ResourceDiff
+		)
+
+		BeforeEach(func() {
+			oldResources = []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+				{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+				{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0644},
+				{Filename: "file4", SHA1: "some-sha-4", Size: 4, Mode: 0644},
+			}
+			newResources = []Resource{
+				{Filename: "file5", SHA1: "some-sha-5", Size: 5, Mode: 0644},
+				{Filename: "level1"},
+				{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+				{Filename: "file2", SHA1: "some-other-sha-2", Size: 2, Mode: 0755},
+				{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+				{Filename: "file0", SHA1: "some-sha-0", Size: 0, Mode: 0644},
+			}
+		})
+
+		JustBeforeEach(func() {
+			diff = actor.DiffResources(oldResources, newResources)
+		})
+
+		It("returns the added resources sorted by filename", func() {
+			Expect(diff.Added).To(Equal([]Resource{
+				{Filename: "file0", SHA1: "some-sha-0", Size: 0, Mode: 0644},
+				{Filename: "file5", SHA1: "some-sha-5", Size: 5, Mode: 0644},
+			}))
+		})
+
+		It("returns the removed resources", func() {
+			Expect(diff.Removed).To(Equal([]Resource{
+				{Filename: "file4", SHA1: "some-sha-4", Size: 4, Mode: 0644},
+			}))
+		})
+
+		It("returns the new version of resources whose SHA1 changed", func() {
+			Expect(diff.Modified).To(Equal([]Resource{
+				{Filename: "file2", SHA1: "some-other-sha-2", Size: 2, Mode: 0755},
+			}))
+		})
+
+		It("returns resources whose mode changed separately", func() {
+			Expect(diff.ModeChanged).To(Equal([]Resource{
+				{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+			}))
+		})
+
+		Context("when a filename is listed more than once", func() {
+			BeforeEach(func() {
+				oldResources = []Resource{
+					{Filename: "file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+				}
+				newResources = []Resource{
+					{Filename: "file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+					{Filename: "file1", SHA1: "some-other-sha-1", Size: 1, Mode: 0644},
+				}
+			})
+
+			It("compares only the first occurrence", func() {
+				Expect(diff).To(Equal(ResourceDiff{}))
+			})
+		})
+
+		Context("when both lists are the same", func() {
+			BeforeEach(func() {
+				newResources = oldResources
+			})
+
+			It("returns an empty diff", func() {
+				Expect(diff).To(Equal(ResourceDiff{}))
+			})
+		})
+	})
+})
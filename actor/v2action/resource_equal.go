@@ -0,0 +1,36 @@
+package v2action
+
+// ResourcesContentEqual returns true if a and b describe the same files with
+// the same contents, regardless of order. Resources are compared by
+// Filename, SHA1 and Size; differences in mode alone, such as those left by
+// a round-trip through Windows, are ignored.
+func (_ Actor) ResourcesContentEqual(a []Resource, b []Resource) bool {
+	return resourcesEqual(a, b, func(x Resource, y Resource) bool {
+		return x.Filename == y.Filename && x.SHA1 == y.SHA1 && x.Size == y.Size
+	})
+}
+
+// ResourcesEqual returns true if a and b describe the same files with the
+// same contents and modes, regardless of order. Unlike
+// ResourcesContentEqual, a change in permissions alone makes them differ.
+func (_ Actor) ResourcesEqual(a []Resource, b []Resource) bool {
+	return resourcesEqual(a, b, func(x Resource, y Resource) bool {
+		return x.Filename == y.Filename && x.SHA1 == y.SHA1 && x.Size == y.Size && x.Mode == y.Mode
+	})
+}
+
+// resourcesEqual sorts a and b by filename and returns true if every pair of
+// resources satisfies equal.
+func resourcesEqual(a []Resource, b []Resource, equal func(Resource, Resource) bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	sortedA, sortedB := sortResources(a), sortResources(b)
+	for i := range sortedA {
+		if !equal(sortedA[i], sortedB[i]) {
+			return false
+		}
+	}
+	return true
+}
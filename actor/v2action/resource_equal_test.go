@@ -0,0 +1,79 @@
+package v2action_test
+
+import (
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Equality Actions", func() {
+	var (
+		actor *Actor
+
+		local []Resource
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		local = []Resource{
+			{Filename: "level1/", Mode: DefaultFolderPermissions},
+			{Filename: "level1/tmpFile1", SHA1: "some-sha-1", Size: 9, Mode: 0644},
+			{Filename: "tmpFile2", SHA1: "some-sha-2", Size: 12, Mode: 0751},
+		}
+	})
+
+	withChange := func(index int, change func(*Resource)) []Resource {
+		changed := make([]Resource, len(local))
+		copy(changed, local)
+		change(&changed[index])
+		return changed
+	}
+
+	DescribeTable("comparing resources",
+		func(remote func() []Resource, contentEqual bool, strictEqual bool) {
+			Expect(actor.ResourcesContentEqual(local, remote())).To(Equal(contentEqual))
+			Expect(actor.ResourcesContentEqual(remote(), local)).To(Equal(contentEqual))
+			Expect(actor.ResourcesEqual(local, remote())).To(Equal(strictEqual))
+			Expect(actor.ResourcesEqual(remote(), local)).To(Equal(strictEqual))
+		},
+
+		Entry("identical resources", func() []Resource { return withChange(0, func(*Resource) {}) }, true, true),
+		Entry("resources in a different order", func() []Resource { return []Resource{local[2], local[0], local[1]} }, true, true),
+		Entry("different file modes", func() []Resource {
+			return withChange(2, func(r *Resource) { r.Mode = 0666 })
+		}, true, false),
+		Entry("different directory modes", func() []Resource {
+			return withChange(0, func(r *Resource) { r.Mode = 0 })
+		}, true, false),
+		Entry("different SHA1s", func() []Resource {
+			return withChange(1, func(r *Resource) { r.SHA1 = "some-other-sha" })
+		}, false, false),
+		Entry("different sizes", func() []Resource {
+			return withChange(1, func(r *Resource) { r.Size = 10 })
+		}, false, false),
+		Entry("different filenames", func() []Resource {
+			return withChange(2, func(r *Resource) { r.Filename = "tmpFile3" })
+		}, false, false),
+		Entry("a missing resource", func() []Resource { return local[:2] }, false, false),
+		Entry("an extra resource", func() []Resource {
+			return append(withChange(0, func(*Resource) {}), Resource{Filename: "tmpFile3", SHA1: "some-sha-3", Size: 10, Mode: 0644})
+		}, false, false),
+		Entry("no resources", func() []Resource { return nil }, false, false),
+	)
+
+	It("treats empty and nil resources as equal", func() {
+		Expect(actor.ResourcesContentEqual(nil, []Resource{})).To(BeTrue())
+		Expect(actor.ResourcesEqual(nil, []Resource{})).To(BeTrue())
+	})
+
+	It("ignores fields other than filename, SHA1, size and mode", func() {
+		remote := withChange(1, func(r *Resource) {
+			r.SHA256 = "some-sha-256"
+			r.ContentType = "text/plain"
+		})
+		Expect(actor.ResourcesContentEqual(local, remote)).To(BeTrue())
+		Expect(actor.ResourcesEqual(local, remote)).To(BeTrue())
+	})
+})
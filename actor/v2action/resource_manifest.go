@@ -0,0 +1,60 @@
+package v2action
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// resourceManifestEntry is the JSON representation of a Resource used by
+// MarshalResources.
+type resourceManifestEntry struct {
+	Filename    string      `json:"filename"`
+	SHA1        string      `json:"sha1"`
+	SHA256      string      `json:"sha256,omitempty"`
+	ContentType string      `json:"content_type,omitempty"`
+	Size        int64       `json:"size"`
+	Mode        os.FileMode `json:"mode"`
+	Fingerprint string      `json:"fingerprint,omitempty"`
+}
+
+// MarshalResources returns a JSON manifest of the resources, sorted by
+// Filename so that the same resources always produce the same JSON. The
+// manifest can be persisted and read back with UnmarshalResources.
+func (_ Actor) MarshalResources(resources []Resource) ([]byte, error) {
+	entries := make([]resourceManifestEntry, 0, len(resources)) // Explicitly done to prevent nils
+	for _, resource := range sortResources(resources) {
+		entries = append(entries, resourceManifestEntry{
+			Filename:    resource.Filename,
+			SHA1:        resource.SHA1,
+			SHA256:      resource.SHA256,
+			ContentType: resource.ContentType,
+			Size:        resource.Size,
+			Mode:        resource.Mode,
+			Fingerprint: resource.Fingerprint,
+		})
+	}
+	return json.Marshal(entries)
+}
+
+// UnmarshalResources returns the resources stored in a JSON manifest written
+// by MarshalResources.
+func (_ Actor) UnmarshalResources(manifest []byte) ([]Resource, error) {
+	var entries []resourceManifestEntry
+	if err := json.Unmarshal(manifest, &entries); err != nil {
+		return nil, err
+	}
+
+	resources := make([]Resource, 0, len(entries))
+	for _, entry := range entries {
+		resources = append(resources, Resource{
+			Filename:    entry.Filename,
+			SHA1:        entry.SHA1,
+			SHA256:      entry.SHA256,
+			ContentType: entry.ContentType,
+			Size:        entry.Size,
+			Mode:        entry.Mode,
+			Fingerprint: entry.Fingerprint,
+		})
+	}
+	return resources, nil
+}
@@ -0,0 +1,72 @@
+package v2action_test
+
+import (
+	"os"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Manifest Actions", func() {
+	var (
+		actor     *Actor
+		resources []Resource
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+		resources = []Resource{
+			{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0644, Fingerprint: "some-fingerprint"},
+			{Filename: "level1", Mode: os.ModeDir | 0755},
+			{Filename: "level1/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", SHA256: "some-sha-256", Size: 9, Mode: 0600},
+		}
+	})
+
+	Describe("MarshalResources", func() {
+		It("returns the resources as JSON sorted by filename", func() {
+			manifest, err := actor.MarshalResources(resources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(manifest).To(MatchJSON(`[
+				{"filename": "level1", "sha1": "", "size": 0, "mode": 2147484141},
+				{"filename": "level1/tmpFile1", "sha1": "9e36efec86d571de3a38389ea799a796fe4782f4", "sha256": "some-sha-256", "size": 9, "mode": 384},
+				{"filename": "tmpFile2", "sha1": "e594bdc795bb293a0e55724137e53a36dc0d9e95", "size": 12, "mode": 420, "fingerprint": "some-fingerprint"}
+			]`))
+		})
+
+		It("returns the same JSON regardless of the order of the resources", func() {
+			manifest, err := actor.MarshalResources(resources)
+			Expect(err).ToNot(HaveOccurred())
+
+			reversed, err := actor.MarshalResources([]Resource{resources[2], resources[1], resources[0]})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reversed).To(Equal(manifest))
+		})
+
+		Context("when there are no resources", func() {
+			It("returns an empty JSON list", func() {
+				manifest, err := actor.MarshalResources(nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(manifest).To(MatchJSON(`[]`))
+			})
+		})
+	})
+
+	Describe("UnmarshalResources", func() {
+		It("returns the resources stored by MarshalResources", func() {
+			manifest, err := actor.MarshalResources(resources)
+			Expect(err).ToNot(HaveOccurred())
+
+			unmarshalled, err := actor.UnmarshalResources(manifest)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(unmarshalled).To(Equal([]Resource{resources[1], resources[2], resources[0]}))
+		})
+
+		Context("when the manifest is not valid JSON", func() {
+			It("returns an error", func() {
+				_, err := actor.UnmarshalResources([]byte("not json"))
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package v2action
+
+// DefaultResourceMatchBatchSize is the number of resources sent in each
+// resource match request when ResourceMatchBatchSize is not set. It keeps
+// requests below the Cloud Controller's request size limit.
+const DefaultResourceMatchBatchSize = 5000
+
+// ResourceMatchIncompleteError is returned by MatchResources when a resource
+// match request fails. Unknown lists the files in the failed request and in
+// any requests that were not sent, in the order they were provided, while
+// the matched and unmatched resources returned with the error are known.
+type ResourceMatchIncompleteError struct {
+	Err     error
+	Unknown []Resource
+}
+
+func (e ResourceMatchIncompleteError) Error() string {
+	return e.Err.Error()
+}
+
+type resourceFingerprint struct {
+	sha1 string
+	size int64
+}
+
+// MatchResources splits the provided resources into the ones already cached
+// by the Cloud Controller (matched) and the ones that still need to be
+// uploaded (unmatched). Only files are sent for matching, directories are
+// always unmatched. Files are sent in batches of ResourceMatchBatchSize.
+// Both lists keep the order of the provided resources.
+func (actor Actor) MatchResources(resources []Resource) ([]Resource, []Resource, Warnings, error) {
+	var filesToMatch []Resource
+	for _, resource := range resources {
+		if resource.SHA1 != "" {
+			filesToMatch = append(filesToMatch, resource)
+		}
+	}
+
+	var (
+		allWarnings         Warnings
+		matchErr            error
+		matchedFingerprints = map[resourceFingerprint]bool{}
+		answered            = len(filesToMatch)
+	)
+	batchSize := actor.resourceMatchBatchSize()
+	for start := 0; start < len(filesToMatch); start += batchSize {
+		end := start + batchSize
+		if end > len(filesToMatch) {
+			end = len(filesToMatch)
+		}
+
+		matchedCCResources, warnings, err := actor.CloudControllerClient.ResourceMatch(actor.ResourcesToCCResources(filesToMatch[start:end]))
+		allWarnings = append(allWarnings, warnings...)
+		if err != nil {
+			matchErr = ResourceMatchIncompleteError{Err: err, Unknown: filesToMatch[start:]}
+			answered = start
+			break
+		}
+
+		for _, resource := range matchedCCResources {
+			matchedFingerprints[resourceFingerprint{sha1: resource.SHA1, size: resource.Size}] = true
+		}
+	}
+
+	var matched, unmatched []Resource
+	files := 0
+	for _, resource := range resources {
+		if resource.SHA1 == "" {
+			unmatched = append(unmatched, resource)
+			continue
+		}
+
+		files++
+		if files > answered {
+			continue
+		}
+		if matchedFingerprints[resourceFingerprint{sha1: resource.SHA1, size: resource.Size}] {
+			matched = append(matched, resource)
+		} else {
+			unmatched = append(unmatched, resource)
+		}
+	}
+
+	return matched, unmatched, allWarnings, matchErr
+}
+
+func (actor Actor) resourceMatchBatchSize() int {
+	if actor.ResourceMatchBatchSize <= 0 {
+		return DefaultResourceMatchBatchSize
+	}
+	return actor.ResourceMatchBatchSize
+}
@@ -0,0 +1,205 @@
+package v2action_test
+
+import (
+	"errors"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	"code.cloudfoundry.org/cli/actor/v2action/v2actionfakes"
+	"code.cloudfoundry.org/cli/api/cloudcontroller/ccv2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Match Actions", func() {
+	var (
+		actor                     *Actor
+		fakeCloudControllerClient *v2actionfakes.FakeCloudControllerClient
+	)
+
+	BeforeEach(func() {
+		fakeCloudControllerClient = new(v2actionfakes.FakeCloudControllerClient)
+		actor = NewActor(fakeCloudControllerClient, nil)
+	})
+
+	Describe("MatchResources", func() {
+		var (
+			resources []Resource
+
+			matched    []Resource
+			unmatched  []Resource
+			warnings   Warnings
+			executeErr error
+		)
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+				{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+				{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+			}
+		})
+
+		JustBeforeEach(func() {
+			matched, unmatched, warnings, executeErr = actor.MatchResources(resources)
+		})
+
+		Context("when the CC API client does not return any errors", func() {
+			BeforeEach(func() {
+				fakeCloudControllerClient.ResourceMatchReturns(
+					[]ccv2.Resource{
+						{SHA1: "some-sha-1", Size: 1},
+						{SHA1: "some-sha-3", Size: 3},
+					},
+					ccv2.Warnings{"resource-match-warning"},
+					nil,
+				)
+			})
+
+			It("only sends files to be matched", func() {
+				Expect(fakeCloudControllerClient.ResourceMatchCallCount()).To(Equal(1))
+				Expect(fakeCloudControllerClient.ResourceMatchArgsForCall(0)).To(Equal([]ccv2.Resource{
+					{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+					{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+					{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+				}))
+			})
+
+			It("returns the matched and unmatched resources and all warnings", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(warnings).To(ConsistOf("resource-match-warning"))
+				Expect(matched).To(Equal([]Resource{
+					{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+					{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+				}))
+				Expect(unmatched).To(Equal([]Resource{
+					{Filename: "level1"},
+					{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+				}))
+			})
+		})
+
+		Context("when a matched SHA1 has a different size", func() {
+			BeforeEach(func() {
+				fakeCloudControllerClient.ResourceMatchReturns(
+					[]ccv2.Resource{{SHA1: "some-sha-2", Size: 200}},
+					nil,
+					nil,
+				)
+			})
+
+			It("does not consider the resource matched", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(matched).To(BeEmpty())
+				Expect(unmatched).To(Equal(resources))
+			})
+		})
+
+		Context("when there are no files to match", func() {
+			BeforeEach(func() {
+				resources = []Resource{{Filename: "level1"}}
+			})
+
+			It("does not call the CC API", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(fakeCloudControllerClient.ResourceMatchCallCount()).To(Equal(0))
+				Expect(matched).To(BeEmpty())
+				Expect(unmatched).To(Equal(resources))
+			})
+		})
+
+		Context("when the CC API client returns an error", func() {
+			BeforeEach(func() {
+				fakeCloudControllerClient.ResourceMatchReturns(
+					nil,
+					ccv2.Warnings{"resource-match-warning"},
+					errors.New("resource-match-error"),
+				)
+			})
+
+			It("returns the error and warnings", func() {
+				Expect(executeErr).To(MatchError("resource-match-error"))
+				Expect(warnings).To(ConsistOf("resource-match-warning"))
+			})
+
+			It("reports every file as unknown", func() {
+				Expect(executeErr).To(Equal(ResourceMatchIncompleteError{
+					Err:     errors.New("resource-match-error"),
+					Unknown: resources[1:],
+				}))
+				Expect(matched).To(BeEmpty())
+				Expect(unmatched).To(Equal([]Resource{{Filename: "level1"}}))
+			})
+		})
+
+		Context("when there are more files than the batch size", func() {
+			BeforeEach(func() {
+				actor.ResourceMatchBatchSize = 2
+
+				fakeCloudControllerClient.ResourceMatchStub = func(resourcesToMatch []ccv2.Resource) ([]ccv2.Resource, ccv2.Warnings, error) {
+					var matched []ccv2.Resource
+					for _, resource := range resourcesToMatch {
+						if resource.SHA1 != "some-sha-2" {
+							matched = append(matched, ccv2.Resource{SHA1: resource.SHA1, Size: resource.Size})
+						}
+					}
+					return matched, ccv2.Warnings{resourcesToMatch[0].SHA1 + "-warning"}, nil
+				}
+			})
+
+			It("matches the files in batches", func() {
+				Expect(fakeCloudControllerClient.ResourceMatchCallCount()).To(Equal(2))
+				Expect(fakeCloudControllerClient.ResourceMatchArgsForCall(0)).To(Equal([]ccv2.Resource{
+					{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+					{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+				}))
+				Expect(fakeCloudControllerClient.ResourceMatchArgsForCall(1)).To(Equal([]ccv2.Resource{
+					{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+				}))
+			})
+
+			It("merges the responses in order", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(warnings).To(Equal(Warnings{"some-sha-1-warning", "some-sha-3-warning"}))
+				Expect(matched).To(Equal([]Resource{
+					{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+					{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+				}))
+				Expect(unmatched).To(Equal([]Resource{
+					{Filename: "level1"},
+					{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+				}))
+			})
+
+			Context("when a later batch fails", func() {
+				BeforeEach(func() {
+					resources = append(resources, Resource{Filename: "file4", SHA1: "some-sha-4", Size: 4, Mode: 0644})
+					fakeCloudControllerClient.ResourceMatchStub = nil
+					fakeCloudControllerClient.ResourceMatchReturnsOnCall(0, []ccv2.Resource{{SHA1: "some-sha-1", Size: 1}}, ccv2.Warnings{"some-sha-1-warning"}, nil)
+					fakeCloudControllerClient.ResourceMatchReturnsOnCall(1, nil, ccv2.Warnings{"batch-2-warning"}, errors.New("resource-match-error"))
+				})
+
+				It("returns the resources matched before the failure", func() {
+					Expect(matched).To(Equal([]Resource{
+						{Filename: "level1/file1", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+					}))
+					Expect(unmatched).To(Equal([]Resource{
+						{Filename: "level1"},
+						{Filename: "file2", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+					}))
+					Expect(warnings).To(Equal(Warnings{"some-sha-1-warning", "batch-2-warning"}))
+				})
+
+				It("reports the files in the failed batch as unknown", func() {
+					Expect(executeErr).To(Equal(ResourceMatchIncompleteError{
+						Err: errors.New("resource-match-error"),
+						Unknown: []Resource{
+							{Filename: "file3", SHA1: "some-sha-3", Size: 3, Mode: 0755},
+							{Filename: "file4", SHA1: "some-sha-4", Size: 4, Mode: 0644},
+						},
+					}))
+				})
+			})
+		})
+	})
+})
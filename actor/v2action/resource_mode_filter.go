@@ -0,0 +1,34 @@
+package v2action
+
+import "os"
+
+// FilterResourcesByMode returns the resources whose mode satisfies
+// predicate, in their original order. Directories gathered from a directory
+// have no mode, so predicate is given os.ModeDir for every directory
+// resource that lacks it.
+func (_ Actor) FilterResourcesByMode(resources []Resource, predicate func(os.FileMode) bool) []Resource {
+	var filtered []Resource
+	for _, resource := range resources {
+		mode := resource.Mode
+		if isDirectoryResource(resource) {
+			mode |= os.ModeDir
+		}
+
+		if predicate(mode) {
+			filtered = append(filtered, resource)
+		}
+	}
+	return filtered
+}
+
+// IsExecutable returns true if mode describes a file that can be executed by
+// its owner, group or others. It can be passed to FilterResourcesByMode.
+func IsExecutable(mode os.FileMode) bool {
+	return !mode.IsDir() && mode.Perm()&0111 != 0
+}
+
+// IsDirectory returns true if mode describes a directory. It can be passed to
+// FilterResourcesByMode.
+func IsDirectory(mode os.FileMode) bool {
+	return mode.IsDir()
+}
@@ -0,0 +1,61 @@
+package v2action_test
+
+import (
+	"os"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Mode Filter Actions", func() {
+	var (
+		actor     *Actor
+		resources []Resource
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+		resources = []Resource{
+			{Filename: "bin"},
+			{Filename: "bin/run", SHA1: "some-sha-1", Size: 1, Mode: 0755},
+			{Filename: "bin/run.conf", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+			{Filename: "archived/", Mode: os.ModeDir | 0755},
+			{Filename: "archived/group-run", SHA1: "some-sha-3", Size: 3, Mode: 0610},
+			{Filename: "link", SHA1: "some-sha-1", Size: 1, Mode: os.ModeSymlink | 0755},
+		}
+	})
+
+	Describe("FilterResourcesByMode", func() {
+		It("returns the resources matching the predicate in order", func() {
+			Expect(actor.FilterResourcesByMode(resources, func(mode os.FileMode) bool {
+				return mode.Perm() == 0644
+			})).To(Equal([]Resource{
+				{Filename: "bin/run.conf", SHA1: "some-sha-2", Size: 2, Mode: 0644},
+			}))
+		})
+
+		It("returns nothing when no resource matches", func() {
+			Expect(actor.FilterResourcesByMode(resources, func(os.FileMode) bool { return false })).To(BeEmpty())
+		})
+
+		Context("when filtering executables", func() {
+			It("returns the files executable by anyone", func() {
+				Expect(actor.FilterResourcesByMode(resources, IsExecutable)).To(Equal([]Resource{
+					{Filename: "bin/run", SHA1: "some-sha-1", Size: 1, Mode: 0755},
+					{Filename: "archived/group-run", SHA1: "some-sha-3", Size: 3, Mode: 0610},
+					{Filename: "link", SHA1: "some-sha-1", Size: 1, Mode: os.ModeSymlink | 0755},
+				}))
+			})
+		})
+
+		Context("when filtering directories", func() {
+			It("returns the directories, including the ones without a mode", func() {
+				Expect(actor.FilterResourcesByMode(resources, IsDirectory)).To(Equal([]Resource{
+					{Filename: "bin"},
+					{Filename: "archived/", Mode: os.ModeDir | 0755},
+				}))
+			})
+		})
+	})
+})
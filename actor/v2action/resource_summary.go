@@ -0,0 +1,71 @@
+package v2action
+
+import (
+	"path"
+	"sort"
+	"strings"
+)
+
+// ResourceSummary breaks a list of resources down by file extension, to spot
+// large assets that were included by accident. TotalSize is the combined
+// Size of the files; directories have no size of their own. Extensions are
+// sorted by TotalSize, largest first, then by Extension.
+type ResourceSummary struct {
+	FileCount      int
+	DirectoryCount int
+	TotalSize      int64
+	Extensions     []ExtensionSummary
+}
+
+// ExtensionSummary counts the files of a ResourceSummary that share an
+// extension. Extension is lower case and includes the leading '.', such as
+// ".jar"; files without an extension, including hidden files such as
+// .profile, are grouped under the empty Extension.
+type ExtensionSummary struct {
+	Extension string
+	FileCount int
+	TotalSize int64
+}
+
+// SummarizeResources returns the number of files and directories in
+// resources and groups the files by extension.
+func (_ Actor) SummarizeResources(resources []Resource) ResourceSummary {
+	var summary ResourceSummary
+	byExtension := map[string]*ExtensionSummary{}
+	for _, resource := range resources {
+		if isDirectoryResource(resource) {
+			summary.DirectoryCount++
+			continue
+		}
+
+		summary.FileCount++
+		summary.TotalSize += resource.Size
+
+		extension := resourceExtension(resource.Filename)
+		extensionSummary, ok := byExtension[extension]
+		if !ok {
+			extensionSummary = &ExtensionSummary{Extension: extension}
+			byExtension[extension] = extensionSummary
+		}
+		extensionSummary.FileCount++
+		extensionSummary.TotalSize += resource.Size
+	}
+
+	for _, extensionSummary := range byExtension {
+		summary.Extensions = append(summary.Extensions, *extensionSummary)
+	}
+	sort.Slice(summary.Extensions, func(i, j int) bool {
+		if summary.Extensions[i].TotalSize != summary.Extensions[j].TotalSize {
+			return summary.Extensions[i].TotalSize > summary.Extensions[j].TotalSize
+		}
+		return summary.Extensions[i].Extension < summary.Extensions[j].Extension
+	})
+	return summary
+}
+
+// resourceExtension returns the lower case extension of the slash separated
+// filename, ignoring the leading '.' of hidden files.
+func resourceExtension(filename string) string {
+	name := strings.TrimPrefix(path.Base(filename), ".")
+	return strings.ToLower(path.Ext(name))
+}
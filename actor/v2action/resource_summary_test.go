@@ -0,0 +1,63 @@
+package v2action_test
+
+import (
+	"os"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resource Summary Actions", func() {
+	var actor *Actor
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+	})
+
+	Describe("SummarizeResources", func() {
+		It("groups the files by extension, largest first", func() {
+			summary := actor.SummarizeResources([]Resource{
+				{Filename: "assets", Mode: os.ModeDir | 0755},
+				{Filename: "assets/logo.PNG", SHA1: "some-sha-1", Size: 300, Mode: 0644},
+				{Filename: "assets/photo.png", SHA1: "some-sha-2", Size: 700, Mode: 0644},
+				{Filename: "lib/", Mode: DefaultFolderPermissions},
+				{Filename: "lib/app.jar", SHA1: "some-sha-3", Size: 400, Mode: 0644},
+				{Filename: "lib/other.jar", SHA1: "some-sha-4", Size: 600, Mode: 0644},
+				{Filename: "Procfile", SHA1: "some-sha-5", Size: 20, Mode: 0644},
+				{Filename: "archive.tar.gz", SHA1: "some-sha-6", Size: 50, Mode: 0644},
+				{Filename: "empty"},
+			})
+
+			Expect(summary).To(Equal(ResourceSummary{
+				FileCount:      6,
+				DirectoryCount: 3,
+				TotalSize:      2070,
+				Extensions: []ExtensionSummary{
+					{Extension: ".jar", FileCount: 2, TotalSize: 1000},
+					{Extension: ".png", FileCount: 2, TotalSize: 1000},
+					{Extension: ".gz", FileCount: 1, TotalSize: 50},
+					{Extension: "", FileCount: 1, TotalSize: 20},
+				},
+			}))
+		})
+
+		It("returns an empty summary for no resources", func() {
+			Expect(actor.SummarizeResources(nil)).To(Equal(ResourceSummary{}))
+		})
+
+		DescribeTable("extensions",
+			func(filename string, extension string) {
+				summary := actor.SummarizeResources([]Resource{{Filename: filename, SHA1: "some-sha", Size: 1, Mode: 0644}})
+				Expect(summary.Extensions).To(Equal([]ExtensionSummary{{Extension: extension, FileCount: 1, TotalSize: 1}}))
+			},
+			Entry("with an extension", "lib/app.jar", ".jar"),
+			Entry("with an upper case extension", "lib/App.JAR", ".jar"),
+			Entry("without an extension", "bin/run", ""),
+			Entry("with a dotted directory", "lib.d/run", ""),
+			Entry("for a hidden file", ".profile", ""),
+			Entry("for a hidden file with an extension", ".env.local", ".local"),
+		)
+	})
+})
@@ -2,15 +2,35 @@ package v2action_test
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	. "code.cloudfoundry.org/cli/actor/v2action"
 	"code.cloudfoundry.org/cli/actor/v2action/v2actionfakes"
+	"code.cloudfoundry.org/cli/api/cloudcontroller/ccv2"
 	"code.cloudfoundry.org/ykk"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 )
 
 var _ = Describe("Resource Actions", func() {
@@ -46,84 +66,3250 @@ var _ = Describe("Resource Actions", func() {
 		Expect(os.RemoveAll(srcDir)).ToNot(HaveOccurred())
 	})
 
+	Describe("CalculateResourcesSize", func() {
+		It("returns the combined size of the files", func() {
+			size := actor.CalculateResourcesSize([]Resource{
+				{Filename: "level1", Size: 4096},
+				{Filename: "/archived-dir/", Size: 4096, Mode: os.ModeDir | 0755},
+				{Filename: "level1/tmpFile1", SHA1: "some-sha-1", Size: 9, Mode: 0644},
+				{Filename: "tmpFile2", SHA1: "some-sha-2", Size: 12, Mode: 0751},
+				{Filename: "empty-file", SHA1: "da39a3ee5e6b4b0d3255bfef95601890afd80709", Mode: 0644},
+			})
+			Expect(size).To(BeEquivalentTo(21))
+		})
+
+		It("returns zero when there are no resources", func() {
+			Expect(actor.CalculateResourcesSize(nil)).To(BeZero())
+		})
+	})
+
 	Describe("GatherArchiveResources", func() {
 		// tests are under resource_unix_test.go and resource_windows_test.go
+
+		Context("when the file is not a valid archive", func() {
+			var textFile string
+
+			BeforeEach(func() {
+				textFile = filepath.Join(srcDir, "tmpFile2")
+			})
+
+			It("returns an InvalidArchiveError", func() {
+				_, err := actor.GatherArchiveResources(textFile)
+				Expect(err).To(MatchError(InvalidArchiveError{Path: textFile}))
+			})
+		})
+
+		Context("when ModeOverrides are set", func() {
+			var archivePath string
+
+			BeforeEach(func() {
+				archivePath = filepath.Join(srcDir, "windows.zip")
+				file, err := os.Create(archivePath)
+				Expect(err).ToNot(HaveOccurred())
+				defer file.Close()
+
+				writer := zip.NewWriter(file)
+				for _, name := range []string{"bin/start", "bin/debug", "bin/lib/helper", "README"} {
+					header := &zip.FileHeader{Name: name}
+					header.SetMode(0)
+					entry, err := writer.CreateHeader(header)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = entry.Write([]byte(name))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(writer.Close()).To(Succeed())
+
+				actor.ModeOverrides = []ModeOverride{
+					{Pattern: "bin/*", Mode: 0755},
+					{Pattern: "bin/debug", Mode: 0700},
+				}
+			})
+
+			It("replaces the modes of matching files, letting the last pattern win", func() {
+				resources, err := actor.GatherArchiveResources(archivePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				modes := map[string]os.FileMode{}
+				for _, resource := range resources {
+					modes[resource.Filename] = resource.Mode
+				}
+				Expect(modes).To(Equal(map[string]os.FileMode{
+					"bin/start":      0755,
+					"bin/debug":      0700,
+					"bin/lib/helper": DefaultArchiveFilePermissions,
+					"README":         DefaultArchiveFilePermissions,
+				}))
+			})
+
+			It("zips the matching files with their overridden modes", func() {
+				resources, err := actor.GatherArchiveResources(archivePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				resultZip, err := actor.ZipArchiveResources(archivePath, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(resultZip)
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(findZipFile(reader.File, "bin/start").Mode()).To(Equal(os.FileMode(0755)))
+			})
+		})
+
+		Context("when the archive stores directory modes", func() {
+			var archivePath string
+
+			BeforeEach(func() {
+				archivePath = filepath.Join(srcDir, "directories.zip")
+				file, err := os.Create(archivePath)
+				Expect(err).ToNot(HaveOccurred())
+				defer file.Close()
+
+				writer := zip.NewWriter(file)
+				for name, mode := range map[string]os.FileMode{
+					"private/": os.ModeDir | 0700,
+					"shared/":  os.ModeDir | 0775,
+					"nomode/":  os.ModeDir,
+				} {
+					header := &zip.FileHeader{Name: name}
+					header.SetMode(mode)
+					_, err := writer.CreateHeader(header)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				// written without a Unix mode, like zips made on Windows
+				_, err = writer.Create("dos/")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+			})
+
+			directoryModes := func() map[string]os.FileMode {
+				resources, err := actor.GatherArchiveResources(archivePath)
+				Expect(err).ToNot(HaveOccurred())
+
+				modes := map[string]os.FileMode{}
+				for _, resource := range resources {
+					modes[resource.Filename] = resource.Mode
+				}
+				return modes
+			}
+
+			It("keeps the archived modes, defaulting those without permissions", func() {
+				Expect(directoryModes()).To(Equal(map[string]os.FileMode{
+					"private/": os.ModeDir | 0700,
+					"shared/":  os.ModeDir | 0775,
+					"nomode/":  os.ModeDir | DefaultFolderPermissions,
+					"dos/":     os.ModeDir | DefaultFolderPermissions,
+				}))
+			})
+
+			Context("when FolderPermissions is set", func() {
+				BeforeEach(func() {
+					actor.FolderPermissions = 0711
+				})
+
+				It("uses them as the default", func() {
+					modes := directoryModes()
+					Expect(modes["private/"]).To(Equal(os.ModeDir | 0700))
+					Expect(modes["nomode/"]).To(Equal(os.ModeDir | 0711))
+					Expect(modes["dos/"]).To(Equal(os.ModeDir | 0711))
+				})
+			})
+		})
+	})
+
+	Describe("GatherResources", func() {
+		Context("when the path is a directory", func() {
+			It("gathers the directory's resources", func() {
+				resources, err := actor.GatherResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				expectedResources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(Equal(expectedResources))
+			})
+		})
+
+		Context("when the path is an archive", func() {
+			var archive string
+
+			BeforeEach(func() {
+				tmpfile, err := ioutil.TempFile("", "gather-resources-test")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tmpfile.Close()).To(Succeed())
+				archive = tmpfile.Name()
+
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(archive)).To(Succeed())
+			})
+
+			It("gathers the archive's resources", func() {
+				resources, err := actor.GatherResources(archive)
+				Expect(err).ToNot(HaveOccurred())
+
+				expectedResources, err := actor.GatherArchiveResources(archive)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(Equal(expectedResources))
+			})
+		})
+
+		Context("when the path is a file that is not an archive", func() {
+			It("returns an InvalidArchiveError", func() {
+				textFile := filepath.Join(srcDir, "tmpFile2")
+				_, err := actor.GatherResources(textFile)
+				Expect(err).To(MatchError(InvalidArchiveError{Path: textFile}))
+			})
+		})
+
+		Context("when the path does not exist", func() {
+			It("returns the error", func() {
+				_, err := actor.GatherResources(filepath.Join(srcDir, "missing"))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("archive entry names", func() {
+		var archive *bytes.Reader
+
+		zipWithEntry := func(name string) *bytes.Reader {
+			buffer := new(bytes.Buffer)
+			writer := zip.NewWriter(buffer)
+			fileWriter, err := writer.Create(name)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = fileWriter.Write([]byte("why hello"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			return bytes.NewReader(buffer.Bytes())
+		}
+
+		DescribeTable("when an entry leads outside of the archive",
+			func(name string) {
+				archive = zipWithEntry(name)
+				_, err := actor.GatherArchiveResourcesFromReader(archive, archive.Size())
+				Expect(err).To(MatchError(UnsafeArchivePathError{Name: name}))
+			},
+
+			Entry("parent directory", "../../etc/passwd"),
+			Entry("parent directory after a subdirectory", "level1/../../passwd"),
+			Entry("backslashed parent directory", `..\..\etc\passwd`),
+			Entry("drive letter", `C:\Windows\system.ini`),
+			Entry("UNC path", `\\server\share\passwd`),
+		)
+
+		DescribeTable("when an entry stays inside of the archive",
+			func(name string, expectedFilename string) {
+				archive = zipWithEntry(name)
+				resources, err := actor.GatherArchiveResourcesFromReader(archive, archive.Size())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(1))
+				Expect(resources[0].Filename).To(Equal(expectedFilename))
+			},
+
+			Entry("relative path", "level1/tmpFile1", "level1/tmpFile1"),
+			Entry("rooted path", "/level1/tmpFile1", "level1/tmpFile1"),
+			Entry("absolute path", "/etc/passwd", "etc/passwd"),
+			Entry("parent directory within the archive", "level1/../tmpFile1", "tmpFile1"),
+			Entry("current directory", "level1/./tmpFile1", "level1/tmpFile1"),
+			Entry("backslashes", `level1\tmpFile1`, "level1/tmpFile1"),
+		)
+
+		Context("when repackaging an archive with an entry outside of it", func() {
+			var (
+				archivePath string
+				tempDir     string
+			)
+
+			BeforeEach(func() {
+				var err error
+				tempDir, err = ioutil.TempDir("", "unsafe-archive-zip")
+				Expect(err).ToNot(HaveOccurred())
+				actor.ZipTempDir = tempDir
+
+				archivePath = filepath.Join(srcDir, "archive.zip")
+				contents, err := ioutil.ReadAll(zipWithEntry("../../etc/passwd"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ioutil.WriteFile(archivePath, contents, 0600)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(tempDir)).To(Succeed())
+			})
+
+			It("returns an UnsafeArchivePathError and removes the zip", func() {
+				zipPath, err := actor.ZipArchiveResources(archivePath, nil)
+				Expect(err).To(MatchError(UnsafeArchivePathError{Name: "../../etc/passwd"}))
+				Expect(zipPath).To(BeEmpty())
+
+				files, err := ioutil.ReadDir(tempDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(files).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("gzipped files", func() {
+		var (
+			gzipped     []byte
+			archivePath string
+		)
+
+		BeforeEach(func() {
+			buffer := new(bytes.Buffer)
+			writer := gzip.NewWriter(buffer)
+			writer.Name = "binary"
+			_, err := writer.Write([]byte(strings.Repeat("why hello", 1000)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			gzipped = buffer.Bytes()
+
+			archivePath = filepath.Join(srcDir, "app.gz")
+		})
+
+		JustBeforeEach(func() {
+			Expect(ioutil.WriteFile(archivePath, gzipped, 0600)).To(Succeed())
+		})
+
+		It("gathers the file named after the archive", func() {
+			resources, err := actor.GatherArchiveResources(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(Equal([]Resource{{
+				Filename: "app",
+				SHA1:     fmt.Sprintf("%x", sha1.Sum([]byte(strings.Repeat("why hello", 1000)))),
+				Size:     9000,
+				Mode:     DefaultArchiveFilePermissions,
+			}}))
+		})
+
+		It("gathers the file named after the gzip header when reading from a reader", func() {
+			resources, err := actor.GatherArchiveResourcesFromReader(bytes.NewReader(gzipped), int64(len(gzipped)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(HaveLen(1))
+			Expect(resources[0].Filename).To(Equal("binary"))
+		})
+
+		It("zips the decompressed file", func() {
+			resultZip, err := actor.ZipArchiveResources(archivePath, nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(resultZip)
+
+			reader, err := zip.OpenReader(resultZip)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			Expect(reader.File).To(HaveLen(1))
+			Expect(reader.File[0].Name).To(Equal("app"))
+			expectFileContentsToEqual(reader.File[0], strings.Repeat("why hello", 1000))
+		})
+
+		Context("when the gzip stream does not match its CRC32", func() {
+			BeforeEach(func() {
+				gzipped[len(gzipped)-8] ^= 0xff
+			})
+
+			It("returns a CorruptArchiveEntryError", func() {
+				_, err := actor.GatherArchiveResources(archivePath)
+				Expect(err).To(MatchError(CorruptArchiveEntryError{Name: "app"}))
+			})
+		})
+
+		Context("when the gzip stream is truncated", func() {
+			BeforeEach(func() {
+				gzipped = gzipped[:len(gzipped)/2]
+			})
+
+			It("returns a TruncatedArchiveError", func() {
+				_, err := actor.GatherArchiveResources(archivePath)
+				Expect(err).To(MatchError(TruncatedArchiveError{Name: "app"}))
+			})
+		})
+	})
+
+	Describe("ResourcesToCCResources", func() {
+		It("converts resources and back without losing anything", func() {
+			resources := []Resource{
+				{Filename: "level1", Mode: os.ModeDir | 0755},
+				{Filename: "level1/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0644},
+			}
+
+			apiResources := actor.ResourcesToCCResources(resources)
+			Expect(apiResources).To(Equal([]ccv2.Resource{
+				{Filename: "level1", Mode: os.ModeDir | 0755},
+				{Filename: "level1/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0644},
+			}))
+			Expect(actor.CCResourcesToResources(apiResources)).To(Equal(resources))
+		})
+
+		It("returns empty, non-nil lists when given nothing", func() {
+			apiResources := actor.ResourcesToCCResources(nil)
+			Expect(apiResources).ToNot(BeNil())
+			Expect(apiResources).To(BeEmpty())
+
+			resources := actor.CCResourcesToResources(nil)
+			Expect(resources).ToNot(BeNil())
+			Expect(resources).To(BeEmpty())
+		})
+	})
+
+	Describe("GatherResourcesFromMap", func() {
+		It("gathers a sorted list of resources for the files", func() {
+			resources := actor.GatherResourcesFromMap(map[string][]byte{
+				"tmpFile2":               []byte("Hello, Binky"),
+				"level1/level2/tmpFile1": []byte("why hello"),
+			})
+
+			Expect(resources).To(Equal([]Resource{
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: DefaultArchiveFilePermissions},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: DefaultArchiveFilePermissions},
+			}))
+		})
+
+		Context("when the actor's FilePermissions is set", func() {
+			BeforeEach(func() {
+				actor.FilePermissions = 0644
+			})
+
+			It("gives the files the actor's permissions", func() {
+				resources := actor.GatherResourcesFromMap(map[string][]byte{
+					"tmpFile2": []byte("Hello, Binky"),
+				})
+				Expect(resources[0].Mode).To(Equal(os.FileMode(0644)))
+			})
+		})
+
+		Context("when no files are provided", func() {
+			It("returns no resources", func() {
+				Expect(actor.GatherResourcesFromMap(nil)).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("GatherArchiveResourcesFromReader", func() {
+		Context("when the reader contains a zip archive", func() {
+			var archive *bytes.Reader
+
+			BeforeEach(func() {
+				buffer := new(bytes.Buffer)
+				writer := zip.NewWriter(buffer)
+				_, err := writer.Create("level1/")
+				Expect(err).ToNot(HaveOccurred())
+				fileWriter, err := writer.Create("level1/tmpFile1")
+				Expect(err).ToNot(HaveOccurred())
+				_, err = fileWriter.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+
+				archive = bytes.NewReader(buffer.Bytes())
+			})
+
+			It("gathers a list of all files in the archive", func() {
+				resources, err := actor.GatherArchiveResourcesFromReader(archive, archive.Size())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(2))
+				Expect(resources[0].Filename).To(Equal("level1/"))
+				Expect(resources[1].Filename).To(Equal("level1/tmpFile1"))
+				Expect(resources[1].SHA1).To(Equal("9e36efec86d571de3a38389ea799a796fe4782f4"))
+				Expect(resources[1].Size).To(BeEquivalentTo(9))
+			})
+		})
+
+		Context("when the entry names were written by a Windows zipper", func() {
+			var archive *bytes.Reader
+
+			BeforeEach(func() {
+				archive = bytes.NewReader(windowsZipper())
+			})
+
+			It("decodes CP437 names and strips byte order marks", func() {
+				resources, err := actor.GatherArchiveResourcesFromReader(archive, archive.Size())
+				Expect(err).ToNot(HaveOccurred())
+
+				var filenames []string
+				for _, resource := range resources {
+					filenames = append(filenames, resource.Filename)
+				}
+				Expect(filenames).To(Equal([]string{
+					"café/",
+					"café/menü.txt",
+					"naïve.txt",
+					"readme.txt",
+					"日本.txt",
+				}))
+			})
+		})
+
+		Context("when an entry's contents do not match its CRC32", func() {
+			var corrupted []byte
+
+			BeforeEach(func() {
+				buffer := new(bytes.Buffer)
+				writer := zip.NewWriter(buffer)
+				fileWriter, err := writer.CreateHeader(&zip.FileHeader{Name: "level1/tmpFile1", Method: zip.Store})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = fileWriter.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+
+				corrupted = bytes.Replace(buffer.Bytes(), []byte("why hello"), []byte("why jello"), 1)
+			})
+
+			It("returns a CorruptArchiveEntryError", func() {
+				_, err := actor.GatherArchiveResourcesFromReader(bytes.NewReader(corrupted), int64(len(corrupted)))
+				Expect(err).To(MatchError(CorruptArchiveEntryError{Name: "level1/tmpFile1"}))
+			})
+		})
+
+		Context("when the reader does not contain a valid archive", func() {
+			It("returns an InvalidArchiveError", func() {
+				archive := bytes.NewReader([]byte("Hello, Binky"))
+				_, err := actor.GatherArchiveResourcesFromReader(archive, archive.Size())
+				Expect(err).To(MatchError(InvalidArchiveError{}))
+			})
+		})
+
+		Context("when the size is not positive", func() {
+			It("returns an InvalidArchiveError", func() {
+				archive := bytes.NewReader([]byte("Hello, Binky"))
+				_, err := actor.GatherArchiveResourcesFromReader(archive, -1)
+				Expect(err).To(MatchError(InvalidArchiveError{}))
+
+				_, err = actor.GatherArchiveResourcesFromReader(archive, 0)
+				Expect(err).To(MatchError(InvalidArchiveError{}))
+			})
+		})
+
+		Context("when an entry's size overflows", func() {
+			var archive []byte
+
+			BeforeEach(func() {
+				buffer := new(bytes.Buffer)
+				writer := zip.NewWriter(buffer)
+				fileWriter, err := writer.CreateRaw(&zip.FileHeader{
+					Name:               "tmpFile1",
+					Method:             zip.Store,
+					CompressedSize64:   9,
+					UncompressedSize64: 1 << 63,
+				})
+				Expect(err).ToNot(HaveOccurred())
+				_, err = fileWriter.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+
+				archive = buffer.Bytes()
+			})
+
+			It("returns an InvalidArchiveError", func() {
+				_, err := actor.GatherArchiveResourcesFromReader(bytes.NewReader(archive), int64(len(archive)))
+				Expect(err).To(MatchError(InvalidArchiveError{}))
+			})
+		})
 	})
 
 	Describe("GatherDirectoryResources", func() {
 		// tests are under resource_unix_test.go and resource_windows_test.go
+
+		Context("when a .cfignore file exists", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(filepath.Join(srcDir, ".cfignore"), []byte("# comment\ntmpFile2\nlevel2/\n"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("excludes the ignored paths", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{".cfignore", "level1", "tmpFile3"}))
+			})
+		})
+
+		Context("when walk order differs from sorted order", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(filepath.Join(srcDir, "level1.txt"), []byte("walked after level1/"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("returns the resources sorted by filename", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					"level1",
+					"level1.txt",
+					"level1/level2",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+			})
+		})
+
+		Context("when the directory contains the actor's temp directory", func() {
+			var tempDir string
+
+			BeforeEach(func() {
+				tempDir = filepath.Join(srcDir, "tmp")
+				Expect(os.Mkdir(tempDir, 0700)).To(Succeed())
+				actor.ZipTempDir = tempDir
+
+				err := ioutil.WriteFile(filepath.Join(tempDir, "cf-cli-notmine"), []byte("other"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+				err = ioutil.WriteFile(filepath.Join(srcDir, "level1", "cf-cli-notes.txt"), []byte("keep me"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("leaves out temporary zips, including ones written while gathering", func() {
+				zipPath, err := actor.ZipDirectoryResources(srcDir, []Resource{
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(filepath.Dir(zipPath)).To(Equal(tempDir))
+
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					"level1",
+					"level1/cf-cli-notes.txt",
+					"level1/level2",
+					"level1/level2/tmpFile1",
+					"tmp",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+			})
+
+			It("keeps files with the same prefix in other directories", func() {
+				actor.ZipTempDir = ""
+
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(ContainElement("tmp/cf-cli-notmine"))
+			})
+		})
+	})
+
+	Describe("NewResourceHash", func() {
+		BeforeEach(func() {
+			actor.NewResourceHash = sha256.New
+		})
+
+		It("uses the configured hash when gathering and zipping resources", func() {
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(HaveLen(5))
+			Expect(resources[2].SHA1).To(Equal("0bb7f6fa0036189151c39d889b88dab923e739fbe876ed9f7a557509a6b5aa9a"))
+			Expect(resources[3].SHA1).To(Equal("3bb8146c8acb7cfd46dd88b62fc219ac68cdc78c70e0933b2cac706551c397e1"))
+			Expect(resources[4].SHA1).To(Equal("b7bded2845d4745d8b888757394e608d5304096e21e7e1ac85bedde7b1737274"))
+
+			zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.RemoveAll(zipPath)).To(Succeed())
+		})
+
+		Context("when the actor has no hash configured", func() {
+			BeforeEach(func() {
+				actor = &Actor{}
+			})
+
+			It("defaults to SHA1", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources[3].SHA1).To(Equal("e594bdc795bb293a0e55724137e53a36dc0d9e95"))
+			})
+		})
+	})
+
+	Describe("GatherSHA256", func() {
+		It("leaves SHA256 empty by default", func() {
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			for _, resource := range resources {
+				Expect(resource.SHA256).To(BeEmpty())
+			}
+		})
+
+		Context("when enabled", func() {
+			BeforeEach(func() {
+				actor.GatherSHA256 = true
+			})
+
+			It("computes the SHA256 alongside the SHA1 of gathered directory files", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources[3].Filename).To(Equal("tmpFile2"))
+				Expect(resources[3].SHA1).To(Equal("e594bdc795bb293a0e55724137e53a36dc0d9e95"))
+				Expect(resources[3].SHA256).To(Equal("3bb8146c8acb7cfd46dd88b62fc219ac68cdc78c70e0933b2cac706551c397e1"))
+				Expect(resources[0].SHA256).To(BeEmpty())
+			})
+
+			It("computes the SHA256 of archived files", func() {
+				resources := actor.GatherResourcesFromMap(map[string][]byte{"tmpFile2": []byte("Hello, Binky")})
+				Expect(resources[0].SHA256).To(Equal("3bb8146c8acb7cfd46dd88b62fc219ac68cdc78c70e0933b2cac706551c397e1"))
+
+				archiveFile, err := ioutil.TempFile("", "sha256-archive")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(archiveFile.Close()).To(Succeed())
+				archive := archiveFile.Name()
+				defer os.Remove(archive)
+
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+				archiveResources, err := actor.GatherArchiveResources(archive)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(findResource(archiveResources, "tmpFile2").SHA256).To(Equal("3bb8146c8acb7cfd46dd88b62fc219ac68cdc78c70e0933b2cac706551c397e1"))
+			})
+
+			It("hashes files again when their cached checksums have no SHA256", func() {
+				cacheDir, err := ioutil.TempDir("", "checksum-cache")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(cacheDir)
+				actor.ChecksumCacheDir = cacheDir
+
+				actor.GatherSHA256 = false
+				_, err = actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				actor.GatherSHA256 = true
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources[3].SHA256).To(Equal("3bb8146c8acb7cfd46dd88b62fc219ac68cdc78c70e0933b2cac706551c397e1"))
+			})
+		})
+	})
+
+	Describe("DetectContentType", func() {
+		var pngHeader []byte
+
+		BeforeEach(func() {
+			pngHeader = []byte("\x89PNG\r\n\x1a\n")
+			Expect(ioutil.WriteFile(filepath.Join(srcDir, "level1", "image"), pngHeader, 0600)).To(Succeed())
+		})
+
+		It("leaves ContentType empty by default", func() {
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			for _, resource := range resources {
+				Expect(resource.ContentType).To(BeEmpty())
+			}
+		})
+
+		Context("when enabled", func() {
+			BeforeEach(func() {
+				actor.DetectContentType = true
+			})
+
+			It("detects the content type of gathered directory files", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(findResource(resources, "level1").ContentType).To(BeEmpty())
+				Expect(findResource(resources, "level1/image").ContentType).To(Equal("image/png"))
+				Expect(findResource(resources, "tmpFile2").ContentType).To(Equal("text/plain; charset=utf-8"))
+			})
+
+			It("only sniffs the start of large files", func() {
+				contents := append(bytes.Repeat([]byte("Hello, Binky "), 50), pngHeader...)
+				resources := actor.GatherResourcesFromMap(map[string][]byte{"large": contents})
+				Expect(resources[0].ContentType).To(Equal("text/plain; charset=utf-8"))
+				Expect(resources[0].SHA1).To(Equal(fmt.Sprintf("%x", sha1.Sum(contents))))
+			})
+
+			It("detects the content type of archived files", func() {
+				archiveFile, err := ioutil.TempFile("", "content-type-archive")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(archiveFile.Close()).To(Succeed())
+				archive := archiveFile.Name()
+				defer os.Remove(archive)
+
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+				resources, err := actor.GatherArchiveResources(archive)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(findResource(resources, "level1/").ContentType).To(BeEmpty())
+				Expect(findResource(resources, "level1/image").ContentType).To(Equal("image/png"))
+			})
+
+			It("hashes files again when their cached checksums have no content type", func() {
+				cacheDir, err := ioutil.TempDir("", "checksum-cache")
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(cacheDir)
+				actor.ChecksumCacheDir = cacheDir
+
+				actor.DetectContentType = false
+				_, err = actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				actor.DetectContentType = true
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(findResource(resources, "level1/image").ContentType).To(Equal("image/png"))
+			})
+		})
+	})
+
+	Describe("HashWorkers", func() {
+		BeforeEach(func() {
+			for i := 0; i < 50; i++ {
+				err := ioutil.WriteFile(filepath.Join(srcDir, "level1", fmt.Sprintf("file%02d", i)), []byte(fmt.Sprint("contents ", i)), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+
+		It("returns the same resources in the same order regardless of the number of workers", func() {
+			actor.HashWorkers = 1
+			serialResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serialResources).To(HaveLen(55))
+
+			actor.HashWorkers = 8
+			parallelResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parallelResources).To(Equal(serialResources))
+
+			for _, resource := range parallelResources {
+				if resource.Filename != "level1" && resource.Filename != "level1/level2" {
+					Expect(resource.SHA1).ToNot(BeEmpty())
+				}
+			}
+		})
+	})
+
+	Describe("CopyBufferSize", func() {
+		It("gathers and zips the same contents with a small copy buffer", func() {
+			expectedResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			actor.CopyBufferSize = 3
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(Equal(expectedResources))
+
+			zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			expectFileContentsToEqual(findZipFile(reader.File, "level1/level2/tmpFile1"), "why hello")
+		})
+	})
+
+	Describe("GatherStrict", func() {
+		BeforeEach(func() {
+			actor.HashWorkers = 1
+
+			// tmpFile3 is the third file hashed; rewrite it after it has been
+			// stat'd but before it is hashed
+			var hashes int
+			actor.NewResourceHash = func() hash.Hash {
+				hashes++
+				if hashes == 3 {
+					err := ioutil.WriteFile(filepath.Join(srcDir, "tmpFile3"), []byte("Bananarama, Bananarama"), 0600)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				return sha1.New()
+			}
+		})
+
+		Context("when strict gathering is disabled", func() {
+			It("records the size from before the file changed", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources[4].Filename).To(Equal("tmpFile3"))
+				Expect(resources[4].Size).To(BeEquivalentTo(10))
+			})
+		})
+
+		Context("when strict gathering is enabled", func() {
+			BeforeEach(func() {
+				actor.GatherStrict = true
+			})
+
+			It("returns a FileChangedError", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(FileChangedError{
+					Filename:     filepath.Join(srcDir, "tmpFile3"),
+					ExpectedSize: 10,
+					ActualSize:   22,
+				}))
+			})
+		})
+	})
+
+	Describe("SkipVanishedFiles", func() {
+		var vanishedPath string
+
+		BeforeEach(func() {
+			actor.HashWorkers = 1
+			vanishedPath = filepath.Join(srcDir, "tmpFile3")
+
+			// delete tmpFile3 while the first file is being hashed, before
+			// tmpFile3 has been hashed
+			var hashes int
+			actor.NewResourceHash = func() hash.Hash {
+				hashes++
+				if hashes == 1 {
+					Expect(os.Remove(vanishedPath)).To(Succeed())
+				}
+				return sha1.New()
+			}
+		})
+
+		Context("when vanished files are not skipped", func() {
+			It("returns the error", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Context("when vanished files are skipped", func() {
+			BeforeEach(func() {
+				actor.SkipVanishedFiles = true
+			})
+
+			It("leaves the vanished file out of the resources", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					"level1",
+					"level1/level2",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+				}))
+			})
+
+			It("lists the vanished file separately from the skipped files in the report", func() {
+				report, err := actor.GatherDirectoryResourcesWithReport(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(report.Skipped).To(BeEmpty())
+				Expect(report.Vanished).To(HaveLen(1))
+				Expect(report.Vanished[0].Path).To(Equal(vanishedPath))
+				Expect(os.IsNotExist(report.Vanished[0].Err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("ChecksumCacheDir", func() {
+		var (
+			cacheDir string
+			hashes   int32
+		)
+
+		BeforeEach(func() {
+			var err error
+			cacheDir, err = ioutil.TempDir("", "checksum-cache")
+			Expect(err).ToNot(HaveOccurred())
+			actor.ChecksumCacheDir = cacheDir
+
+			hashes = 0
+			actor.NewResourceHash = func() hash.Hash {
+				atomic.AddInt32(&hashes, 1)
+				return sha1.New()
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(cacheDir)).To(Succeed())
+		})
+
+		It("does not hash files again when they are unchanged", func() {
+			firstResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(atomic.LoadInt32(&hashes)).To(BeEquivalentTo(3))
+			Expect(filepath.Join(cacheDir, ChecksumCacheFilename)).To(BeARegularFile())
+
+			secondResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(atomic.LoadInt32(&hashes)).To(BeEquivalentTo(3))
+			Expect(secondResources).To(Equal(firstResources))
+		})
+
+		Context("when a file changes between gathers", func() {
+			It("hashes the changed file again", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = ioutil.WriteFile(filepath.Join(srcDir, "tmpFile3"), []byte("Hello, Binky"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(atomic.LoadInt32(&hashes)).To(BeEquivalentTo(4))
+				Expect(resources[4].Filename).To(Equal("tmpFile3"))
+				Expect(resources[4].SHA1).To(Equal("e594bdc795bb293a0e55724137e53a36dc0d9e95"))
+			})
+		})
+
+		Context("when the cache file is corrupt", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(filepath.Join(cacheDir, ChecksumCacheFilename), []byte("not json"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			It("hashes every file", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(atomic.LoadInt32(&hashes)).To(BeEquivalentTo(3))
+				Expect(resources[2].SHA1).To(Equal("9e36efec86d571de3a38389ea799a796fe4782f4"))
+			})
+		})
+	})
+
+	Describe("SkipEmptyFiles", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(filepath.Join(srcDir, "level1", "emptyFile"), nil, 0600)
+			Expect(err).ToNot(HaveOccurred())
+			err = os.MkdirAll(filepath.Join(srcDir, "emptyDir"), 0777)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when empty files are not skipped", func() {
+			It("gathers the empty files", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(ContainElement("level1/emptyFile"))
+			})
+		})
+
+		Context("when empty files are skipped", func() {
+			BeforeEach(func() {
+				actor.SkipEmptyFiles = true
+			})
+
+			It("leaves the empty files out of the resources and the zip", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					"emptyDir",
+					"level1",
+					"level1/level2",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{
+					"emptyDir/",
+					"level1/",
+					"level1/level2/",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+			})
+		})
+	})
+
+	Describe("IncludeExtensions", func() {
+		BeforeEach(func() {
+			for name, contents := range map[string]string{
+				"Main.CLASS":            "main class",
+				"level1/Helper.class":   "helper class",
+				"level1/level2/dep.jar": "dependency",
+				"level1/notes.md":       "notes",
+				"level1/jar":            "not a jar",
+				"ignored.jar":           "ignored jar",
+			} {
+				err := ioutil.WriteFile(filepath.Join(srcDir, name), []byte(contents), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			err := ioutil.WriteFile(filepath.Join(srcDir, ".cfignore"), []byte("ignored.jar\n"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when no extensions are set", func() {
+			It("gathers every file", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(ContainElement("level1/notes.md"))
+				Expect(resourceFilenames(resources)).To(ContainElement("tmpFile2"))
+			})
+		})
+
+		Context("when extensions are set", func() {
+			BeforeEach(func() {
+				actor.IncludeExtensions = []string{".class", "JAR"}
+			})
+
+			It("only gathers and zips the matching files that are not ignored", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					"Main.CLASS",
+					"level1",
+					"level1/Helper.class",
+					"level1/level2",
+					"level1/level2/dep.jar",
+				}))
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{
+					"Main.CLASS",
+					"level1/",
+					"level1/Helper.class",
+					"level1/level2/",
+					"level1/level2/dep.jar",
+				}))
+			})
+		})
+	})
+
+	Describe("SkipHiddenFiles", func() {
+		BeforeEach(func() {
+			err := os.MkdirAll(filepath.Join(srcDir, ".git", "objects"), 0777)
+			Expect(err).ToNot(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(srcDir, ".git", "HEAD"), []byte("ref: refs/heads/master"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(srcDir, "level1", ".DS_Store"), []byte("finder"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+			err = ioutil.WriteFile(filepath.Join(srcDir, ".profile"), []byte("export PATH"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when hidden files are not skipped", func() {
+			It("gathers the hidden files", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(ContainElement(".git/HEAD"))
+				Expect(resourceFilenames(resources)).To(ContainElement("level1/.DS_Store"))
+			})
+		})
+
+		Context("when hidden files are skipped", func() {
+			BeforeEach(func() {
+				actor.SkipHiddenFiles = true
+			})
+
+			It("leaves hidden files and directories out, except .profile", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{
+					".profile",
+					"level1",
+					"level1/level2",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+			})
+
+			Context("when HiddenFilesAllowed is set", func() {
+				BeforeEach(func() {
+					actor.HiddenFilesAllowed = []string{".DS_Store"}
+				})
+
+				It("keeps only the allowed hidden names", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resourceFilenames(resources)).To(ContainElement("level1/.DS_Store"))
+					Expect(resourceFilenames(resources)).ToNot(ContainElement(".profile"))
+				})
+			})
+
+			Context("when .cfignore ignores an allowed hidden file", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(filepath.Join(srcDir, ".cfignore"), []byte(".profile\n"), 0600)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("leaves it out", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resourceFilenames(resources)).ToNot(ContainElement(".profile"))
+				})
+			})
+		})
+	})
+
+	Describe("MaxFileSize", func() {
+		Context("when no file exceeds the limit", func() {
+			BeforeEach(func() {
+				actor.MaxFileSize = 12
+			})
+
+			It("gathers the resources", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(5))
+			})
+		})
+
+		Context("when a file exceeds the limit", func() {
+			BeforeEach(func() {
+				actor.MaxFileSize = 11
+			})
+
+			It("returns a FileTooLargeError", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(FileTooLargeError{
+					Filename: filepath.Join(srcDir, "tmpFile2"),
+					Size:     12,
+					Limit:    11,
+				}))
+			})
+		})
+	})
+
+	Describe("MaxDirectoryDepth", func() {
+		Context("when no file is nested deeper than the limit", func() {
+			BeforeEach(func() {
+				actor.MaxDirectoryDepth = 3
+			})
+
+			It("gathers the resources", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/level2", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"}))
+			})
+		})
+
+		Context("when a file is nested deeper than the limit", func() {
+			BeforeEach(func() {
+				actor.MaxDirectoryDepth = 2
+			})
+
+			It("returns a PathTooDeepError", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(PathTooDeepError{
+					Path:  filepath.Join(srcDir, "level1", "level2", "tmpFile1"),
+					Limit: 2,
+				}))
+			})
+
+			Context("when the deeper directory is ignored", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(filepath.Join(srcDir, ".cfignore"), []byte("level2/\n"), 0600)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("gathers the resources", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resourceFilenames(resources)).To(Equal([]string{".cfignore", "level1", "tmpFile2", "tmpFile3"}))
+				})
+			})
+		})
+
+		Context("when the limit is not set", func() {
+			It("defaults to DefaultMaxDirectoryDepth", func() {
+				deepDir := srcDir
+				for i := 0; i <= DefaultMaxDirectoryDepth; i++ {
+					deepDir = filepath.Join(deepDir, "d")
+				}
+				Expect(os.MkdirAll(deepDir, 0700)).To(Succeed())
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(PathTooDeepError{
+					Path:  deepDir,
+					Limit: DefaultMaxDirectoryDepth,
+				}))
+			})
+		})
+	})
+
+	Describe("FileReadTimeout", func() {
+		var stalledWriter *os.File
+
+		BeforeEach(func() {
+			actor.FileReadTimeout = time.Minute
+
+			// nothing is ever written to the pipe, so reading it never returns
+			var stalledReader *os.File
+			var err error
+			stalledReader, stalledWriter, err = os.Pipe()
+			Expect(err).ToNot(HaveOccurred())
+
+			actor.OpenFile = func(name string) (*os.File, error) {
+				if filepath.Base(name) == "tmpFile2" {
+					return stalledReader, nil
+				}
+				return os.Open(name)
+			}
+		})
+
+		AfterEach(func() {
+			Expect(stalledWriter.Close()).To(Succeed())
+		})
+
+		Context("when every file is read within the timeout", func() {
+			BeforeEach(func() {
+				actor.OpenFile = nil
+			})
+
+			It("gathers the resources", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(5))
+			})
+		})
+
+		Context("when reading a file takes longer than the timeout", func() {
+			BeforeEach(func() {
+				actor.FileReadTimeout = 50 * time.Millisecond
+			})
+
+			It("returns a FileReadTimeoutError", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(FileReadTimeoutError{Filename: filepath.Join(srcDir, "tmpFile2")}))
+			})
+		})
+
+		Context("when the context is cancelled while a read is stalled", func() {
+			It("returns the context's error", func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+
+				_, err := actor.GatherDirectoryResourcesWithContext(ctx, srcDir)
+				Expect(err).To(MatchError(context.DeadlineExceeded))
+			})
+		})
+	})
+
+	Describe("HashProgress", func() {
+		type hashReport struct {
+			filename    string
+			bytesHashed int64
+			totalBytes  int64
+		}
+
+		var (
+			reportsMutex sync.Mutex
+			reports      []hashReport
+		)
+
+		BeforeEach(func() {
+			reports = nil
+			actor.HashProgress = func(filename string, bytesHashed int64, totalBytes int64) {
+				reportsMutex.Lock()
+				defer reportsMutex.Unlock()
+				reports = append(reports, hashReport{filename: filename, bytesHashed: bytesHashed, totalBytes: totalBytes})
+			}
+
+			largeFile := bytes.Repeat([]byte("why hello "), 900*1024)
+			err := ioutil.WriteFile(filepath.Join(srcDir, "largeFile"), largeFile, 0600)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		Context("when no file exceeds the default threshold", func() {
+			It("does not report any progress", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reports).To(BeEmpty())
+			})
+		})
+
+		Context("when only large files exceed the threshold", func() {
+			BeforeEach(func() {
+				actor.HashProgressThreshold = 1 << 20
+			})
+
+			It("periodically reports the progress of hashing them", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				largeFile := filepath.Join(srcDir, "largeFile")
+				Expect(reports).To(Equal([]hashReport{
+					{filename: largeFile, bytesHashed: 4 << 20, totalBytes: 9216000},
+					{filename: largeFile, bytesHashed: 8 << 20, totalBytes: 9216000},
+					{filename: largeFile, bytesHashed: 9216000, totalBytes: 9216000},
+				}))
+			})
+		})
+
+		Context("when HashProgressThreshold is lowered", func() {
+			BeforeEach(func() {
+				actor.HashProgressThreshold = 12
+			})
+
+			It("also reports the smaller files above it once they are hashed", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(reports).To(ContainElement(hashReport{filename: filepath.Join(srcDir, "tmpFile2"), bytesHashed: 12, totalBytes: 12}))
+				for _, report := range reports {
+					Expect(report.filename).ToNot(Equal(filepath.Join(srcDir, "tmpFile3")))
+				}
+			})
+		})
+	})
+
+	Describe("GatherDirectoryResourcesMetadataOnly", func() {
+		It("returns the same resources as GatherDirectoryResources without hashing any file", func() {
+			expectedResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			for i := range expectedResources {
+				expectedResources[i].SHA1 = ""
+			}
+
+			var hashes int32
+			actor.NewResourceHash = func() hash.Hash {
+				atomic.AddInt32(&hashes, 1)
+				return sha1.New()
+			}
+
+			resources, err := actor.GatherDirectoryResourcesMetadataOnly(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(Equal(expectedResources))
+			Expect(resources).To(ContainElement(Resource{
+				Filename: "tmpFile2",
+				Size:     12,
+				Mode:     actor.NormalizeMode(0600),
+			}))
+			Expect(atomic.LoadInt32(&hashes)).To(BeZero())
+		})
+	})
+
+	Describe("WalkResources", func() {
+		It("calls fn with the same resources GatherDirectoryResources returns", func() {
+			expectedResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			var resources []Resource
+			err = actor.WalkResources(srcDir, func(resource Resource) error {
+				resources = append(resources, resource)
+				return nil
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(ConsistOf(expectedResources))
+		})
+
+		It("stops walking when fn returns an error", func() {
+			stopErr := errors.New("stop walking")
+
+			var calls int
+			err := actor.WalkResources(srcDir, func(Resource) error {
+				calls++
+				return stopErr
+			})
+			Expect(err).To(MatchError(stopErr))
+			Expect(calls).To(Equal(1))
+		})
+	})
+
+	Describe("GatherDirectoryResourcesWithContext", func() {
+		Context("when the context is active", func() {
+			It("gathers the resources", func() {
+				resources, err := actor.GatherDirectoryResourcesWithContext(context.Background(), srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(HaveLen(5))
+			})
+		})
+
+		Context("when the context is cancelled", func() {
+			It("returns the context's error", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				resources, err := actor.GatherDirectoryResourcesWithContext(ctx, srcDir)
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(resources).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("GatherDirectoryResourcesWithIgnore", func() {
+		var (
+			ignorePatterns []string
+			resources      []Resource
+			executeErr     error
+		)
+
+		JustBeforeEach(func() {
+			resources, executeErr = actor.GatherDirectoryResourcesWithIgnore(srcDir, ignorePatterns)
+		})
+
+		Context("when no patterns are provided", func() {
+			BeforeEach(func() {
+				ignorePatterns = nil
+			})
+
+			It("gathers all the files", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/level2", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"}))
+			})
+		})
+
+		Context("when a glob pattern is provided", func() {
+			BeforeEach(func() {
+				ignorePatterns = []string{"tmpFile*"}
+			})
+
+			It("excludes matching files at every level", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/level2"}))
+			})
+		})
+
+		Context("when a negated pattern is provided", func() {
+			BeforeEach(func() {
+				ignorePatterns = []string{"tmpFile*", "!tmpFile3"}
+			})
+
+			It("re-includes the negated files", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/level2", "tmpFile3"}))
+			})
+		})
+
+		Context("when a directory-only pattern is provided", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(filepath.Join(srcDir, "level2"), []byte("not a directory"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+
+				ignorePatterns = []string{"level2/"}
+			})
+
+			It("prunes matching directories and keeps matching files", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level2", "tmpFile2", "tmpFile3"}))
+			})
+		})
+
+		Context("when an anchored pattern is provided", func() {
+			BeforeEach(func() {
+				ignorePatterns = []string{"/level1/level2/tmpFile1", "/tmpFile1"}
+			})
+
+			It("only excludes the path relative to the root", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/level2", "tmpFile2", "tmpFile3"}))
+			})
+		})
+
+		Context("when a '**' pattern is provided", func() {
+			BeforeEach(func() {
+				ignorePatterns = []string{"level1/**/tmpFile1"}
+			})
+
+			It("matches any number of intermediate directories", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(resourceFilenames(resources)).To(Equal([]string{"level1", "level1/level2", "tmpFile2", "tmpFile3"}))
+			})
+		})
+	})
+
+	Describe("ZipDirectoryResources", func() {
+		var (
+			resultZip  string
+			resources  []Resource
+			executeErr error
+		)
+
+		JustBeforeEach(func() {
+			resultZip, executeErr = actor.ZipDirectoryResources(srcDir, resources)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(resultZip)).ToNot(HaveOccurred())
+		})
+
+		Context("when the files exceed the actor's MaxTotalSize", func() {
+			BeforeEach(func() {
+				resources = []Resource{
+					{Filename: "level1", Size: 4096},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10},
+				}
+				actor.MaxTotalSize = 21
+			})
+
+			It("returns an ArchiveTooLargeError without zipping", func() {
+				Expect(executeErr).To(MatchError(ArchiveTooLargeError{TotalSize: 22, Limit: 21}))
+				Expect(resultZip).To(BeEmpty())
+			})
+
+			Context("when the files fit within the limit", func() {
+				BeforeEach(func() {
+					actor.MaxTotalSize = 22
+				})
+
+				It("zips the files", func() {
+					Expect(executeErr).ToNot(HaveOccurred())
+					Expect(resultZip).ToNot(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the files have not been changed since scanning them", func() {
+			BeforeEach(func() {
+				resources = []Resource{
+					{Filename: "level1"},
+					{Filename: "level1/level2"},
+					{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879"},
+				}
+			})
+
+			It("zips the file and returns a populated resources list", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				Expect(resultZip).ToNot(BeEmpty())
+				zipFile, err := os.Open(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer zipFile.Close()
+
+				zipInfo, err := zipFile.Stat()
+				Expect(err).ToNot(HaveOccurred())
+
+				reader, err := ykk.NewReader(zipFile, zipInfo.Size())
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(reader.File).To(HaveLen(5))
+				Expect(reader.File[0].Name).To(Equal("level1/"))
+				Expect(reader.File[1].Name).To(Equal("level1/level2/"))
+				Expect(reader.File[2].Name).To(Equal("level1/level2/tmpFile1"))
+				Expect(reader.File[3].Name).To(Equal("tmpFile2"))
+				Expect(reader.File[4].Name).To(Equal("tmpFile3"))
+
+				expectFileContentsToEqual(reader.File[2], "why hello")
+				expectFileContentsToEqual(reader.File[3], "Hello, Binky")
+				expectFileContentsToEqual(reader.File[4], "Bananarama")
+
+				for _, file := range reader.File {
+					if !file.FileInfo().IsDir() {
+						Expect(file.Method).To(Equal(zip.Deflate))
+					}
+				}
+			})
+
+			Context("when the actor is configured to sync zips", func() {
+				BeforeEach(func() {
+					actor.ZipSync = true
+				})
+
+				It("writes a complete zip", func() {
+					Expect(executeErr).ToNot(HaveOccurred())
+
+					reader, err := zip.OpenReader(resultZip)
+					Expect(err).ToNot(HaveOccurred())
+					defer reader.Close()
+
+					Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level1/level2/", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"}))
+				})
+			})
+
+			Context("when the actor is configured to store files uncompressed", func() {
+				BeforeEach(func() {
+					actor.ZipStoreUncompressed = true
+				})
+
+				It("stores the files without compression", func() {
+					Expect(executeErr).ToNot(HaveOccurred())
+
+					reader, err := zip.OpenReader(resultZip)
+					Expect(err).ToNot(HaveOccurred())
+					defer reader.Close()
+
+					Expect(reader.File).To(HaveLen(5))
+					for _, file := range reader.File {
+						Expect(file.Method).To(Equal(zip.Store))
+					}
+					expectFileContentsToEqual(reader.File[3], "Hello, Binky")
+				})
+			})
+
+			Context("when the actor is configured with a compression level", func() {
+				BeforeEach(func() {
+					actor.ZipCompressionLevel = flate.BestCompression
+				})
+
+				It("deflates the files", func() {
+					Expect(executeErr).ToNot(HaveOccurred())
+
+					reader, err := zip.OpenReader(resultZip)
+					Expect(err).ToNot(HaveOccurred())
+					defer reader.Close()
+
+					Expect(reader.File).To(HaveLen(5))
+					Expect(reader.File[4].Method).To(Equal(zip.Deflate))
+					expectFileContentsToEqual(reader.File[4], "Bananarama")
+				})
+			})
+
+			Context("when the compression level is invalid", func() {
+				var zipTempDir string
+
+				BeforeEach(func() {
+					actor.ZipCompressionLevel = 42
+
+					var err error
+					zipTempDir, err = ioutil.TempDir("", "v2-invalid-compression-level")
+					Expect(err).ToNot(HaveOccurred())
+					actor.ZipTempDir = zipTempDir
+				})
+
+				AfterEach(func() {
+					Expect(os.RemoveAll(zipTempDir)).To(Succeed())
+				})
+
+				It("returns an InvalidCompressionLevelError without creating a zip", func() {
+					Expect(executeErr).To(MatchError(InvalidCompressionLevelError{Level: 42}))
+					Expect(resultZip).To(BeEmpty())
+
+					files, err := ioutil.ReadDir(zipTempDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(files).To(BeEmpty())
+				})
+
+				It("returns the error before writing to a writer", func() {
+					buffer := new(bytes.Buffer)
+					err := actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)
+					Expect(err).To(MatchError(InvalidCompressionLevelError{Level: 42}))
+					Expect(buffer.Len()).To(BeZero())
+				})
+			})
+		})
+
+		Context("when the actor is configured to verify zips", func() {
+			BeforeEach(func() {
+				actor.ZipVerify = true
+
+				resources = []Resource{
+					{Filename: "level1"},
+					{Filename: "level1/level2"},
+					{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879"},
+				}
+			})
+
+			It("zips the files after verifying the zip", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(reader.File).To(HaveLen(5))
+			})
+		})
+
+		Context("when the actor is configured with a temp directory", func() {
+			var tempDir string
+
+			BeforeEach(func() {
+				var err error
+				tempDir, err = ioutil.TempDir("", "zip-temp-dir")
+				Expect(err).ToNot(HaveOccurred())
+				actor.ZipTempDir = tempDir
+
+				resources = []Resource{
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+				}
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(tempDir)).To(Succeed())
+			})
+
+			It("creates the zip in the temp directory", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+				Expect(filepath.Dir(resultZip)).To(Equal(tempDir))
+			})
+
+			Context("when the temp directory does not exist", func() {
+				BeforeEach(func() {
+					actor.ZipTempDir = filepath.Join(tempDir, "missing")
+				})
+
+				It("returns the error", func() {
+					Expect(os.IsNotExist(executeErr)).To(BeTrue())
+					Expect(resultZip).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the actor is configured to deduplicate files", func() {
+			BeforeEach(func() {
+				actor.ZipDeduplicate = true
+
+				err := ioutil.WriteFile(filepath.Join(srcDir, "level1", "tmpFile4"), []byte("Hello, Binky"), 0600)
+				Expect(err).ToNot(HaveOccurred())
+			})
+
+			Context("when the duplicates have not been changed since scanning them", func() {
+				BeforeEach(func() {
+					resources = []Resource{
+						{Filename: "level1"},
+						{Filename: "level1/tmpFile4", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+						{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+						{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10},
+					}
+				})
+
+				It("writes every copy of the duplicated file", func() {
+					Expect(executeErr).ToNot(HaveOccurred())
+
+					reader, err := zip.OpenReader(resultZip)
+					Expect(err).ToNot(HaveOccurred())
+					defer reader.Close()
+
+					Expect(reader.File).To(HaveLen(4))
+					Expect(reader.File[1].Name).To(Equal("level1/tmpFile4"))
+					Expect(reader.File[1].Method).To(Equal(zip.Deflate))
+					expectFileContentsToEqual(reader.File[1], "Hello, Binky")
+					Expect(reader.File[2].Name).To(Equal("tmpFile2"))
+					Expect(reader.File[2].Method).To(Equal(zip.Deflate))
+					Expect(reader.File[2].Mode()).To(Equal(reader.File[1].Mode()))
+					expectFileContentsToEqual(reader.File[2], "Hello, Binky")
+					expectFileContentsToEqual(reader.File[3], "Bananarama")
+				})
+
+				Context("when the actor is configured to store files uncompressed", func() {
+					BeforeEach(func() {
+						actor.ZipStoreUncompressed = true
+					})
+
+					It("stores every copy without compression", func() {
+						Expect(executeErr).ToNot(HaveOccurred())
+
+						reader, err := zip.OpenReader(resultZip)
+						Expect(err).ToNot(HaveOccurred())
+						defer reader.Close()
+
+						Expect(reader.File).To(HaveLen(4))
+						Expect(reader.File[1].Method).To(Equal(zip.Store))
+						expectFileContentsToEqual(reader.File[1], "Hello, Binky")
+						Expect(reader.File[2].Method).To(Equal(zip.Store))
+						expectFileContentsToEqual(reader.File[2], "Hello, Binky")
+					})
+				})
+			})
+
+			Context("when a duplicate has changed since scanning it", func() {
+				BeforeEach(func() {
+					err := ioutil.WriteFile(filepath.Join(srcDir, "level1", "tmpFile4"), []byte("Bananarama"), 0600)
+					Expect(err).ToNot(HaveOccurred())
+
+					resources = []Resource{
+						{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+						{Filename: "level1/tmpFile4", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+					}
+				})
+
+				It("returns a FileChangedError", func() {
+					Expect(executeErr).To(MatchError(FileChangedError{
+						Filename:     filepath.Join(srcDir, "level1", "tmpFile4"),
+						ExpectedSHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95",
+						ActualSHA1:   "f4c9ca85f3e084ffad3abbdabbd2a890c034c879",
+					}))
+					Expect(resultZip).To(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the context is cancelled", func() {
+			It("returns the context's error", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				zipPath, err := actor.ZipDirectoryResourcesWithContext(ctx, srcDir, []Resource{
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+				})
+				Expect(err).To(MatchError(context.Canceled))
+				Expect(zipPath).To(BeEmpty())
+			})
+		})
+
+		Context("when the files have changed since the scanning", func() {
+			BeforeEach(func() {
+				resources = []Resource{
+					{Filename: "level1"},
+					{Filename: "level1/level2"},
+					{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+					{Filename: "tmpFile3", SHA1: "i dunno, 7?"},
+				}
+			})
+
+			It("returns an FileChangedError", func() {
+				Expect(executeErr).To(Equal(FileChangedError{
+					Filename:     filepath.Join(srcDir, "tmpFile3"),
+					ExpectedSHA1: "i dunno, 7?",
+					ActualSHA1:   "f4c9ca85f3e084ffad3abbdabbd2a890c034c879",
+				}))
+			})
+		})
+	})
+
+	Describe("ZipArchiveResources", func() {
+		var (
+			archive    string
+			resources  []Resource
+			resultZip  string
+			executeErr error
+		)
+
+		BeforeEach(func() {
+			tmpfile, err := ioutil.TempFile("", "zip-archive-resources")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tmpfile.Close()).To(Succeed())
+			archive = tmpfile.Name()
+
+			resources = []Resource{
+				{Filename: "level1/"},
+				{Filename: "level1/level2/"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Mode: 0644},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Mode: 0751},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Mode: 0655},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(archive)).To(Succeed())
+			Expect(os.RemoveAll(resultZip)).To(Succeed())
+		})
+
+		DescribeTable("repackaging archives",
+			func(createArchive func() error) {
+				Expect(createArchive()).To(Succeed())
+
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level1/level2/", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"}))
+				expectFileContentsToEqual(reader.File[2], "why hello")
+				expectFileContentsToEqual(reader.File[3], "Hello, Binky")
+				expectFileContentsToEqual(reader.File[4], "Bananarama")
+				Expect(reader.File[3].Mode()).To(Equal(os.FileMode(0751)))
+			},
+
+			Entry("when the archive is a zip", func() error { return zipit(srcDir, archive, "") }),
+			Entry("when the archive is a tar", func() error { return tarit(srcDir, archive, false) }),
+			Entry("when the archive is a gzipped tar", func() error { return tarit(srcDir, archive, true) }),
+		)
+
+		Context("when the archived entries have no permissions", func() {
+			BeforeEach(func() {
+				file, err := os.Create(archive)
+				Expect(err).ToNot(HaveOccurred())
+				defer file.Close()
+
+				writer := zip.NewWriter(file)
+				dirHeader := &zip.FileHeader{Name: "bin/"}
+				dirHeader.SetMode(os.ModeDir)
+				_, err = writer.CreateHeader(dirHeader)
+				Expect(err).ToNot(HaveOccurred())
+
+				fileHeader := &zip.FileHeader{Name: "bin/start"}
+				fileHeader.SetMode(0)
+				entry, err := writer.CreateHeader(fileHeader)
+				Expect(err).ToNot(HaveOccurred())
+				_, err = entry.Write([]byte("why hello"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+			})
+
+			zipModes := func() []os.FileMode {
+				resources, err := actor.GatherArchiveResources(archive)
+				Expect(err).ToNot(HaveOccurred())
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				var modes []os.FileMode
+				for _, file := range reader.File {
+					modes = append(modes, file.Mode())
+				}
+				return modes
+			}
+
+			It("gives them the default permissions", func() {
+				Expect(zipModes()).To(Equal([]os.FileMode{os.ModeDir | DefaultFolderPermissions, DefaultArchiveFilePermissions}))
+			})
+
+			Context("when the actor's default permissions are set", func() {
+				BeforeEach(func() {
+					actor.FilePermissions = 0644
+					actor.FolderPermissions = 0700
+				})
+
+				It("gives them the actor's permissions", func() {
+					Expect(zipModes()).To(Equal([]os.FileMode{os.ModeDir | 0700, 0644}))
+				})
+			})
+		})
+
+		Context("when the resources have rooted names", func() {
+			BeforeEach(func() {
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+				resources = []Resource{
+					{Filename: "/"},
+					{Filename: "/level1/"},
+					{Filename: "/level1/level2/"},
+					{Filename: "/level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Mode: 0644},
+					{Filename: "/tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Mode: 0751},
+					{Filename: "/tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Mode: 0655},
+				}
+			})
+
+			It("matches them to the cleaned entry names", func() {
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level1/level2/", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"}))
+				Expect(reader.File[3].Mode()).To(Equal(os.FileMode(0751)))
+			})
+		})
+
+		Context("when the actor is configured to sync zips", func() {
+			BeforeEach(func() {
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+				actor.ZipSync = true
+			})
+
+			It("writes a complete zip", func() {
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level1/level2/", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"}))
+			})
+		})
+
+		Context("when only the included files are zipped", func() {
+			BeforeEach(func() {
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+				resources = []Resource{
+					{Filename: "level1/"},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Mode: 0751},
+				}
+			})
+
+			It("leaves out the archived files missing from filesToInclude", func() {
+				resultZip, executeErr = actor.ZipArchiveResourcesIncludedOnly(archive, resources)
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "tmpFile2"}))
+				expectFileContentsToEqual(reader.File[1], "Hello, Binky")
+			})
+		})
+
+		Context("when the entries are renamed", func() {
+			BeforeEach(func() {
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+			})
+
+			It("stores the entries under their new names and drops the rest", func() {
+				var originals []string
+				resultZip, executeErr = actor.ZipArchiveResourcesWithNames(archive, resources, func(original string) (string, bool) {
+					originals = append(originals, original)
+					if original == "tmpFile2" {
+						return "", false
+					}
+					return strings.TrimPrefix(original, "level1/"), true
+				})
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(originals).To(ConsistOf("level1", "level1/level2", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"))
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level2/", "level2/tmpFile1", "tmpFile3"}))
+				expectFileContentsToEqual(reader.File[2], "why hello")
+				Expect(reader.File[2].Mode()).To(Equal(os.FileMode(0644)))
+			})
+		})
+
+		Context("when the entry names were written by a Windows zipper", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(archive, windowsZipper(), 0600)).To(Succeed())
+			})
+
+			It("stores the decoded names as UTF-8", func() {
+				resultZip, executeErr = actor.ZipArchiveResources(archive, []Resource{
+					{Filename: "café/menü.txt", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Mode: 0644},
+				})
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"café/", "café/menü.txt", "naïve.txt", "readme.txt", "日本.txt"}))
+				Expect(reader.File[1].Flags & 0x800).ToNot(BeZero())
+				Expect(reader.File[1].Mode()).To(Equal(os.FileMode(0644)))
+			})
+		})
+
+		Context("when a file has changed since gathering", func() {
+			BeforeEach(func() {
+				Expect(zipit(srcDir, archive, "")).To(Succeed())
+				resources[4].SHA1 = "i dunno, 7?"
+			})
+
+			It("returns a FileChangedError", func() {
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(executeErr).To(MatchError(FileChangedError{
+					Filename:     "tmpFile3",
+					ExpectedSHA1: "i dunno, 7?",
+					ActualSHA1:   "f4c9ca85f3e084ffad3abbdabbd2a890c034c879",
+				}))
+				Expect(resultZip).To(BeEmpty())
+			})
+		})
+
+		Context("when the archive is not a valid archive", func() {
+			BeforeEach(func() {
+				Expect(ioutil.WriteFile(archive, []byte("not a zip"), 0600)).To(Succeed())
+			})
+
+			It("returns an InvalidArchiveError", func() {
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(executeErr).To(MatchError(InvalidArchiveError{Path: archive}))
+			})
+		})
+
+		Context("when the archive does not exist", func() {
+			BeforeEach(func() {
+				archive = "/does/not/exist"
+			})
+
+			It("returns an error", func() {
+				resultZip, executeErr = actor.ZipArchiveResources(archive, resources)
+				Expect(os.IsNotExist(executeErr)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("empty directories", func() {
+		var emptyDirs []string
+
+		BeforeEach(func() {
+			emptyDirs = []string{"empty1", "empty1/empty2", "empty1/empty2/empty3", "level1/empty4"}
+			for _, dir := range emptyDirs {
+				Expect(os.MkdirAll(filepath.Join(srcDir, dir), 0755)).To(Succeed())
+			}
+		})
+
+		It("preserves them through gathering and zipping a directory", func() {
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(zipPath)
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			for _, dir := range emptyDirs {
+				file := findZipFile(reader.File, dir+"/")
+				Expect(file).ToNot(BeNil(), dir)
+				Expect(file.Mode().IsDir()).To(BeTrue())
+			}
+		})
+
+		It("preserves them through gathering and zipping an archive", func() {
+			tmpfile, err := ioutil.TempFile("", "empty-dirs")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tmpfile.Close()).To(Succeed())
+			defer os.RemoveAll(tmpfile.Name())
+			Expect(zipit(srcDir, tmpfile.Name(), "")).To(Succeed())
+
+			resources, err := actor.GatherArchiveResources(tmpfile.Name())
+			Expect(err).ToNot(HaveOccurred())
+
+			zipPath, err := actor.ZipArchiveResources(tmpfile.Name(), resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(zipPath)
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			for _, dir := range emptyDirs {
+				file := findZipFile(reader.File, dir+"/")
+				Expect(file).ToNot(BeNil(), dir)
+				Expect(file.Mode().IsDir()).To(BeTrue())
+			}
+		})
+	})
+
+	Describe("ZipDirectoryResourcesMatching", func() {
+		var (
+			resources []Resource
+			include   []string
+			resultZip string
+		)
+
+		BeforeEach(func() {
+			err := os.MkdirAll(filepath.Join(srcDir, "other"), 0777)
+			Expect(err).ToNot(HaveOccurred())
+
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+				{Filename: "other"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879"},
+			}
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(resultZip)).To(Succeed())
+		})
+
+		Context("when include globs are provided", func() {
+			BeforeEach(func() {
+				include = []string{"**/tmpFile1", "tmpFile3"}
+			})
+
+			It("only zips the matching files and the directories containing them", func() {
+				var err error
+				resultZip, err = actor.ZipDirectoryResourcesMatching(srcDir, resources, include)
+				Expect(err).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{
+					"level1/",
+					"level1/level2/",
+					"level1/level2/tmpFile1",
+					"tmpFile3",
+				}))
+			})
+		})
+
+		Context("when no include globs are provided", func() {
+			BeforeEach(func() {
+				include = nil
+			})
+
+			It("zips all the files", func() {
+				var err error
+				resultZip, err = actor.ZipDirectoryResourcesMatching(srcDir, resources, include)
+				Expect(err).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{
+					"level1/",
+					"level1/level2/",
+					"level1/level2/tmpFile1",
+					"other/",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+			})
+		})
+	})
+
+	Describe("Logger", func() {
+		var hook *logtest.Hook
+
+		BeforeEach(func() {
+			var logger *log.Logger
+			logger, hook = logtest.NewNullLogger()
+			logger.Level = log.InfoLevel
+			actor.Logger = logger
+		})
+
+		It("logs to the configured logger", func() {
+			zipPath, err := actor.ZipDirectoryResources(srcDir, []Resource{
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			Expect(hook.AllEntries()).ToNot(BeEmpty())
+			Expect(hook.LastEntry().Message).To(Equal("zip file created"))
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("zip_file_location", zipPath))
+		})
+
+		It("logs the file and directory counts separately", func() {
+			zipPath, err := actor.ZipDirectoryResources(srcDir, []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("zipped_file_count", 2))
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("zipped_directory_count", 2))
+		})
+	})
+
+	Describe("ZipDirectoryResourcesWithSummary", func() {
+		It("returns a summary of the zip", func() {
+			resources := []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+			}
+
+			zipPath, summary, err := actor.ZipDirectoryResourcesWithSummary(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			zipInfo, err := os.Stat(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(summary.FileCount).To(Equal(2))
+			Expect(summary.DirectoryCount).To(Equal(2))
+			Expect(summary.UncompressedSize).To(BeEquivalentTo(21))
+			Expect(summary.CopiedSize).To(BeEquivalentTo(21))
+			Expect(summary.CompressedSize).To(Equal(zipInfo.Size()))
+			Expect(summary.Duration).To(BeNumerically(">", 0))
+
+			contents, err := ioutil.ReadFile(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(summary.SHA256).To(Equal(fmt.Sprintf("%x", sha256.Sum256(contents))))
+		})
+
+		It("logs the SHA256 of the zip", func() {
+			logger, hook := logtest.NewNullLogger()
+			actor.Logger = logger
+
+			zipPath, summary, err := actor.ZipDirectoryResourcesWithSummary(srcDir, []Resource{
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			Expect(hook.LastEntry().Message).To(Equal("zip file created"))
+			Expect(hook.LastEntry().Data).To(HaveKeyWithValue("zip_sha256", summary.SHA256))
+		})
+
+		Context("when a file's size differs from its resource's Size", func() {
+			var hook *logtest.Hook
+
+			BeforeEach(func() {
+				var logger *log.Logger
+				logger, hook = logtest.NewNullLogger()
+				actor.Logger = logger
+			})
+
+			It("reports the bytes actually copied and logs a warning", func() {
+				zipPath, summary, err := actor.ZipDirectoryResourcesWithSummary(srcDir, []Resource{
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 5},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				Expect(summary.UncompressedSize).To(BeEquivalentTo(5))
+				Expect(summary.CopiedSize).To(BeEquivalentTo(12))
+
+				var warnings []*log.Entry
+				for _, entry := range hook.AllEntries() {
+					if entry.Level == log.WarnLevel {
+						warnings = append(warnings, entry)
+					}
+				}
+				Expect(warnings).To(HaveLen(1))
+				Expect(warnings[0].Data).To(HaveKeyWithValue("expected_size", int64(5)))
+				Expect(warnings[0].Data).To(HaveKeyWithValue("copied_size", int64(12)))
+			})
+		})
+
+		Context("when zipping fails", func() {
+			It("returns an empty summary", func() {
+				zipPath, summary, err := actor.ZipDirectoryResourcesWithSummary(srcDir, []Resource{
+					{Filename: "tmpFile2", SHA1: "i dunno, 7?"},
+				})
+				Expect(err).To(HaveOccurred())
+				Expect(zipPath).To(BeEmpty())
+				Expect(summary).To(Equal(ZipSummary{}))
+			})
+		})
+	})
+
+	Describe("ZipDirectoryResourcesWithProgress", func() {
+		type progressCall struct {
+			filename     string
+			bytesWritten int64
+			totalBytes   int64
+		}
+
+		var resources []Resource
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10},
+			}
+		})
+
+		It("reports progress after each resource is zipped", func() {
+			var calls []progressCall
+			zipPath, err := actor.ZipDirectoryResourcesWithProgress(srcDir, resources, func(filename string, bytesWritten int64, totalBytes int64) {
+				calls = append(calls, progressCall{filename: filename, bytesWritten: bytesWritten, totalBytes: totalBytes})
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.RemoveAll(zipPath)).To(Succeed())
+
+			Expect(calls).To(Equal([]progressCall{
+				{filename: "level1", bytesWritten: 0, totalBytes: 22},
+				{filename: "tmpFile2", bytesWritten: 12, totalBytes: 22},
+				{filename: "tmpFile3", bytesWritten: 22, totalBytes: 22},
+			}))
+		})
+
+		Context("when a file's size differs from its resource's Size", func() {
+			BeforeEach(func() {
+				resources[1].Size = 5
+			})
+
+			It("reports the bytes actually copied", func() {
+				var calls []progressCall
+				zipPath, err := actor.ZipDirectoryResourcesWithProgress(srcDir, resources, func(filename string, bytesWritten int64, totalBytes int64) {
+					calls = append(calls, progressCall{filename: filename, bytesWritten: bytesWritten, totalBytes: totalBytes})
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.RemoveAll(zipPath)).To(Succeed())
+
+				Expect(calls).To(Equal([]progressCall{
+					{filename: "level1", bytesWritten: 0, totalBytes: 15},
+					{filename: "tmpFile2", bytesWritten: 12, totalBytes: 15},
+					{filename: "tmpFile3", bytesWritten: 22, totalBytes: 15},
+				}))
+			})
+		})
+
+		Context("when the progress func is nil", func() {
+			It("zips the resources", func() {
+				zipPath, err := actor.ZipDirectoryResourcesWithProgress(srcDir, resources, nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.RemoveAll(zipPath)).To(Succeed())
+			})
+		})
+	})
+
+	Describe("ZipDirectoryResourcesWithNames", func() {
+		It("stores the resources under their new names and drops the rest", func() {
+			zipPath, err := actor.ZipDirectoryResourcesWithNames(srcDir, []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+			}, func(original string) (string, bool) {
+				if original == "tmpFile2" {
+					return "", false
+				}
+				return strings.TrimPrefix(strings.TrimPrefix(original, "level1"), "/"), true
+			})
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(zipPath)
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level2/", "level2/tmpFile1"}))
+			expectFileContentsToEqual(reader.File[1], "why hello")
+		})
+
+		Context("when rename is nil", func() {
+			It("keeps the original names", func() {
+				zipPath, err := actor.ZipDirectoryResourcesWithNames(srcDir, []Resource{
+					{Filename: "level1"},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				}, nil)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "tmpFile2"}))
+			})
+		})
+	})
+
+	Describe("ZipDirectoryResourcesWithTransform", func() {
+		var (
+			resources []Resource
+			transform ZipTransformFunc
+			zipPath   string
+			zipErr    error
+		)
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10},
+			}
+			transform = func(name string, r io.Reader) (io.Reader, error) {
+				if name != "tmpFile2" {
+					return r, nil
+				}
+				contents, err := ioutil.ReadAll(r)
+				if err != nil {
+					return nil, err
+				}
+				return bytes.NewReader(bytes.Replace(contents, []byte("Binky"), []byte("build-1234"), -1)), nil
+			}
+		})
+
+		JustBeforeEach(func() {
+			zipPath, zipErr = actor.ZipDirectoryResourcesWithTransform(srcDir, resources, transform)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(zipPath)).To(Succeed())
+		})
+
+		It("stores the transformed contents", func() {
+			Expect(zipErr).ToNot(HaveOccurred())
+
+			reader, err := zip.OpenReader(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+
+			Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "tmpFile2", "tmpFile3"}))
+			expectFileContentsToEqual(reader.File[1], "Hello, build-1234")
+			expectFileContentsToEqual(reader.File[2], "Bananarama")
+		})
+
+		Context("when the transform does not read the whole file", func() {
+			BeforeEach(func() {
+				transform = func(string, io.Reader) (io.Reader, error) {
+					return strings.NewReader("replaced"), nil
+				}
+			})
+
+			It("still checks the files against their SHA1", func() {
+				Expect(zipErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+				expectFileContentsToEqual(reader.File[1], "replaced")
+			})
+		})
+
+		Context("when a file has changed since it was gathered", func() {
+			BeforeEach(func() {
+				resources[1].SHA1 = "i dunno, 7?"
+			})
+
+			It("returns a FileChangedError for the original contents", func() {
+				Expect(zipErr).To(MatchError(FileChangedError{
+					Filename:     filepath.Join(srcDir, "tmpFile2"),
+					ExpectedSHA1: "i dunno, 7?",
+					ActualSHA1:   "e594bdc795bb293a0e55724137e53a36dc0d9e95",
+				}))
+				Expect(zipPath).To(BeEmpty())
+			})
+		})
+
+		Context("when the transform fails", func() {
+			BeforeEach(func() {
+				transform = func(string, io.Reader) (io.Reader, error) {
+					return nil, errors.New("transform failed")
+				}
+			})
+
+			It("returns the error", func() {
+				Expect(zipErr).To(MatchError("transform failed"))
+				Expect(zipPath).To(BeEmpty())
+			})
+		})
+
+		Context("when the actor deduplicates files", func() {
+			BeforeEach(func() {
+				actor.ZipDeduplicate = true
+				Expect(ioutil.WriteFile(filepath.Join(srcDir, "level1", "tmpFile2"), []byte("Hello, Binky"), 0600)).To(Succeed())
+				resources = append(resources, Resource{Filename: "level1/tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12})
+			})
+
+			It("transforms every copy separately", func() {
+				Expect(zipErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level1/tmpFile2", "tmpFile2", "tmpFile3"}))
+				expectFileContentsToEqual(reader.File[1], "Hello, Binky")
+				expectFileContentsToEqual(reader.File[2], "Hello, build-1234")
+			})
+		})
 	})
 
-	Describe("ZipDirectoryResources", func() {
+	Describe("ZipDirectoryResourcesGzipped", func() {
 		var (
-			resultZip  string
-			resources  []Resource
-			executeErr error
+			resources       []Resource
+			zipPath         string
+			contentEncoding string
+			zipErr          error
 		)
 
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+			}
+		})
+
 		JustBeforeEach(func() {
-			resultZip, executeErr = actor.ZipDirectoryResources(srcDir, resources)
+			zipPath, contentEncoding, zipErr = actor.ZipDirectoryResourcesGzipped(srcDir, resources)
 		})
 
 		AfterEach(func() {
-			Expect(os.RemoveAll(resultZip)).ToNot(HaveOccurred())
+			Expect(os.RemoveAll(zipPath)).To(Succeed())
 		})
 
-		Context("when the files have not been changed since scanning them", func() {
+		It("returns a gzipped zip and its content encoding", func() {
+			Expect(zipErr).ToNot(HaveOccurred())
+			Expect(contentEncoding).To(Equal(GzipContentEncoding))
+
+			gzipped, err := ioutil.ReadFile(zipPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gzipped[:2]).To(Equal([]byte{0x1f, 0x8b}))
+
+			gzipReader, err := gzip.NewReader(bytes.NewReader(gzipped))
+			Expect(err).ToNot(HaveOccurred())
+			zipped, err := ioutil.ReadAll(gzipReader)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := zip.NewReader(bytes.NewReader(zipped), int64(len(zipped)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "level1/level2/", "level1/level2/tmpFile1", "tmpFile2"}))
+			expectFileContentsToEqual(reader.File[2], "why hello")
+			expectFileContentsToEqual(reader.File[3], "Hello, Binky")
+		})
+
+		Context("when ZipVerify is set", func() {
 			BeforeEach(func() {
-				resources = []Resource{
-					{Filename: "level1"},
-					{Filename: "level1/level2"},
-					{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
-					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
-					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879"},
-				}
+				actor.ZipVerify = true
 			})
 
-			It("zips the file and returns a populated resources list", func() {
-				Expect(executeErr).ToNot(HaveOccurred())
+			It("does not reread the gzipped zip", func() {
+				Expect(zipErr).ToNot(HaveOccurred())
+			})
+		})
 
-				Expect(resultZip).ToNot(BeEmpty())
-				zipFile, err := os.Open(resultZip)
+		Context("when a file changed since it was gathered", func() {
+			BeforeEach(func() {
+				resources[3].SHA1 = "not-the-sha1"
+			})
+
+			It("returns the error and removes the zip", func() {
+				Expect(zipErr).To(BeAssignableToTypeOf(FileChangedError{}))
+				Expect(zipPath).To(BeEmpty())
+				Expect(contentEncoding).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("ZipOwner", func() {
+		var resources []Resource
+
+		// unixExtraField returns the Info-ZIP Unix extra field in extra, if any.
+		unixExtraField := func(extra []byte) []byte {
+			for len(extra) >= 4 {
+				id := binary.LittleEndian.Uint16(extra)
+				size := int(binary.LittleEndian.Uint16(extra[2:]))
+				if id == 0x7875 {
+					return extra[:4+size]
+				}
+				extra = extra[4+size:]
+			}
+			return nil
+		}
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751},
+			}
+		})
+
+		Context("when no owner is set", func() {
+			It("does not record an owner", func() {
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
 				Expect(err).ToNot(HaveOccurred())
-				defer zipFile.Close()
+				defer os.Remove(zipPath)
 
-				zipInfo, err := zipFile.Stat()
+				reader, err := zip.OpenReader(zipPath)
 				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
 
-				reader, err := ykk.NewReader(zipFile, zipInfo.Size())
+				for _, file := range reader.File {
+					Expect(unixExtraField(file.Extra)).To(BeNil())
+				}
+			})
+		})
+
+		Context("when an owner is set", func() {
+			BeforeEach(func() {
+				actor.ZipOwner = &ZipOwner{UID: 1000, GID: 1001}
+			})
+
+			It("records the owner in every entry's headers", func() {
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
 				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
 
-				Expect(reader.File).To(HaveLen(5))
-				Expect(reader.File[0].Name).To(Equal("level1/"))
-				Expect(reader.File[1].Name).To(Equal("level1/level2/"))
-				Expect(reader.File[2].Name).To(Equal("level1/level2/tmpFile1"))
-				Expect(reader.File[3].Name).To(Equal("tmpFile2"))
-				Expect(reader.File[4].Name).To(Equal("tmpFile3"))
+				expectedField := []byte{0x75, 0x78, 11, 0, 1, 4, 0xe8, 0x03, 0, 0, 4, 0xe9, 0x03, 0, 0}
 
-				expectFileContentsToEqual(reader.File[2], "why hello")
-				expectFileContentsToEqual(reader.File[3], "Hello, Binky")
-				expectFileContentsToEqual(reader.File[4], "Bananarama")
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
 
+				Expect(reader.File).To(HaveLen(2))
 				for _, file := range reader.File {
-					Expect(file.Method).To(Equal(zip.Deflate))
+					Expect(unixExtraField(file.Extra)).To(Equal(expectedField))
 				}
+
+				// once in each entry's local header and once in its central
+				// directory header
+				zipped, err := ioutil.ReadFile(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(bytes.Count(zipped, expectedField)).To(Equal(4))
 			})
+
+			It("keeps the entries' modes", func() {
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				archivedResources, err := actor.GatherArchiveResources(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(archivedResources).To(ContainElement(Resource{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: actor.NormalizeMode(0600)}))
+			})
+
+			It("is included in the estimated zip size", func() {
+				actor.ZipStoreUncompressed = true
+				actor.EstimateSampleRate = 0.5
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+				zipInfo, err := os.Stat(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(actor.EstimateCompressedSize(srcDir, resources)).To(Equal(zipInfo.Size()))
+			})
+		})
+	})
+
+	Describe("ZipEmbeddedManifestName", func() {
+		var resources []Resource
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0600},
+				{Filename: "level1"},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0600},
+			}
 		})
 
-		Context("when the files have changed since the scanning", func() {
+		Context("when no name is set", func() {
+			It("does not embed a manifest", func() {
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "tmpFile2", "tmpFile3"}))
+			})
+		})
+
+		Context("when a name is set", func() {
+			BeforeEach(func() {
+				actor.ZipEmbeddedManifestName = DefaultZipEmbeddedManifestName
+				actor.ZipVerify = true
+			})
+
+			It("embeds the manifest of the zipped resources last", func() {
+				zipPath, summary, err := actor.ZipDirectoryResourcesWithSummary(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+				Expect(summary.FileCount).To(Equal(2))
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"level1/", "tmpFile2", "tmpFile3", ".cf-manifest.json"}))
+				Expect(reader.File[3].Mode()).To(Equal(os.FileMode(DefaultArchiveFilePermissions)))
+
+				manifest, err := reader.File[3].Open()
+				Expect(err).ToNot(HaveOccurred())
+				defer manifest.Close()
+				contents, err := ioutil.ReadAll(manifest)
+				Expect(err).ToNot(HaveOccurred())
+
+				embedded, err := actor.UnmarshalResources(contents)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(embedded).To(Equal([]Resource{resources[1], resources[0], resources[2]}))
+			})
+
+			It("lists renamed resources under their new names", func() {
+				zipPath, err := actor.ZipDirectoryResourcesWithNames(srcDir, resources, func(original string) (string, bool) {
+					return "app/" + original, true
+				})
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				reader, err := zip.OpenReader(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				manifest, err := reader.File[3].Open()
+				Expect(err).ToNot(HaveOccurred())
+				defer manifest.Close()
+				contents, err := ioutil.ReadAll(manifest)
+				Expect(err).ToNot(HaveOccurred())
+
+				embedded, err := actor.UnmarshalResources(contents)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenames(embedded)).To(Equal([]string{"app/level1", "app/tmpFile2", "app/tmpFile3"}))
+			})
+
+			It("produces identical zips across runs", func() {
+				firstZip := new(bytes.Buffer)
+				Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, firstZip)).To(Succeed())
+				secondZip := new(bytes.Buffer)
+				Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, secondZip)).To(Succeed())
+				Expect(secondZip.Bytes()).To(Equal(firstZip.Bytes()))
+
+				reader, err := zip.NewReader(bytes.NewReader(secondZip.Bytes()), int64(secondZip.Len()))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reader.File[3].Name).To(Equal(".cf-manifest.json"))
+				Expect(reader.File[3].Modified.Equal(time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+			})
+
+			Context("when the actor is configured with a fixed modification time", func() {
+				BeforeEach(func() {
+					actor.ZipModifiedTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+				})
+
+				It("gives the manifest the same time", func() {
+					buffer := new(bytes.Buffer)
+					Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)).To(Succeed())
+
+					reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(reader.File[3].Modified.Equal(actor.ZipModifiedTime)).To(BeTrue())
+				})
+			})
+
+			Context("when a resource is stored under the same name", func() {
+				BeforeEach(func() {
+					actor.ZipEmbeddedManifestName = "tmpFile2"
+				})
+
+				It("returns an EmbeddedManifestConflictError", func() {
+					_, err := actor.ZipDirectoryResources(srcDir, resources)
+					Expect(err).To(MatchError(EmbeddedManifestConflictError{Filename: "tmpFile2"}))
+				})
+			})
+		})
+	})
+
+	Describe("ZipDirectoryResourcesToWriter", func() {
+		var (
+			buffer    *bytes.Buffer
+			resources []Resource
+		)
+
+		BeforeEach(func() {
+			buffer = new(bytes.Buffer)
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+			}
+		})
+
+		It("writes the zip to the provided writer", func() {
+			err := actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)
+			Expect(err).ToNot(HaveOccurred())
+
+			reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(reader.File).To(HaveLen(2))
+			Expect(reader.File[0].Name).To(Equal("level1/"))
+			Expect(reader.File[1].Name).To(Equal("tmpFile2"))
+			expectFileContentsToEqual(reader.File[1], "Hello, Binky")
+		})
+
+		Context("when a file has changed", func() {
+			BeforeEach(func() {
+				resources[1].SHA1 = "i dunno, 7?"
+			})
+
+			It("returns a FileChangedError", func() {
+				err := actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)
+				Expect(err).To(MatchError(FileChangedError{
+					Filename:     filepath.Join(srcDir, "tmpFile2"),
+					ExpectedSHA1: "i dunno, 7?",
+					ActualSHA1:   "e594bdc795bb293a0e55724137e53a36dc0d9e95",
+				}))
+			})
+		})
+
+		Context("when the writer's disk is full", func() {
+			var writeErr error
+
 			BeforeEach(func() {
+				writeErr = &os.PathError{Op: "write", Path: "/full/disk", Err: syscall.ENOSPC}
+			})
+
+			It("returns the error from writing the zip's central directory", func() {
+				// the zip entries fit in the zip writer's buffer, so they are
+				// only written when the central directory is
+				err := actor.ZipDirectoryResourcesToWriter(srcDir, resources, fullDiskWriter{err: writeErr})
+				Expect(err).To(MatchError(writeErr))
+			})
+
+			It("returns the error from writing the entries", func() {
+				Expect(ioutil.WriteFile(filepath.Join(srcDir, "tmpFile2"), bytes.Repeat([]byte("Hello, Binky"), 10000), 0600)).To(Succeed())
 				resources = []Resource{
-					{Filename: "level1"},
-					{Filename: "level1/level2"},
-					{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
-					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
-					{Filename: "tmpFile3", SHA1: "i dunno, 7?"},
+					{Filename: "tmpFile2", SHA1: fmt.Sprintf("%x", sha1.Sum(bytes.Repeat([]byte("Hello, Binky"), 10000)))},
 				}
+				actor.ZipStoreUncompressed = true
+
+				err := actor.ZipDirectoryResourcesToWriter(srcDir, resources, fullDiskWriter{err: writeErr})
+				Expect(err).To(MatchError(writeErr))
 			})
+		})
+	})
 
-			It("returns an FileChangedError", func() {
-				Expect(executeErr).To(Equal(FileChangedError{Filename: filepath.Join(srcDir, "tmpFile3")}))
+	Describe("non-ASCII names", func() {
+		var resources []Resource
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "café.txt", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				{Filename: "naïve.txt", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10},
+			}
+			for _, name := range []string{"café.txt", "naïve.txt"} {
+				Expect(ioutil.WriteFile(filepath.Join(srcDir, name), []byte("Hello, Binky"), 0600)).To(Succeed())
+			}
+		})
+
+		DescribeTable("declares the names as UTF-8",
+			func(deduplicate bool) {
+				actor.ZipDeduplicate = deduplicate
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.Remove(zipPath)
+
+				zipBytes, err := ioutil.ReadFile(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+
+				// the first entry's local header starts the zip, with its
+				// general purpose flags at offset 6
+				Expect(binary.LittleEndian.Uint32(zipBytes[0:4])).To(BeEquivalentTo(0x04034b50))
+				Expect(binary.LittleEndian.Uint16(zipBytes[6:8]) & 0x800).ToNot(BeZero())
+
+				reader, err := zip.NewReader(bytes.NewReader(zipBytes), int64(len(zipBytes)))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{"café.txt", "naïve.txt", "tmpFile3"}))
+				Expect(reader.File[0].Flags & 0x800).ToNot(BeZero())
+				Expect(reader.File[1].Flags & 0x800).ToNot(BeZero())
+				Expect(reader.File[2].Flags & 0x800).To(BeZero())
+				expectFileContentsToEqual(reader.File[1], "Hello, Binky")
+			},
+			Entry("when files are compressed one at a time", false),
+			Entry("when duplicated files are compressed once", true),
+		)
+	})
+
+	Describe("modification times", func() {
+		var (
+			resources []Resource
+			modified  time.Time
+		)
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+			}
+
+			modified = time.Date(2017, time.June, 1, 12, 30, 0, 0, time.UTC)
+			Expect(os.Chtimes(filepath.Join(srcDir, "tmpFile2"), modified, modified)).To(Succeed())
+		})
+
+		It("keeps the modification time of each file when zipping a directory", func() {
+			buffer := new(bytes.Buffer)
+			Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)).To(Succeed())
+
+			reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reader.File[3].Modified.Equal(modified)).To(BeTrue())
+		})
+
+		It("keeps the modification time of each archived file when zipping an archive", func() {
+			archive := filepath.Join(srcDir, "archive.zip")
+			archiveFile, err := os.Create(archive)
+			Expect(err).ToNot(HaveOccurred())
+			writer := zip.NewWriter(archiveFile)
+			fileWriter, err := writer.CreateHeader(&zip.FileHeader{Name: "tmpFile2", Modified: modified})
+			Expect(err).ToNot(HaveOccurred())
+			_, err = fileWriter.Write([]byte("Hello, Binky"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(writer.Close()).To(Succeed())
+			Expect(archiveFile.Close()).To(Succeed())
+
+			resultZip, err := actor.ZipArchiveResources(archive, nil)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(resultZip)
+
+			reader, err := zip.OpenReader(resultZip)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			Expect(reader.File).To(HaveLen(1))
+			Expect(reader.File[0].Modified.Equal(modified)).To(BeTrue())
+		})
+
+		Context("when the resources are not sorted", func() {
+			It("zips them sorted by filename", func() {
+				buffer := new(bytes.Buffer)
+				Expect(actor.ZipDirectoryResourcesToWriter(srcDir, []Resource{resources[3], resources[2], resources[0], resources[1]}, buffer)).To(Succeed())
+
+				reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resourceFilenamesFromZip(reader.File)).To(Equal([]string{
+					"level1/",
+					"level1/level2/",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+				}))
+			})
+		})
+
+		Context("when the actor is configured with a fixed modification time", func() {
+			BeforeEach(func() {
+				actor.ZipModifiedTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+			})
+
+			It("produces zips with the same SHA256 across runs", func() {
+				zipSum := func(resources []Resource) [sha256.Size]byte {
+					zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+					Expect(err).ToNot(HaveOccurred())
+					defer os.Remove(zipPath)
+
+					contents, err := ioutil.ReadFile(zipPath)
+					Expect(err).ToNot(HaveOccurred())
+					return sha256.Sum256(contents)
+				}
+
+				firstSum := zipSum(resources)
+				Expect(zipSum([]Resource{resources[3], resources[1], resources[2], resources[0]})).To(Equal(firstSum))
+			})
+
+			It("produces identical zips regardless of the files' modification times", func() {
+				firstZip := new(bytes.Buffer)
+				Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, firstZip)).To(Succeed())
+
+				later := modified.Add(time.Hour)
+				Expect(os.Chtimes(filepath.Join(srcDir, "tmpFile2"), later, later)).To(Succeed())
+				Expect(os.Chtimes(filepath.Join(srcDir, "level1"), later, later)).To(Succeed())
+
+				secondZip := new(bytes.Buffer)
+				Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, secondZip)).To(Succeed())
+
+				Expect(secondZip.Bytes()).To(Equal(firstZip.Bytes()))
+
+				reader, err := zip.NewReader(bytes.NewReader(secondZip.Bytes()), int64(secondZip.Len()))
+				Expect(err).ToNot(HaveOccurred())
+				for _, file := range reader.File {
+					Expect(file.Modified.Equal(actor.ZipModifiedTime)).To(BeTrue())
+				}
+			})
+
+			Context("when the actor also deduplicates files", func() {
+				BeforeEach(func() {
+					actor.ZipDeduplicate = true
+					Expect(ioutil.WriteFile(filepath.Join(srcDir, "level1", "tmpFile4"), []byte("Hello, Binky"), 0600)).To(Succeed())
+					resources = append(resources, Resource{Filename: "level1/tmpFile4", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12})
+				})
+
+				It("sets the modification time of every copy", func() {
+					buffer := new(bytes.Buffer)
+					Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)).To(Succeed())
+
+					reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(resourceFilenamesFromZip(reader.File)).To(ContainElement("level1/tmpFile4"))
+					for _, file := range reader.File {
+						Expect(file.Modified.Equal(actor.ZipModifiedTime)).To(BeTrue(), file.Name)
+						Expect(file.ModifiedDate).To(BeEquivalentTo(0x21))
+						Expect(file.ModifiedTime).To(BeZero())
+					}
+				})
+			})
+		})
+	})
+
+	Describe("concurrent use", func() {
+		It("gathers and zips the same directory from many goroutines", func() {
+			expectedResources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			const goroutines = 20
+			errs := make(chan error, goroutines)
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					if err != nil {
+						errs <- err
+						return
+					}
+					Expect(resources).To(Equal(expectedResources))
+
+					zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+					if err != nil {
+						errs <- err
+						return
+					}
+					defer os.Remove(zipPath)
+
+					reader, err := zip.OpenReader(zipPath)
+					if err != nil {
+						errs <- err
+						return
+					}
+					defer reader.Close()
+					Expect(reader.File).To(HaveLen(len(expectedResources)))
+				}()
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				Expect(err).ToNot(HaveOccurred())
+			}
+		})
+	})
+
+	Describe("DescribeZipManifest", func() {
+		var resources []Resource
+
+		BeforeEach(func() {
+			resources = []Resource{
+				{Filename: "level1"},
+				{Filename: "level1/level2"},
+				{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4"},
+				{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95"},
+				{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879"},
+			}
+		})
+
+		It("describes the entries that would be written to the zip", func() {
+			entries, err := actor.DescribeZipManifest(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(entries).To(HaveLen(5))
+			Expect(entries[0].Name).To(Equal("level1/"))
+			Expect(entries[0].Method).To(Equal(zip.Store))
+			Expect(entries[0].Size).To(BeZero())
+			Expect(entries[3].Name).To(Equal("tmpFile2"))
+			Expect(entries[3].Method).To(Equal(zip.Deflate))
+			Expect(entries[3].Size).To(BeEquivalentTo(12))
+
+			buffer := new(bytes.Buffer)
+			Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)).To(Succeed())
+			reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(reader.File).To(HaveLen(len(entries)))
+			for i, file := range reader.File {
+				Expect(entries[i].Name).To(Equal(file.Name))
+				Expect(entries[i].Mode).To(Equal(file.Mode()))
+				Expect(entries[i].Method).To(Equal(file.Method))
+				Expect(entries[i].Size).To(BeEquivalentTo(file.UncompressedSize64))
+			}
+		})
+
+		Context("when the actor is configured to store files uncompressed", func() {
+			BeforeEach(func() {
+				actor.ZipStoreUncompressed = true
+			})
+
+			It("describes the files as stored", func() {
+				entries, err := actor.DescribeZipManifest(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(entries[4].Method).To(Equal(zip.Store))
+			})
+		})
+
+		Context("when the actor is configured to embed a manifest", func() {
+			BeforeEach(func() {
+				actor.ZipEmbeddedManifestName = DefaultZipEmbeddedManifestName
+			})
+
+			It("describes the manifest last", func() {
+				entries, err := actor.DescribeZipManifest(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+
+				buffer := new(bytes.Buffer)
+				Expect(actor.ZipDirectoryResourcesToWriter(srcDir, resources, buffer)).To(Succeed())
+				reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(entries).To(HaveLen(6))
+				Expect(reader.File).To(HaveLen(6))
+				Expect(entries[5].Name).To(Equal(".cf-manifest.json"))
+				Expect(entries[5].Name).To(Equal(reader.File[5].Name))
+				Expect(entries[5].Mode).To(Equal(reader.File[5].Mode()))
+				Expect(entries[5].Method).To(Equal(reader.File[5].Method))
+				Expect(entries[5].Size).To(BeEquivalentTo(reader.File[5].UncompressedSize64))
+			})
+		})
+
+		Context("when a file does not exist", func() {
+			It("returns the error", func() {
+				_, err := actor.DescribeZipManifest(srcDir, []Resource{{Filename: "missing"}})
+				Expect(os.IsNotExist(err)).To(BeTrue())
 			})
 		})
 	})
@@ -139,3 +3325,69 @@ func expectFileContentsToEqual(file *zip.File, expectedContents string) {
 
 	Expect(string(body)).To(Equal(expectedContents))
 }
+
+func resourceFilenames(resources []Resource) []string {
+	var filenames []string
+	for _, resource := range resources {
+		filenames = append(filenames, resource.Filename)
+	}
+	return filenames
+}
+
+// fullDiskWriter fails every write with err, like a file on a full disk.
+type fullDiskWriter struct {
+	err error
+}
+
+func (w fullDiskWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+// windowsZipper returns a zip with the entry names written by common Windows
+// tools: CP437 without the UTF-8 flag, and UTF-8 with a byte order mark.
+func windowsZipper() []byte {
+	buffer := new(bytes.Buffer)
+	writer := zip.NewWriter(buffer)
+	for _, header := range []*zip.FileHeader{
+		{Name: "caf\x82/", NonUTF8: true},
+		{Name: "caf\x82/men\x81.txt", NonUTF8: true},
+		{Name: "\ufeffnaïve.txt"},
+		{Name: "\ufeffreadme.txt", NonUTF8: true},
+		{Name: "日本.txt", NonUTF8: true},
+	} {
+		fileWriter, err := writer.CreateHeader(header)
+		Expect(err).ToNot(HaveOccurred())
+		if !strings.HasSuffix(header.Name, "/") {
+			_, err = fileWriter.Write([]byte("why hello"))
+			Expect(err).ToNot(HaveOccurred())
+		}
+	}
+	Expect(writer.Close()).To(Succeed())
+	return buffer.Bytes()
+}
+
+func resourceFilenamesFromZip(files []*zip.File) []string {
+	var filenames []string
+	for _, file := range files {
+		filenames = append(filenames, file.Name)
+	}
+	return filenames
+}
+
+func findResource(resources []Resource, filename string) Resource {
+	for _, resource := range resources {
+		if resource.Filename == filename {
+			return resource
+		}
+	}
+	return Resource{}
+}
+
+func findZipFile(files []*zip.File, name string) *zip.File {
+	for _, file := range files {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
@@ -3,14 +3,20 @@
 package v2action_test
 
 import (
+	"archive/zip"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	. "code.cloudfoundry.org/cli/actor/v2action"
 	"code.cloudfoundry.org/cli/actor/v2action/v2actionfakes"
 	"code.cloudfoundry.org/ykk"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
@@ -52,6 +58,10 @@ var _ = Describe("Resource Actions", func() {
 			defer tmpfile.Close()
 			archive = tmpfile.Name()
 
+			Expect(os.Chmod(srcDir, 0755)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(srcDir, "level1"), 0750)).To(Succeed())
+			Expect(os.Chmod(filepath.Join(srcDir, "level1", "level2"), 0700)).To(Succeed())
+
 			err = zipit(srcDir, archive, "")
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -66,12 +76,11 @@ var _ = Describe("Resource Actions", func() {
 
 			Expect(resources).To(Equal(
 				[]Resource{
-					{Filename: "/"},
-					{Filename: "/level1/"},
-					{Filename: "/level1/level2/"},
-					{Filename: "/level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0644},
-					{Filename: "/tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751},
-					{Filename: "/tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0655},
+					{Filename: "level1/", Mode: os.ModeDir | 0750},
+					{Filename: "level1/level2/", Mode: os.ModeDir | 0700},
+					{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0644},
+					{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751},
+					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0655},
 				}))
 		})
 
@@ -79,6 +88,40 @@ var _ = Describe("Resource Actions", func() {
 			_, err := actor.GatherArchiveResources("/does/not/exist")
 			Expect(os.IsNotExist(err)).To(BeTrue())
 		})
+
+		DescribeTable("gathering tar archives",
+			func(gzipped bool) {
+				tmpfile, err := ioutil.TempFile("", "example-tar")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tmpfile.Close()).To(Succeed())
+				defer os.RemoveAll(tmpfile.Name())
+
+				err = tarit(srcDir, tmpfile.Name(), gzipped)
+				Expect(err).ToNot(HaveOccurred())
+
+				resources, err := actor.GatherArchiveResources(tmpfile.Name())
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resources).To(Equal(
+					[]Resource{
+						{Filename: "level1/", Mode: os.ModeDir | 0750},
+						{Filename: "level1/level2/", Mode: os.ModeDir | 0700},
+						{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0644},
+						{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751},
+						{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0655},
+					}))
+			},
+
+			Entry("when the archive is a tar", false),
+			Entry("when the archive is a gzipped tar", true),
+		)
+	})
+
+	Describe("NormalizeMode", func() {
+		It("returns the mode unchanged", func() {
+			Expect(actor.NormalizeMode(0644)).To(Equal(os.FileMode(0644)))
+			Expect(actor.NormalizeMode(0751)).To(Equal(os.FileMode(0751)))
+		})
 	})
 
 	Describe("GatherDirectoryResources", func() {
@@ -95,6 +138,441 @@ var _ = Describe("Resource Actions", func() {
 					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0655},
 				}))
 		})
+
+		Context("when the directory contains symlinks", func() {
+			BeforeEach(func() {
+				Expect(os.Symlink("tmpFile2", filepath.Join(srcDir, "fileLink"))).To(Succeed())
+				Expect(os.Symlink("level1", filepath.Join(srcDir, "dirLink"))).To(Succeed())
+			})
+
+			It("records the symlink mode and the target's contents", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resources).To(ContainElement(Resource{Filename: "fileLink", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: os.ModeSymlink | 0751}))
+				Expect(resources).To(ContainElement(Resource{Filename: "dirLink", Mode: os.ModeSymlink | os.ModeDir}))
+			})
+
+			It("can zip the gathered resources", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.RemoveAll(zipPath)).To(Succeed())
+			})
+
+			Context("when PreserveSymlinks is set", func() {
+				BeforeEach(func() {
+					actor.PreserveSymlinks = true
+				})
+
+				It("records the checksums of the symlinks' targets", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(resources).To(ContainElement(Resource{Filename: "fileLink", SHA1: "e9620e21b7a71c8011a9728f9544fc1f178009c6", Size: 8, Mode: os.ModeSymlink | 0777}))
+					Expect(resources).To(ContainElement(Resource{Filename: "dirLink", SHA1: "cea34097f0962c820d2588a5fac7aa19ec487ff2", Size: 6, Mode: os.ModeSymlink | 0777}))
+				})
+
+				It("zips the symlinks as symlink entries", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+
+					zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+					Expect(err).ToNot(HaveOccurred())
+					defer os.RemoveAll(zipPath)
+
+					zipFile, err := os.Open(zipPath)
+					Expect(err).ToNot(HaveOccurred())
+					defer zipFile.Close()
+
+					zipInfo, err := zipFile.Stat()
+					Expect(err).ToNot(HaveOccurred())
+
+					reader, err := ykk.NewReader(zipFile, zipInfo.Size())
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(reader.File[0].Name).To(Equal("dirLink"))
+					Expect(reader.File[0].Mode()).To(Equal(os.ModeSymlink | 0777))
+					expectFileContentsToEqual(reader.File[0], "level1")
+
+					Expect(reader.File[1].Name).To(Equal("fileLink"))
+					Expect(reader.File[1].Mode()).To(Equal(os.ModeSymlink | 0777))
+					expectFileContentsToEqual(reader.File[1], "tmpFile2")
+				})
+
+				It("describes the symlinks as symlink entries", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+
+					entries, err := actor.DescribeZipManifest(srcDir, resources)
+					Expect(err).ToNot(HaveOccurred())
+
+					Expect(entries[0].Name).To(Equal("dirLink"))
+					Expect(entries[0].Mode).To(Equal(os.ModeSymlink | 0777))
+					Expect(entries[0].Size).To(BeEquivalentTo(6))
+
+					Expect(entries[1].Name).To(Equal("fileLink"))
+					Expect(entries[1].Mode).To(Equal(os.ModeSymlink | 0777))
+					Expect(entries[1].Size).To(BeEquivalentTo(8))
+				})
+
+				It("gathers the same resources from the zip", func() {
+					resources, err := actor.GatherDirectoryResources(srcDir)
+					Expect(err).ToNot(HaveOccurred())
+
+					zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+					Expect(err).ToNot(HaveOccurred())
+					defer os.RemoveAll(zipPath)
+
+					archivedResources, err := actor.GatherArchiveResources(zipPath)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(archivedResources).To(ContainElement(Resource{Filename: "fileLink", SHA1: "e9620e21b7a71c8011a9728f9544fc1f178009c6", Size: 8, Mode: os.ModeSymlink | 0777}))
+					Expect(archivedResources).To(ContainElement(Resource{Filename: "dirLink", SHA1: "cea34097f0962c820d2588a5fac7aa19ec487ff2", Size: 6, Mode: os.ModeSymlink | 0777}))
+				})
+
+				Context("when a symlink has an absolute target", func() {
+					BeforeEach(func() {
+						resolvedSrcDir, err := filepath.EvalSymlinks(srcDir)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(os.Symlink(filepath.Join(resolvedSrcDir, "tmpFile2"), filepath.Join(srcDir, "level1", "absLink"))).To(Succeed())
+					})
+
+					It("stores the target relative to the symlink", func() {
+						resources, err := actor.GatherDirectoryResources(srcDir)
+						Expect(err).ToNot(HaveOccurred())
+
+						zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+						Expect(err).ToNot(HaveOccurred())
+						defer os.RemoveAll(zipPath)
+
+						zipFile, err := os.Open(zipPath)
+						Expect(err).ToNot(HaveOccurred())
+						defer zipFile.Close()
+
+						zipInfo, err := zipFile.Stat()
+						Expect(err).ToNot(HaveOccurred())
+
+						reader, err := ykk.NewReader(zipFile, zipInfo.Size())
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(reader.File[3].Name).To(Equal("level1/absLink"))
+						expectFileContentsToEqual(reader.File[3], "../tmpFile2")
+					})
+				})
+
+				Context("when a symlink changes after it was gathered", func() {
+					It("returns a FileChangedError", func() {
+						resources, err := actor.GatherDirectoryResources(srcDir)
+						Expect(err).ToNot(HaveOccurred())
+
+						Expect(os.Remove(filepath.Join(srcDir, "fileLink"))).To(Succeed())
+						Expect(os.Symlink("tmpFile3", filepath.Join(srcDir, "fileLink"))).To(Succeed())
+
+						_, err = actor.ZipDirectoryResources(srcDir, resources)
+						Expect(err).To(BeAssignableToTypeOf(FileChangedError{}))
+					})
+				})
+			})
+		})
+
+		Context("when files have setuid, setgid or sticky bits", func() {
+			BeforeEach(func() {
+				Expect(os.Chmod(filepath.Join(srcDir, "tmpFile2"), 0751|os.ModeSetuid|os.ModeSetgid)).To(Succeed())
+				Expect(os.Chmod(filepath.Join(srcDir, "level1"), 0755|os.ModeSticky)).To(Succeed())
+			})
+
+			It("keeps the bits through zipping and gathering the zip", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(resources).To(ContainElement(Resource{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751 | os.ModeSetuid | os.ModeSetgid}))
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(zipPath)
+
+				zipFile, err := os.Open(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				defer zipFile.Close()
+
+				zipInfo, err := zipFile.Stat()
+				Expect(err).ToNot(HaveOccurred())
+
+				reader, err := ykk.NewReader(zipFile, zipInfo.Size())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(reader.File[0].Name).To(Equal("level1/"))
+				Expect(reader.File[0].Mode()).To(Equal(os.ModeDir | os.ModeSticky | 0755))
+
+				archivedResources, err := actor.GatherArchiveResources(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(archivedResources).To(ContainElement(Resource{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751 | os.ModeSetuid | os.ModeSetgid}))
+			})
+
+			It("keeps the bits when rezipping the gathered archive", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(zipPath)
+
+				archivedResources, err := actor.GatherArchiveResources(zipPath)
+				Expect(err).ToNot(HaveOccurred())
+
+				rezippedPath, err := actor.ZipArchiveResources(zipPath, archivedResources)
+				Expect(err).ToNot(HaveOccurred())
+				defer os.RemoveAll(rezippedPath)
+
+				rezippedResources, err := actor.GatherArchiveResources(rezippedPath)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rezippedResources).To(ContainElement(Resource{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751 | os.ModeSetuid | os.ModeSetgid}))
+			})
+		})
+
+		Context("when a symlink points outside of the source directory", func() {
+			var outsideFile string
+
+			BeforeEach(func() {
+				tmpfile, err := ioutil.TempFile("", "outside-file")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(tmpfile.Close()).To(Succeed())
+				outsideFile, err = filepath.EvalSymlinks(tmpfile.Name())
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(os.Symlink(outsideFile, filepath.Join(srcDir, "badLink"))).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(outsideFile)).To(Succeed())
+			})
+
+			It("returns a SymlinkOutsideDirectoryError", func() {
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(Equal(SymlinkOutsideDirectoryError{
+					Filename: filepath.Join(srcDir, "badLink"),
+					Target:   outsideFile,
+				}))
+			})
+		})
+	})
+
+	Describe("special files", func() {
+		var fifoPath string
+
+		BeforeEach(func() {
+			fifoPath = filepath.Join(srcDir, "level1", "fifo")
+			Expect(syscall.Mkfifo(fifoPath, 0600)).To(Succeed())
+		})
+
+		It("returns an UnsupportedFileTypeError without blocking on the FIFO", func(done Done) {
+			_, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).To(MatchError(UnsupportedFileTypeError{Filename: fifoPath, Mode: os.ModeNamedPipe | 0600}))
+			close(done)
+		}, 5)
+
+		It("skips the FIFO when gathering with a report", func(done Done) {
+			report, err := actor.GatherDirectoryResourcesWithReport(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resourceFilenames(report.Resources)).ToNot(ContainElement("level1/fifo"))
+			Expect(report.Skipped).To(Equal([]SkippedFile{{
+				Path: fifoPath,
+				Err:  UnsupportedFileTypeError{Filename: fifoPath, Mode: os.ModeNamedPipe | 0600},
+			}}))
+			close(done)
+		}, 5)
+
+		It("returns an UnsupportedFileTypeError when gathering the FIFO itself", func(done Done) {
+			_, err := actor.GatherResources(fifoPath)
+			Expect(err).To(MatchError(UnsupportedFileTypeError{Filename: fifoPath, Mode: os.ModeNamedPipe | 0600}))
+			close(done)
+		}, 5)
+	})
+
+	Describe("GatherDirectoryResourcesWithReport", func() {
+		Context("when every file can be read", func() {
+			It("gathers all the resources without skipping any", func() {
+				report, err := actor.GatherDirectoryResourcesWithReport(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(report.Resources).To(Equal(resources))
+				Expect(report.Skipped).To(BeEmpty())
+				Expect(report.HardLinks).To(BeEmpty())
+			})
+		})
+
+		Context("when the directory contains hard links", func() {
+			BeforeEach(func() {
+				Expect(os.Link(filepath.Join(srcDir, "tmpFile2"), filepath.Join(srcDir, "level1", "hardLink2"))).To(Succeed())
+				Expect(os.Link(filepath.Join(srcDir, "tmpFile2"), filepath.Join(srcDir, "hardLink2"))).To(Succeed())
+				Expect(os.Link(filepath.Join(srcDir, "tmpFile3"), filepath.Join(srcDir, "level1", "level2", "hardLink3"))).To(Succeed())
+				Expect(os.Symlink("tmpFile2", filepath.Join(srcDir, "symLink2"))).To(Succeed())
+			})
+
+			It("reports the files linked together", func() {
+				report, err := actor.GatherDirectoryResourcesWithReport(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(report.Resources).To(ContainElement(Resource{Filename: "hardLink2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0751}))
+				Expect(report.HardLinks).To(Equal([][]string{
+					{"hardLink2", "level1/hardLink2", "tmpFile2"},
+					{"level1/level2/hardLink3", "tmpFile3"},
+				}))
+			})
+		})
+
+		Context("when symlinks cannot be resolved", func() {
+			var outsideDir string
+
+			BeforeEach(func() {
+				var err error
+				outsideDir, err = ioutil.TempDir("", "outside-dir")
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(os.Symlink(outsideDir, filepath.Join(srcDir, "badLink"))).To(Succeed())
+				Expect(os.Symlink("missing", filepath.Join(srcDir, "level1", "danglingLink"))).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(outsideDir)).To(Succeed())
+			})
+
+			It("skips the symlinks and gathers everything else", func() {
+				report, err := actor.GatherDirectoryResourcesWithReport(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resourceFilenames(report.Resources)).To(Equal([]string{
+					"level1",
+					"level1/level2",
+					"level1/level2/tmpFile1",
+					"tmpFile2",
+					"tmpFile3",
+				}))
+
+				Expect(report.Skipped).To(HaveLen(2))
+				Expect(report.Skipped[0].Path).To(Equal(filepath.Join(srcDir, "badLink")))
+				Expect(report.Skipped[0].Err).To(BeAssignableToTypeOf(SymlinkOutsideDirectoryError{}))
+				Expect(report.Skipped[1].Path).To(Equal(filepath.Join(srcDir, "level1", "danglingLink")))
+				Expect(os.IsNotExist(report.Skipped[1].Err)).To(BeTrue())
+			})
+		})
+
+		Context("when files and directories cannot be read", func() {
+			BeforeEach(func() {
+				if os.Geteuid() == 0 {
+					Skip("file permissions are not enforced for root")
+				}
+
+				Expect(os.Chmod(filepath.Join(srcDir, "tmpFile2"), 0000)).To(Succeed())
+				Expect(os.Chmod(filepath.Join(srcDir, "level1", "level2"), 0000)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.Chmod(filepath.Join(srcDir, "tmpFile2"), 0644)).To(Succeed())
+				Expect(os.Chmod(filepath.Join(srcDir, "level1", "level2"), 0755)).To(Succeed())
+			})
+
+			It("skips the unreadable files and directories", func() {
+				report, err := actor.GatherDirectoryResourcesWithReport(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resourceFilenames(report.Resources)).To(Equal([]string{
+					"level1",
+					"tmpFile3",
+				}))
+
+				Expect(report.Skipped).To(HaveLen(2))
+				Expect(report.Skipped[0].Path).To(Equal(filepath.Join(srcDir, "level1", "level2")))
+				Expect(os.IsPermission(report.Skipped[0].Err)).To(BeTrue())
+				Expect(report.Skipped[1].Path).To(Equal(filepath.Join(srcDir, "tmpFile2")))
+				Expect(os.IsPermission(report.Skipped[1].Err)).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("transient open failures", func() {
+		var (
+			opens map[string]int
+			mutex sync.Mutex
+		)
+
+		BeforeEach(func() {
+			opens = map[string]int{}
+			actor.OpenRetryDelay = time.Millisecond
+		})
+
+		// failingOpen fails to open path with err the first failures times.
+		failingOpen := func(path string, failures int, err error) func(string) (*os.File, error) {
+			return func(name string) (*os.File, error) {
+				mutex.Lock()
+				opens[name]++
+				failed := name == path && opens[name] <= failures
+				mutex.Unlock()
+
+				if failed {
+					return nil, &os.PathError{Op: "open", Path: name, Err: err}
+				}
+				return os.Open(name)
+			}
+		}
+
+		It("retries opening files while gathering and zipping", func() {
+			path := filepath.Join(srcDir, "tmpFile2")
+			actor.OpenFile = failingOpen(path, 2, syscall.EBUSY)
+
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opens[path]).To(Equal(3))
+
+			opens = map[string]int{}
+			zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Remove(zipPath)).To(Succeed())
+			Expect(opens[path]).To(Equal(3))
+		})
+
+		Context("when the failure outlasts the retries", func() {
+			BeforeEach(func() {
+				actor.OpenRetryAttempts = 2
+			})
+
+			It("returns the error", func() {
+				path := filepath.Join(srcDir, "tmpFile2")
+				actor.OpenFile = failingOpen(path, 10, syscall.EBUSY)
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(&os.PathError{Op: "open", Path: path, Err: syscall.EBUSY}))
+				Expect(opens[path]).To(Equal(3))
+			})
+		})
+
+		Context("when retries are disabled", func() {
+			BeforeEach(func() {
+				actor.OpenRetryAttempts = -1
+			})
+
+			It("returns the first error", func() {
+				path := filepath.Join(srcDir, "tmpFile2")
+				actor.OpenFile = failingOpen(path, 1, syscall.EBUSY)
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(HaveOccurred())
+				Expect(opens[path]).To(Equal(1))
+			})
+		})
+
+		Context("when the failure is not transient", func() {
+			It("returns the error without retrying", func() {
+				path := filepath.Join(srcDir, "tmpFile2")
+				actor.OpenFile = failingOpen(path, 1, syscall.EACCES)
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(&os.PathError{Op: "open", Path: path, Err: syscall.EACCES}))
+				Expect(opens[path]).To(Equal(1))
+			})
+		})
 	})
 
 	Describe("ZipDirectoryResources", func() {
@@ -147,5 +625,174 @@ var _ = Describe("Resource Actions", func() {
 				Expect(reader.File[4].Mode()).To(Equal(os.FileMode(0655)))
 			})
 		})
+
+		Context("when zipping fails", func() {
+			var (
+				tmpDir       string
+				originalTemp string
+			)
+
+			BeforeEach(func() {
+				var err error
+				tmpDir, err = ioutil.TempDir("", "zip-failure")
+				Expect(err).ToNot(HaveOccurred())
+
+				originalTemp = os.Getenv("TMPDIR")
+				Expect(os.Setenv("TMPDIR", tmpDir)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.Setenv("TMPDIR", originalTemp)).To(Succeed())
+				Expect(os.RemoveAll(tmpDir)).To(Succeed())
+			})
+
+			Context("because the context is cancelled", func() {
+				It("removes the partially written zip file", func() {
+					ctx, cancel := context.WithCancel(context.Background())
+					cancel()
+
+					_, err := actor.ZipDirectoryResourcesWithContext(ctx, srcDir, resources)
+					Expect(err).To(MatchError(context.Canceled))
+
+					files, err := ioutil.ReadDir(tmpDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(files).To(HaveLen(1))
+					Expect(filepath.Join(tmpDir, files[0].Name())).To(Equal(resultZip))
+				})
+			})
+
+			Context("because a file has changed", func() {
+				BeforeEach(func() {
+					resources[4].SHA1 = "i dunno, 7?"
+				})
+
+				It("removes the partially written zip file", func() {
+					Expect(executeErr).To(MatchError(FileChangedError{
+						Filename:     filepath.Join(srcDir, "tmpFile3"),
+						ExpectedSHA1: "i dunno, 7?",
+						ActualSHA1:   "f4c9ca85f3e084ffad3abbdabbd2a890c034c879",
+					}))
+					Expect(resultZip).To(BeEmpty())
+
+					files, err := ioutil.ReadDir(tmpDir)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(files).To(BeEmpty())
+				})
+			})
+		})
+	})
+
+	Describe("ExtractArchive", func() {
+		var (
+			archive string
+			destDir string
+		)
+
+		BeforeEach(func() {
+			tmpfile, err := ioutil.TempFile("", "example")
+			Expect(err).ToNot(HaveOccurred())
+			defer tmpfile.Close()
+			archive = tmpfile.Name()
+
+			destDir, err = ioutil.TempDir("", "extracted")
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(os.Chmod(filepath.Join(srcDir, "tmpFile2"), 0751|os.ModeSetuid)).To(Succeed())
+		})
+
+		JustBeforeEach(func() {
+			Expect(zipit(srcDir, archive, "")).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(archive)).To(Succeed())
+			Expect(os.RemoveAll(destDir)).To(Succeed())
+		})
+
+		It("gives the files and directories their archived modes", func() {
+			_, err := actor.ExtractArchive(archive, destDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, name := range []string{"level1", "level1/level2", "level1/level2/tmpFile1", "tmpFile2", "tmpFile3"} {
+				srcInfo, err := os.Stat(filepath.Join(srcDir, name))
+				Expect(err).ToNot(HaveOccurred())
+				destInfo, err := os.Stat(filepath.Join(destDir, name))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(destInfo.Mode()).To(Equal(srcInfo.Mode()), name)
+			}
+		})
+
+		Context("when the archive stores directory modes", func() {
+			JustBeforeEach(func() {
+				file, err := os.Create(archive)
+				Expect(err).ToNot(HaveOccurred())
+				defer file.Close()
+
+				writer := zip.NewWriter(file)
+				header := &zip.FileHeader{Name: "private/"}
+				header.SetMode(os.ModeDir | 0700)
+				_, err = writer.CreateHeader(header)
+				Expect(err).ToNot(HaveOccurred())
+				// written without a Unix mode, like zips made on Windows
+				_, err = writer.Create("dos/")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(writer.Close()).To(Succeed())
+			})
+
+			It("gives the directories their archived modes, defaulting those without one", func() {
+				_, err := actor.ExtractArchive(archive, destDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				info, err := os.Stat(filepath.Join(destDir, "private"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.Mode()).To(Equal(os.ModeDir | 0700))
+
+				info, err = os.Stat(filepath.Join(destDir, "dos"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.Mode()).To(Equal(os.ModeDir | DefaultFolderPermissions))
+			})
+		})
+
+		Context("when a directory is read only", func() {
+			BeforeEach(func() {
+				Expect(os.Chmod(filepath.Join(srcDir, "level1", "level2"), 0555)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.Chmod(filepath.Join(srcDir, "level1", "level2"), 0755)).To(Succeed())
+				Expect(os.Chmod(filepath.Join(destDir, "level1", "level2"), 0755)).To(Succeed())
+			})
+
+			It("extracts its files before making it read only", func() {
+				_, err := actor.ExtractArchive(archive, destDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(ioutil.ReadFile(filepath.Join(destDir, "level1", "level2", "tmpFile1"))).To(Equal([]byte("why hello")))
+				info, err := os.Stat(filepath.Join(destDir, "level1", "level2"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0555)))
+			})
+		})
+
+		Context("when the destination contains a symlink leading outside of it", func() {
+			var outsideDir string
+
+			BeforeEach(func() {
+				var err error
+				outsideDir, err = ioutil.TempDir("", "outside")
+				Expect(err).ToNot(HaveOccurred())
+				Expect(os.Symlink(outsideDir, filepath.Join(destDir, "level1"))).To(Succeed())
+			})
+
+			AfterEach(func() {
+				Expect(os.RemoveAll(outsideDir)).To(Succeed())
+			})
+
+			It("returns an UnsafeArchivePathError without writing outside of it", func() {
+				_, err := actor.ExtractArchive(archive, destDir)
+				Expect(err).To(MatchError(UnsafeArchivePathError{Name: "level1/"}))
+				Expect(ioutil.ReadDir(outsideDir)).To(BeEmpty())
+			})
+		})
 	})
 })
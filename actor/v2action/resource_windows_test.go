@@ -1,9 +1,13 @@
 package v2action_test
 
 import (
+	"archive/zip"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	. "code.cloudfoundry.org/cli/actor/v2action"
 	"code.cloudfoundry.org/cli/actor/v2action/v2actionfakes"
@@ -65,12 +69,11 @@ var _ = Describe("Resource Actions", func() {
 
 				Expect(resources).To(Equal(
 					[]Resource{
-						{Filename: "/"},
-						{Filename: "/level1/"},
-						{Filename: "/level1/level2/"},
-						{Filename: "/level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0666},
-						{Filename: "/tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0666},
-						{Filename: "/tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0666},
+						{Filename: "level1/", Mode: os.ModeDir | 0777},
+						{Filename: "level1/level2/", Mode: os.ModeDir | 0777},
+						{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0666},
+						{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0666},
+						{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0666},
 					}))
 			})
 		})
@@ -83,6 +86,23 @@ var _ = Describe("Resource Actions", func() {
 		})
 	})
 
+	Describe("NormalizeMode", func() {
+		It("gives the owner read, write and execute permissions", func() {
+			Expect(actor.NormalizeMode(0444)).To(Equal(os.FileMode(0744)))
+			Expect(actor.NormalizeMode(0666)).To(Equal(os.FileMode(0766)))
+		})
+
+		Context("when the actor is configured to preserve file modes", func() {
+			BeforeEach(func() {
+				actor.PreserveFileModes = true
+			})
+
+			It("returns the mode unchanged", func() {
+				Expect(actor.NormalizeMode(0666)).To(Equal(os.FileMode(0666)))
+			})
+		})
+	})
+
 	Describe("GatherDirectoryResources", func() {
 		It("gathers a list of all directories files in a source directory", func() {
 			resources, err := actor.GatherDirectoryResources(srcDir)
@@ -97,6 +117,109 @@ var _ = Describe("Resource Actions", func() {
 					{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0766},
 				}))
 		})
+
+		Context("when the actor is configured to preserve file modes", func() {
+			BeforeEach(func() {
+				actor.PreserveFileModes = true
+			})
+
+			It("keeps the file modes reported by windows", func() {
+				resources, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).ToNot(HaveOccurred())
+
+				Expect(resources).To(Equal(
+					[]Resource{
+						{Filename: "level1"},
+						{Filename: "level1/level2"},
+						{Filename: "level1/level2/tmpFile1", SHA1: "9e36efec86d571de3a38389ea799a796fe4782f4", Size: 9, Mode: 0666},
+						{Filename: "tmpFile2", SHA1: "e594bdc795bb293a0e55724137e53a36dc0d9e95", Size: 12, Mode: 0666},
+						{Filename: "tmpFile3", SHA1: "f4c9ca85f3e084ffad3abbdabbd2a890c034c879", Size: 10, Mode: 0666},
+					}))
+			})
+		})
+	})
+
+	Describe("transient open failures", func() {
+		var (
+			opens map[string]int
+			mutex sync.Mutex
+		)
+
+		BeforeEach(func() {
+			opens = map[string]int{}
+			actor.OpenRetryDelay = time.Millisecond
+		})
+
+		// failingOpen fails to open path with err the first failures times.
+		failingOpen := func(path string, failures int, err error) func(string) (*os.File, error) {
+			return func(name string) (*os.File, error) {
+				mutex.Lock()
+				opens[name]++
+				failed := name == path && opens[name] <= failures
+				mutex.Unlock()
+
+				if failed {
+					return nil, &os.PathError{Op: "open", Path: name, Err: err}
+				}
+				return os.Open(name)
+			}
+		}
+
+		It("retries opening files while gathering and zipping", func() {
+			path := filepath.Join(srcDir, "tmpFile2")
+			actor.OpenFile = failingOpen(path, 2, syscall.Errno(32))
+
+			resources, err := actor.GatherDirectoryResources(srcDir)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(opens[path]).To(Equal(3))
+
+			opens = map[string]int{}
+			zipPath, err := actor.ZipDirectoryResources(srcDir, resources)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(os.Remove(zipPath)).To(Succeed())
+			Expect(opens[path]).To(Equal(3))
+		})
+
+		Context("when the failure outlasts the retries", func() {
+			BeforeEach(func() {
+				actor.OpenRetryAttempts = 2
+			})
+
+			It("returns the error", func() {
+				path := filepath.Join(srcDir, "tmpFile2")
+				actor.OpenFile = failingOpen(path, 10, syscall.Errno(32))
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(&os.PathError{Op: "open", Path: path, Err: syscall.Errno(32)}))
+				Expect(opens[path]).To(Equal(3))
+			})
+		})
+
+		Context("when retries are disabled", func() {
+			BeforeEach(func() {
+				actor.OpenRetryAttempts = -1
+			})
+
+			It("returns the first error", func() {
+				path := filepath.Join(srcDir, "tmpFile2")
+				actor.OpenFile = failingOpen(path, 1, syscall.Errno(32))
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(HaveOccurred())
+				Expect(opens[path]).To(Equal(1))
+			})
+		})
+
+		Context("when the failure is not transient", func() {
+			It("returns the error without retrying", func() {
+				path := filepath.Join(srcDir, "tmpFile2")
+				actor.OpenFile = failingOpen(path, 1, syscall.EACCES)
+
+				_, err := actor.GatherDirectoryResources(srcDir)
+				Expect(err).To(MatchError(&os.PathError{Op: "open", Path: path, Err: syscall.EACCES}))
+				Expect(opens[path]).To(Equal(1))
+			})
+		})
 	})
 
 	Describe("ZipDirectoryResources", func() {
@@ -149,5 +272,24 @@ var _ = Describe("Resource Actions", func() {
 				Expect(reader.File[4].Mode()).To(Equal(os.FileMode(0766)))
 			})
 		})
+
+		Context("when the actor is configured to preserve file modes", func() {
+			BeforeEach(func() {
+				actor.PreserveFileModes = true
+			})
+
+			It("zips the directory with the file modes reported by windows", func() {
+				Expect(executeErr).ToNot(HaveOccurred())
+
+				reader, err := zip.OpenReader(resultZip)
+				Expect(err).ToNot(HaveOccurred())
+				defer reader.Close()
+
+				Expect(reader.File).To(HaveLen(5))
+				Expect(reader.File[2].Mode()).To(Equal(os.FileMode(0666)))
+				Expect(reader.File[3].Mode()).To(Equal(os.FileMode(0666)))
+				Expect(reader.File[4].Mode()).To(Equal(os.FileMode(0666)))
+			})
+		})
 	})
 })
@@ -0,0 +1,150 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Zip64 archives", func() {
+	var (
+		actor  *Actor
+		srcDir string
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		srcDir, err = ioutil.TempDir("", "zip64")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(srcDir)).To(Succeed())
+	})
+
+	Context("when the archive has more than 65535 entries", func() {
+		var archive []byte
+
+		BeforeEach(func() {
+			buffer := new(bytes.Buffer)
+			writer := zip.NewWriter(buffer)
+			for i := 0; i < 70000; i++ {
+				_, err := writer.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("file-%d", i), Method: zip.Store})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(writer.Close()).To(Succeed())
+			archive = buffer.Bytes()
+		})
+
+		It("gathers every entry", func() {
+			resources, err := actor.GatherArchiveResourcesFromReader(bytes.NewReader(archive), int64(len(archive)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(HaveLen(70000))
+			Expect(resources[69999].Filename).To(Equal("file-69999"))
+		})
+	})
+
+	Context("when an entry is larger than 4GB", func() {
+		const entrySize = 1<<32 + 1
+
+		var archivePath string
+
+		BeforeEach(func() {
+			// checksumming and copying the entry takes long enough to slow
+			// down the whole suite, so it only runs when asked for
+			if os.Getenv("CF_ZIP64_TESTS") != "1" {
+				Skip("set CF_ZIP64_TESTS=1 to zip entries larger than 4GB")
+			}
+
+			archivePath = filepath.Join(srcDir, "large.zip")
+			writeSparseZip64(archivePath, "large-file", entrySize)
+		})
+
+		It("gathers and zips the entry", func() {
+			resources, err := actor.GatherArchiveResources(archivePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(HaveLen(1))
+			Expect(resources[0].Filename).To(Equal("large-file"))
+			Expect(resources[0].Size).To(BeEquivalentTo(entrySize))
+			Expect(resources[0].SHA1).To(Equal("e7d747b75f76e0e41e83b75bce4642816136304f"))
+
+			resultZip, err := actor.ZipArchiveResources(archivePath, resources)
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(resultZip)
+
+			reader, err := zip.OpenReader(resultZip)
+			Expect(err).ToNot(HaveOccurred())
+			defer reader.Close()
+			Expect(reader.File).To(HaveLen(1))
+			Expect(reader.File[0].UncompressedSize64).To(BeEquivalentTo(entrySize))
+		})
+	})
+})
+
+// writeSparseZip64 writes a Zip64 archive containing a single stored entry of
+// size zero bytes. The entry's contents are left as a hole in the file so the
+// archive takes almost no disk space.
+func writeSparseZip64(path string, name string, size int64) {
+	crc := crc32.NewIEEE()
+	zeros := make([]byte, 1<<20)
+	for remaining := size; remaining > 0; remaining -= int64(len(zeros)) {
+		if remaining < int64(len(zeros)) {
+			zeros = zeros[:remaining]
+		}
+		crc.Write(zeros)
+	}
+
+	file, err := os.Create(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer file.Close()
+
+	write := func(fields ...interface{}) {
+		for _, field := range fields {
+			if s, ok := field.(string); ok {
+				_, err = file.WriteString(s)
+			} else {
+				err = binary.Write(file, binary.LittleEndian, field)
+			}
+			Expect(err).ToNot(HaveOccurred())
+		}
+	}
+
+	// local file header with a Zip64 extra field holding both sizes
+	write(uint32(0x04034b50), uint16(45), uint16(0), uint16(zip.Store), uint16(0), uint16(0x21),
+		crc.Sum32(), uint32(0xffffffff), uint32(0xffffffff), uint16(len(name)), uint16(20),
+		name, uint16(0x0001), uint16(16), uint64(size), uint64(size))
+
+	headerSize, err := file.Seek(0, os.SEEK_CUR)
+	Expect(err).ToNot(HaveOccurred())
+	directoryOffset, err := file.Seek(headerSize+size, os.SEEK_SET)
+	Expect(err).ToNot(HaveOccurred())
+
+	// central directory
+	write(uint32(0x02014b50), uint16(3<<8|45), uint16(45), uint16(0), uint16(zip.Store), uint16(0), uint16(0x21),
+		crc.Sum32(), uint32(0xffffffff), uint32(0xffffffff), uint16(len(name)), uint16(20), uint16(0),
+		uint16(0), uint16(0), uint32(0100644<<16), uint32(0),
+		name, uint16(0x0001), uint16(16), uint64(size), uint64(size))
+
+	directoryEnd, err := file.Seek(0, os.SEEK_CUR)
+	Expect(err).ToNot(HaveOccurred())
+
+	// Zip64 end of central directory record and locator
+	write(uint32(0x06064b50), uint64(44), uint16(45), uint16(45), uint32(0), uint32(0),
+		uint64(1), uint64(1), uint64(directoryEnd-directoryOffset), uint64(directoryOffset))
+	write(uint32(0x07064b50), uint32(0), uint64(directoryEnd), uint32(1))
+
+	// end of central directory record pointing at the Zip64 record
+	write(uint32(0x06054b50), uint16(0), uint16(0), uint16(0xffff), uint16(0xffff),
+		uint32(0xffffffff), uint32(0xffffffff), uint16(0))
+}
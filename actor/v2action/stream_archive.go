@@ -0,0 +1,38 @@
+package v2action
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// GatherArchiveResourcesFromStream returns a list of resources for the zip,
+// tar or gzipped archive read from r, like GatherArchiveResources. Since zips
+// can only be read with random access, the whole stream is first copied to a
+// temporary file in the actor's ZipTempDir, trading disk space for not
+// holding the archive in memory. When the actor's MaxTotalSize is set, an
+// ArchiveTooLargeError is returned as soon as the stream exceeds it. The
+// temporary file is always removed before returning.
+func (actor Actor) GatherArchiveResourcesFromStream(r io.Reader) ([]Resource, error) {
+	archive, err := ioutil.TempFile(actor.ZipTempDir, streamArchiveTempFilePrefix)
+	if err != nil {
+		return nil, actor.checkDiskSpace(err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if actor.MaxTotalSize > 0 {
+		r = io.LimitReader(r, actor.MaxTotalSize+1)
+	}
+	size, err := actor.copy(archive, r)
+	if err != nil {
+		actor.logger().WithField("archive", archive.Name()).Errorln("buffering archive stream:", err)
+		return nil, actor.checkDiskSpace(err)
+	}
+	if actor.MaxTotalSize > 0 && size > actor.MaxTotalSize {
+		return nil, ArchiveTooLargeError{TotalSize: size, Limit: actor.MaxTotalSize}
+	}
+
+	actor.logger().WithField("size", size).Debug("buffered archive stream")
+	return actor.GatherArchiveResourcesFromReader(archive, size)
+}
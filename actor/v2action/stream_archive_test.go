@@ -0,0 +1,79 @@
+package v2action_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "code.cloudfoundry.org/cli/actor/v2action"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stream Archive Actions", func() {
+	var (
+		actor   *Actor
+		tempDir string
+		archive []byte
+	)
+
+	BeforeEach(func() {
+		actor = NewActor(nil, nil)
+
+		var err error
+		tempDir, err = ioutil.TempDir("", "v2-stream-archive")
+		Expect(err).ToNot(HaveOccurred())
+		actor.ZipTempDir = tempDir
+
+		buffer := new(bytes.Buffer)
+		writer := zip.NewWriter(buffer)
+		_, err = writer.Create("level1/")
+		Expect(err).ToNot(HaveOccurred())
+		fileWriter, err := writer.Create("level1/tmpFile1")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = fileWriter.Write([]byte("why hello"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+		archive = buffer.Bytes()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tempDir)).To(Succeed())
+	})
+
+	Describe("GatherArchiveResourcesFromStream", func() {
+		It("gathers the resources of the streamed archive and removes the temporary file", func() {
+			resources, err := actor.GatherArchiveResourcesFromStream(bytes.NewBuffer(archive))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resources).To(HaveLen(2))
+			Expect(resources[0].Filename).To(Equal("level1/"))
+			Expect(resources[1].Filename).To(Equal("level1/tmpFile1"))
+			Expect(resources[1].SHA1).To(Equal("9e36efec86d571de3a38389ea799a796fe4782f4"))
+			Expect(resources[1].Size).To(BeEquivalentTo(9))
+
+			Expect(ioutil.ReadDir(tempDir)).To(BeEmpty())
+		})
+
+		Context("when the stream is not a valid archive", func() {
+			It("returns an InvalidArchiveError", func() {
+				_, err := actor.GatherArchiveResourcesFromStream(strings.NewReader("Hello, Binky"))
+				Expect(err).To(MatchError(InvalidArchiveError{}))
+				Expect(ioutil.ReadDir(tempDir)).To(BeEmpty())
+			})
+		})
+
+		Context("when the stream is larger than the actor's MaxTotalSize", func() {
+			BeforeEach(func() {
+				actor.MaxTotalSize = int64(len(archive)) - 1
+			})
+
+			It("returns an ArchiveTooLargeError", func() {
+				_, err := actor.GatherArchiveResourcesFromStream(bytes.NewBuffer(archive))
+				Expect(err).To(MatchError(ArchiveTooLargeError{TotalSize: int64(len(archive)), Limit: int64(len(archive)) - 1}))
+				Expect(ioutil.ReadDir(tempDir)).To(BeEmpty())
+			})
+		})
+	})
+})
@@ -0,0 +1,68 @@
+package v2action
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readSymlinkTarget returns the target of the symlink at path, using '/' as
+// the separator. Absolute targets are made relative to the link's directory
+// so that the link still resolves once the application is extracted
+// elsewhere.
+func readSymlinkTarget(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.IsAbs(target) {
+		resolvedTarget, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return "", err
+		}
+		resolvedDir, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return "", err
+		}
+		target, err = filepath.Rel(resolvedDir, resolvedTarget)
+		if err != nil {
+			return "", err
+		}
+	}
+	return filepath.ToSlash(target), nil
+}
+
+// addSymlinkToZip writes the symlink at srcPath, described by linkInfo, to
+// the zip as a symlink entry whose content is the link's target. The target
+// must match sha1Sum, and the number of bytes written is returned.
+func (actor Actor) addSymlinkToZip(srcPath string, destPath string, sha1Sum string, linkInfo os.FileInfo, zipFile *zip.Writer) (int64, error) {
+	target, err := readSymlinkTarget(srcPath)
+	if err != nil {
+		actor.logger().WithField("srcPath", srcPath).Errorln("reading symlink in dir:", err)
+		return 0, err
+	}
+
+	sum := actor.newResourceHash()
+	io.WriteString(sum, target)
+	actualSHA1 := fmt.Sprintf("%x", sum.Sum(nil))
+	if sha1Sum != actualSHA1 {
+		return 0, FileChangedError{Filename: srcPath, ExpectedSHA1: sha1Sum, ActualSHA1: actualSHA1}
+	}
+
+	header, err := actor.newZipFileHeader(srcPath, destPath, linkInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	destFileWriter, err := zipFile.CreateHeader(header)
+	if err != nil {
+		actor.logger().Errorln("creating header:", err)
+		return 0, err
+	}
+
+	return io.Copy(destFileWriter, strings.NewReader(target))
+}
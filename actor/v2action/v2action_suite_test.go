@@ -1,7 +1,9 @@
 package v2action_test
 
 import (
+	"archive/tar"
 	"archive/zip"
+	"compress/gzip"
 	"io"
 	"os"
 	"path/filepath"
@@ -84,3 +86,55 @@ func zipit(source, target, prefix string) error {
 
 	return err
 }
+
+func tarit(source, target string, gzipped bool) error {
+	tarfile, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer tarfile.Close()
+
+	var output io.Writer = tarfile
+	if gzipped {
+		gzipWriter := gzip.NewWriter(tarfile)
+		defer gzipWriter.Close()
+		output = gzipWriter
+	}
+
+	archive := tar.NewWriter(output)
+	defer archive.Close()
+
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+
+		header.Name = strings.TrimPrefix(path, source)
+		if info.IsDir() {
+			header.Name += string(os.PathSeparator)
+		}
+
+		err = archive.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(archive, file)
+		return err
+	})
+}
@@ -0,0 +1,145 @@
+package v2action
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// zippedContent is the already compressed body of a zip entry.
+type zippedContent struct {
+	method           uint16
+	crc32            uint32
+	uncompressedSize uint64
+	data             []byte
+}
+
+// zipContentCache holds the compressed contents of files that appear more
+// than once in a zip, keyed by SHA1. Entries are dropped once the last copy
+// has been written.
+type zipContentCache struct {
+	remaining map[string]int
+	contents  map[string]zippedContent
+}
+
+// newZipContentCache returns a cache for the SHA1s shared by more than one
+// of the given resources.
+func newZipContentCache(resources []Resource) *zipContentCache {
+	counts := map[string]int{}
+	for _, resource := range resources {
+		if resource.SHA1 != "" && !isDirectoryResource(resource) {
+			counts[resource.SHA1]++
+		}
+	}
+
+	cache := &zipContentCache{
+		remaining: map[string]int{},
+		contents:  map[string]zippedContent{},
+	}
+	for sha1Sum, count := range counts {
+		if count > 1 {
+			cache.remaining[sha1Sum] = count
+		}
+	}
+	return cache
+}
+
+func (cache *zipContentCache) has(sha1Sum string) bool {
+	return cache != nil && cache.remaining[sha1Sum] > 0
+}
+
+func (cache *zipContentCache) done(sha1Sum string) {
+	cache.remaining[sha1Sum]--
+	if cache.remaining[sha1Sum] <= 0 {
+		delete(cache.remaining, sha1Sum)
+		delete(cache.contents, sha1Sum)
+	}
+}
+
+// addCachedFileToZip writes srcFile, opened from srcPath, to the zip using
+// the compressed contents cached for sha1Sum, compressing and caching them if
+// this is the first copy. The file is always read to verify that it still
+// matches sha1Sum, and the number of bytes read is returned.
+func (actor Actor) addCachedFileToZip(ctx context.Context, srcPath string, srcFile io.Reader, header *zip.FileHeader, sha1Sum string, cache *zipContentCache, zipFile *zip.Writer) (int64, error) {
+	sum := actor.newResourceHash()
+	content, cached := cache.contents[sha1Sum]
+
+	var (
+		copied int64
+		err    error
+	)
+	if cached {
+		copied, err = actor.copy(sum, contextReader{ctx: ctx, reader: srcFile})
+	} else {
+		content, err = actor.compressContent(contextReader{ctx: ctx, reader: io.TeeReader(srcFile, sum)}, header.Method)
+		copied = int64(content.uncompressedSize)
+	}
+	if err != nil {
+		actor.logger().WithField("srcPath", srcPath).Errorln("copying data in dir:", err)
+		return 0, err
+	}
+
+	actualSHA1 := fmt.Sprintf("%x", sum.Sum(nil))
+	if sha1Sum != actualSHA1 {
+		return 0, FileChangedError{Filename: srcPath, ExpectedSHA1: sha1Sum, ActualSHA1: actualSHA1}
+	}
+
+	if !cached {
+		cache.contents[sha1Sum] = content
+	}
+	defer cache.done(sha1Sum)
+
+	header.Method = content.method
+	header.CRC32 = content.crc32
+	header.UncompressedSize64 = content.uncompressedSize
+	header.CompressedSize64 = uint64(len(content.data))
+
+	destFileWriter, err := zipFile.CreateRaw(header)
+	if err != nil {
+		actor.logger().Errorln("creating header:", err)
+		return 0, err
+	}
+
+	_, err = destFileWriter.Write(content.data)
+	return copied, err
+}
+
+// compressContent reads all of reader and compresses it using method.
+func (actor Actor) compressContent(reader io.Reader, method uint16) (zippedContent, error) {
+	var buffer bytes.Buffer
+	checksum := crc32.NewIEEE()
+
+	var compressor io.WriteCloser = nopWriteCloser{&buffer}
+	if method == zip.Deflate {
+		var err error
+		compressor, err = flate.NewWriter(&buffer, actor.compressionLevel())
+		if err != nil {
+			return zippedContent{}, err
+		}
+	}
+
+	size, err := actor.copy(io.MultiWriter(compressor, checksum), reader)
+	if err != nil {
+		return zippedContent{}, err
+	}
+	if err := compressor.Close(); err != nil {
+		return zippedContent{}, err
+	}
+
+	return zippedContent{
+		method:           method,
+		crc32:            checksum.Sum32(),
+		uncompressedSize: uint64(size),
+		data:             buffer.Bytes(),
+	}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
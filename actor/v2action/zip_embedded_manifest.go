@@ -0,0 +1,90 @@
+package v2action
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultZipEmbeddedManifestName is the conventional name for the manifest
+// added to zips when ZipEmbeddedManifestName is set.
+const DefaultZipEmbeddedManifestName = ".cf-manifest.json"
+
+// EmbeddedManifestConflictError is returned when one of the resources being
+// zipped would be stored under the actor's ZipEmbeddedManifestName.
+type EmbeddedManifestConflictError struct {
+	Filename string
+}
+
+func (e EmbeddedManifestConflictError) Error() string {
+	return fmt.Sprintf("Cannot embed the manifest: %s is already one of the files being zipped", e.Filename)
+}
+
+// checkEmbeddedManifestName returns an EmbeddedManifestConflictError if any
+// of the resources is stored under the actor's ZipEmbeddedManifestName.
+// destPaths maps the Filename of renamed resources to the name they are
+// stored under.
+func (actor Actor) checkEmbeddedManifestName(resources []Resource, destPaths map[string]string) error {
+	if actor.ZipEmbeddedManifestName == "" {
+		return nil
+	}
+
+	for _, resource := range resources {
+		name := resource.Filename
+		if renamed, ok := destPaths[name]; ok {
+			name = renamed
+		}
+		if strings.TrimSuffix(name, "/") == actor.ZipEmbeddedManifestName {
+			return EmbeddedManifestConflictError{Filename: name}
+		}
+	}
+	return nil
+}
+
+// zipEntryCount returns the number of entries in a zip of resources,
+// including the embedded manifest when ZipEmbeddedManifestName is set.
+func (actor Actor) zipEntryCount(resources []Resource) int {
+	if actor.ZipEmbeddedManifestName == "" {
+		return len(resources)
+	}
+	return len(resources) + 1
+}
+
+// embeddedManifestModified is the modification time of the embedded
+// manifest unless ZipModifiedTime is set. It is the earliest time a zip
+// entry can record, so that zipping the same resources twice produces the
+// same bytes.
+var embeddedManifestModified = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// newEmbeddedManifestHeader returns the header of the embedded manifest. It
+// has no source file, so it is given the actor's FilePermissions and
+// embeddedManifestModified.
+func (actor Actor) newEmbeddedManifestHeader() *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:   actor.ZipEmbeddedManifestName,
+		Method: actor.zipMethod(),
+	}
+	setNameEncoding(header)
+	header.SetMode(actor.filePermissions())
+	actor.setModified(header, embeddedManifestModified)
+	actor.setOwner(header)
+	return header
+}
+
+// addEmbeddedManifestToZip adds the JSON manifest of resources, as written
+// by MarshalResources, to the zip under the actor's ZipEmbeddedManifestName.
+// Unlike the resources, it is not checked against a SHA1.
+func (actor Actor) addEmbeddedManifestToZip(resources []Resource, zipFile *zip.Writer) error {
+	manifest, err := actor.MarshalResources(resources)
+	if err != nil {
+		return err
+	}
+
+	writer, err := zipFile.CreateHeader(actor.newEmbeddedManifestHeader())
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(manifest)
+	return err
+}
@@ -0,0 +1,20 @@
+package v2action
+
+import "context"
+
+// GzipContentEncoding is the content encoding of the zips returned by
+// ZipDirectoryResourcesGzipped, suitable for a Content-Encoding header.
+const GzipContentEncoding = "gzip"
+
+// ZipDirectoryResourcesGzipped behaves like ZipDirectoryResources, but wraps
+// the whole zip in a gzip stream for transport, and returns the content
+// encoding of the file along with its location. The file is not a zip until
+// it has been gunzipped, so consumers must gunzip it before reading it as
+// one. ZipVerify is not applied to gzipped zips.
+func (actor Actor) ZipDirectoryResourcesGzipped(sourceDir string, filesToInclude []Resource) (string, string, error) {
+	zipPath, _, err := actor.zipDirectoryResources(context.Background(), sourceDir, filesToInclude, zipOptions{gzip: true})
+	if err != nil {
+		return "", "", err
+	}
+	return zipPath, GzipContentEncoding, nil
+}
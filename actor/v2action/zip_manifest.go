@@ -0,0 +1,77 @@
+package v2action
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+)
+
+// ZipEntry describes a single entry that ZipDirectoryResources would write.
+type ZipEntry struct {
+	Name   string
+	Mode   os.FileMode
+	Size   int64
+	Method uint16
+}
+
+// DescribeZipManifest returns the entries ZipDirectoryResources would write
+// for filesToInclude, in the same order, without reading or compressing any
+// file contents. Directories are always stored uncompressed. The embedded
+// manifest, when ZipEmbeddedManifestName is set, is described last. When the
+// actor's PreserveSymlinks is enabled, symlinks are described as the symlink
+// entries ZipDirectoryResources writes, sized by their target path.
+func (actor Actor) DescribeZipManifest(sourceDir string, filesToInclude []Resource) ([]ZipEntry, error) {
+	stat := os.Stat
+	if actor.PreserveSymlinks {
+		stat = os.Lstat
+	}
+
+	entries := make([]ZipEntry, 0, len(filesToInclude))
+	for _, resource := range sortResources(filesToInclude) {
+		fullPath := filepath.Join(sourceDir, resource.Filename)
+		fileInfo, err := stat(fullPath)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := actor.newZipFileHeader(fullPath, resource.Filename, fileInfo)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := ZipEntry{
+			Name:   header.Name,
+			Mode:   header.Mode(),
+			Method: header.Method,
+		}
+		switch {
+		case fileInfo.IsDir():
+			entry.Method = zip.Store
+		case fileInfo.Mode()&os.ModeSymlink != 0:
+			target, err := readSymlinkTarget(fullPath)
+			if err != nil {
+				return nil, err
+			}
+			entry.Size = int64(len(target))
+		default:
+			entry.Size = fileInfo.Size()
+		}
+		entries = append(entries, entry)
+	}
+
+	if actor.ZipEmbeddedManifestName != "" {
+		manifest, err := actor.MarshalResources(filesToInclude)
+		if err != nil {
+			return nil, err
+		}
+
+		header := actor.newEmbeddedManifestHeader()
+		entries = append(entries, ZipEntry{
+			Name:   header.Name,
+			Mode:   header.Mode(),
+			Size:   int64(len(manifest)),
+			Method: header.Method,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+package v2action
+
+import (
+	"context"
+	"strings"
+)
+
+// ZipNameFunc maps the original name of a zip entry to the name it is stored
+// under in the zip. Names use '/' separators and are passed without the
+// trailing '/' used for directories, which is added back after mapping.
+// Returning false, or an empty name, leaves the entry out of the zip.
+type ZipNameFunc func(original string) (string, bool)
+
+// ZipDirectoryResourcesWithNames behaves like ZipDirectoryResources, but
+// stores each resource under the name returned by rename. The files are still
+// read from sourceDir using their original Filename. A nil rename keeps the
+// original names.
+func (actor Actor) ZipDirectoryResourcesWithNames(sourceDir string, filesToInclude []Resource, rename ZipNameFunc) (string, error) {
+	zipPath, _, err := actor.zipDirectoryResources(context.Background(), sourceDir, filesToInclude, zipOptions{rename: rename})
+	return zipPath, err
+}
+
+// ZipArchiveResourcesWithNames behaves like ZipArchiveResources, but stores
+// each archive entry under the name returned by rename. Entries are still
+// matched against filesToInclude using their original name. A nil rename
+// keeps the original names.
+func (actor Actor) ZipArchiveResourcesWithNames(sourceArchivePath string, filesToInclude []Resource, rename ZipNameFunc) (string, error) {
+	return actor.zipArchiveResources(sourceArchivePath, filesToInclude, zipOptions{rename: rename})
+}
+
+// zipEntryName returns the name the entry originally named original is
+// stored under, without any trailing '/', and false if the entry is left out
+// of the zip.
+func zipEntryName(original string, rename ZipNameFunc) (string, bool) {
+	if rename == nil {
+		return original, true
+	}
+
+	name, ok := rename(strings.TrimSuffix(original, "/"))
+	name = strings.TrimSuffix(name, "/")
+	if !ok || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// renameResources returns the resources kept by rename, along with the name
+// each of them is stored under keyed by its original Filename.
+func renameResources(resources []Resource, rename ZipNameFunc) ([]Resource, map[string]string) {
+	var kept []Resource
+	destPaths := map[string]string{}
+	for _, resource := range resources {
+		name, ok := zipEntryName(resource.Filename, rename)
+		if !ok {
+			continue
+		}
+		kept = append(kept, resource)
+		destPaths[resource.Filename] = name
+	}
+	return kept, destPaths
+}
@@ -0,0 +1,41 @@
+package v2action
+
+import (
+	"archive/zip"
+	"encoding/binary"
+)
+
+const (
+	// zipUnixExtraID identifies the Info-ZIP Unix extra field, which stores
+	// the user and group id owning a zip entry.
+	zipUnixExtraID = 0x7875
+
+	// zipUnixExtraSize is the size of a Unix extra field holding 4 byte ids,
+	// including its id and size.
+	zipUnixExtraSize = 15
+)
+
+// ZipOwner is the user and group id recorded as the owner of zip entries.
+type ZipOwner struct {
+	UID uint32
+	GID uint32
+}
+
+// setOwner adds a Unix extra field recording the actor's ZipOwner to the
+// header. The field only holds the owner, so the mode stays in the header's
+// external attributes.
+func (actor Actor) setOwner(header *zip.FileHeader) {
+	if actor.ZipOwner == nil {
+		return
+	}
+
+	extra := make([]byte, zipUnixExtraSize)
+	binary.LittleEndian.PutUint16(extra[0:], zipUnixExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], zipUnixExtraSize-4)
+	extra[4] = 1 // version
+	extra[5] = 4 // size of the uid
+	binary.LittleEndian.PutUint32(extra[6:], actor.ZipOwner.UID)
+	extra[10] = 4 // size of the gid
+	binary.LittleEndian.PutUint32(extra[11:], actor.ZipOwner.GID)
+	header.Extra = append(header.Extra, extra...)
+}
@@ -0,0 +1,38 @@
+package v2action
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The prefixes of the temporary files the actor creates in its ZipTempDir.
+const (
+	zipTempFilePrefix           = "cf-cli-"
+	streamArchiveTempFilePrefix = "cf-stream-archive"
+)
+
+// zipTempDirInfo returns the file info of the directory the actor creates
+// its temporary files in, or nil if it cannot be stat'd, in which case no
+// temporary files are being written to it.
+func (actor Actor) zipTempDirInfo() os.FileInfo {
+	info, err := os.Stat(actor.zipTempDir())
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// isZipTempFile returns true if the file at path was named by the actor for
+// a temporary zip or stream archive and is directly inside tempDir. Such
+// files may be written by a concurrent zip while a directory that contains
+// the temp directory is gathered, and are never part of the app.
+func isZipTempFile(tempDir os.FileInfo, path string) bool {
+	name := filepath.Base(path)
+	if tempDir == nil || !strings.HasPrefix(name, zipTempFilePrefix) && !strings.HasPrefix(name, streamArchiveTempFilePrefix) {
+		return false
+	}
+
+	dirInfo, err := os.Stat(filepath.Dir(path))
+	return err == nil && os.SameFile(tempDir, dirInfo)
+}
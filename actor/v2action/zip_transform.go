@@ -0,0 +1,59 @@
+package v2action
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+)
+
+// ZipTransformFunc returns the contents stored in the zip for the file being
+// zipped as name, given a reader of its contents on disk. The returned reader
+// is closed after it has been read if it is an io.Closer.
+type ZipTransformFunc func(name string, r io.Reader) (io.Reader, error)
+
+// ZipDirectoryResourcesWithTransform behaves like ZipDirectoryResources, but
+// stores the contents returned by transform for every file. A resource's SHA1
+// describes the file on disk rather than the transformed contents, so each
+// file is still checked against its SHA1 as it is read, and is read in full
+// even when transform does not consume all of it. Since the zipped contents
+// no longer match their SHA1, transformed files must not be left out of the
+// zip because the Cloud Controller already has a matching resource cached.
+// A nil transform zips the files unchanged.
+func (actor Actor) ZipDirectoryResourcesWithTransform(sourceDir string, filesToInclude []Resource, transform ZipTransformFunc) (string, error) {
+	zipPath, _, err := actor.zipDirectoryResources(context.Background(), sourceDir, filesToInclude, zipOptions{transform: transform})
+	return zipPath, err
+}
+
+// copyTransformed copies the contents returned by transform for src to dst
+// and returns the number of bytes read from src, which is always read to the
+// end.
+func (actor Actor) copyTransformed(name string, transform ZipTransformFunc, dst io.Writer, src io.Reader) (int64, error) {
+	source := &countingReader{reader: src}
+	transformed, err := transform(name, source)
+	if err != nil {
+		return 0, err
+	}
+	if closer, ok := transformed.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if _, err := actor.copy(dst, transformed); err != nil {
+		return 0, err
+	}
+	if _, err := actor.copy(ioutil.Discard, source); err != nil {
+		return 0, err
+	}
+	return source.count, nil
+}
+
+// countingReader counts the bytes read from reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
@@ -48,6 +48,9 @@ func (actor Actor) CreateAndUploadPackageByApplicationNameAndSpace(appName strin
 	defer os.Remove(tmpZipFilepath.Name())
 
 	err = writeZipFile(bitsPath, tmpZipFilepath)
+	if closeErr := tmpZipFilepath.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		return Package{}, allWarnings, err
 	}
@@ -95,9 +98,7 @@ func writeZipFile(dir string, targetFile *os.File) error {
 	}
 
 	writer := zip.NewWriter(targetFile)
-	defer writer.Close()
-
-	return filepath.Walk(dir, func(filePath string, fileInfo os.FileInfo, err error) error {
+	err = filepath.Walk(dir, func(filePath string, fileInfo os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -144,4 +145,10 @@ func writeZipFile(dir string, targetFile *os.File) error {
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// closing the writer writes the zip's central directory
+	return writer.Close()
 }
@@ -57,6 +57,7 @@ const (
 	PutAppRequest                         = "PutApp"
 	PutAppBitsRequest                     = "PutAppBits"
 	PutBindRouteAppRequest                = "PutBindRouteApp"
+	PutResourceMatchRequest               = "PutResourceMatch"
 	PutRunningSecurityGroupSpaceRequest   = "PutRunningSecurityGroupSpace"
 	PutStagingSecurityGroupSpaceRequest   = "PutStagingSecurityGroupSpace"
 )
@@ -80,6 +81,7 @@ var APIRoutes = rata.Routes{
 	{Path: "/v2/organizations/:organization_guid/private_domains", Method: http.MethodGet, Name: GetOrganizationPrivateDomainsRequest},
 	{Path: "/v2/private_domains/:private_domain_guid", Method: http.MethodGet, Name: GetPrivateDomainRequest},
 	{Path: "/v2/quota_definitions/:organization_quota_guid", Method: http.MethodGet, Name: GetOrganizationQuotaDefinitionRequest},
+	{Path: "/v2/resource_match", Method: http.MethodPut, Name: PutResourceMatchRequest},
 	{Path: "/v2/routes", Method: http.MethodGet, Name: GetRoutesRequest},
 	{Path: "/v2/routes", Method: http.MethodPost, Name: PostRouteRequest},
 	{Path: "/v2/routes/:route_guid", Method: http.MethodDelete, Name: DeleteRouteRequest},
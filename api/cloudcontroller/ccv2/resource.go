@@ -1,6 +1,13 @@
 package ccv2
 
-import "os"
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"code.cloudfoundry.org/cli/api/cloudcontroller"
+	"code.cloudfoundry.org/cli/api/cloudcontroller/ccv2/internal"
+)
 
 type Resource struct {
 	Filename string      `json:"fn,omitempty"`
@@ -8,3 +15,43 @@ type Resource struct {
 	SHA1     string      `json:"sha1"`
 	Mode     os.FileMode `json:"mode,omitempty"`
 }
+
+// resourceFingerprint is the portion of a Resource used by the Cloud
+// Controller to match cached resources.
+type resourceFingerprint struct {
+	SHA1 string `json:"sha1"`
+	Size int64  `json:"size"`
+}
+
+// ResourceMatch returns the subset of the provided resources that the Cloud
+// Controller already has cached. Resources are matched by SHA1 and size.
+func (client *Client) ResourceMatch(resourcesToMatch []Resource) ([]Resource, Warnings, error) {
+	fingerprints := make([]resourceFingerprint, 0, len(resourcesToMatch)) // Explicitly done to prevent nils
+	for _, resource := range resourcesToMatch {
+		fingerprints = append(fingerprints, resourceFingerprint{
+			SHA1: resource.SHA1,
+			Size: resource.Size,
+		})
+	}
+
+	body, err := json.Marshal(fingerprints)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, err := client.newHTTPRequest(requestOptions{
+		RequestName: internal.PutResourceMatchRequest,
+		Body:        bytes.NewReader(body),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var matchedResources []Resource
+	response := cloudcontroller.Response{
+		Result: &matchedResources,
+	}
+
+	err = client.connection.Make(request, &response)
+	return matchedResources, response.Warnings, err
+}
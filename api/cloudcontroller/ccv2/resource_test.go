@@ -0,0 +1,106 @@
+package ccv2_test
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/cli/api/cloudcontroller/ccerror"
+	. "code.cloudfoundry.org/cli/api/cloudcontroller/ccv2"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Resource", func() {
+	var client *Client
+
+	BeforeEach(func() {
+		client = NewTestClient()
+	})
+
+	Describe("ResourceMatch", func() {
+		var resourcesToMatch []Resource
+
+		BeforeEach(func() {
+			resourcesToMatch = []Resource{
+				{Filename: "some-file", SHA1: "some-sha-1", Size: 1, Mode: 0644},
+				{Filename: "some-other-file", SHA1: "some-sha-2", Size: 2, Mode: 0755},
+			}
+		})
+
+		Context("when the cloud controller returns the matched resources", func() {
+			BeforeEach(func() {
+				expectedBody := `[
+					{"sha1": "some-sha-1", "size": 1},
+					{"sha1": "some-sha-2", "size": 2}
+				]`
+				response := `[
+					{"sha1": "some-sha-2", "size": 2}
+				]`
+
+				server.AppendHandlers(
+					CombineHandlers(
+						VerifyRequest(http.MethodPut, "/v2/resource_match"),
+						VerifyJSON(expectedBody),
+						RespondWith(http.StatusOK, response, http.Header{"X-Cf-Warnings": {"this is a warning"}}),
+					),
+				)
+			})
+
+			It("returns the matched resources and warnings", func() {
+				matchedResources, warnings, err := client.ResourceMatch(resourcesToMatch)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(matchedResources).To(Equal([]Resource{
+					{SHA1: "some-sha-2", Size: 2},
+				}))
+				Expect(warnings).To(ConsistOf(Warnings{"this is a warning"}))
+			})
+		})
+
+		Context("when there are no resources to match", func() {
+			BeforeEach(func() {
+				server.AppendHandlers(
+					CombineHandlers(
+						VerifyRequest(http.MethodPut, "/v2/resource_match"),
+						VerifyJSON("[]"),
+						RespondWith(http.StatusOK, "[]"),
+					),
+				)
+			})
+
+			It("sends an empty list", func() {
+				matchedResources, _, err := client.ResourceMatch(nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(matchedResources).To(BeEmpty())
+			})
+		})
+
+		Context("when the client returns an error", func() {
+			BeforeEach(func() {
+				response := `{
+					"code": 10001,
+					"description": "Some Error",
+					"error_code": "CF-SomeError"
+				}`
+				server.AppendHandlers(
+					CombineHandlers(
+						VerifyRequest(http.MethodPut, "/v2/resource_match"),
+						RespondWith(http.StatusTeapot, response, http.Header{"X-Cf-Warnings": {"this is a warning"}}),
+					),
+				)
+			})
+
+			It("returns the error and warnings", func() {
+				_, warnings, err := client.ResourceMatch(resourcesToMatch)
+				Expect(err).To(MatchError(ccerror.V2UnexpectedResponseError{
+					ResponseCode: http.StatusTeapot,
+					V2ErrorResponse: ccerror.V2ErrorResponse{
+						Code:        10001,
+						Description: "Some Error",
+						ErrorCode:   "CF-SomeError",
+					},
+				}))
+				Expect(warnings).To(ConsistOf(Warnings{"this is a warning"}))
+			})
+		})
+	})
+})